@@ -1,37 +1,312 @@
 package blscosi_bundle
 
 import (
+	"context"
 	"errors"
+	"time"
 
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
 	"go.dedis.ch/onet/v4"
 	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/onet/v4/network"
 )
 
 // Client is a structure to communicate with the CoSi
 // service
 type Client struct {
 	*onet.Client
+	// Strategy selects the order in which the members of the roster are
+	// tried as entry node
+	Strategy EntryStrategy
+	// AttemptTimeout is the time given to an entry node to answer a ping
+	// before the next one is tried, zero means that only the context limits
+	// it. The time given to the request is derived from the context, see
+	// requestTimeout.
+	AttemptTimeout time.Duration
 }
 
 // NewClient instantiates a new blscosi_bundle.Client
 func NewClient() *Client {
-	return &Client{Client: onet.NewClient(suite, ServiceName)}
+	return &Client{
+		Client:         onet.NewClient(suite, ServiceName),
+		Strategy:       EntryFirst,
+		AttemptTimeout: defaultAttemptTimeout,
+	}
 }
 
 // SignatureRequest sends a CoSi sign request to the Cothority defined by the given
-// Roster
-func (c *Client) SignatureRequest(r *onet.Roster, msg []byte) (*SignatureResponse, error) {
+// Roster. The members are tried as entry node until one of them replies.
+func (c *Client) SignatureRequest(ctx context.Context, r *onet.Roster, msg []byte) (*SignatureResponse, error) {
+	return c.SignatureRequestWithParams(ctx, r, msg, protocol.Parameters{})
+}
+
+// SignatureRequestWithParams is SignatureRequest with the parameters of the
+// protocol, the default ones being used if they are empty.
+func (c *Client) SignatureRequestWithParams(ctx context.Context, r *onet.Roster, msg []byte,
+	params protocol.Parameters) (*SignatureResponse, error) {
+	serviceReq := &SignatureRequest{
+		Roster:  r,
+		Message: msg,
+		Params:  params,
+	}
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &SignatureResponse{}
+		return reply, c.SendProtobuf(dst, serviceReq, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*SignatureResponse), nil
+}
+
+// SignatureRequestTo sends the request to dst only, without failover, and
+// returns the signature of the roster
+func (c *Client) SignatureRequestTo(ctx context.Context, dst *network.ServerIdentity, r *onet.Roster,
+	msg []byte, params protocol.Parameters) (*SignatureResponse, error) {
 	serviceReq := &SignatureRequest{
 		Roster:  r,
 		Message: msg,
+		Params:  params,
+	}
+	reply, err := c.attempt(ctx, 0, dst, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &SignatureResponse{}
+		return reply, c.SendProtobuf(dst, serviceReq, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*SignatureResponse), nil
+}
+
+// SetupDKG asks the roster to run a distributed key generation and returns
+// the public key of the group
+func (c *Client) SetupDKG(ctx context.Context, r *onet.Roster) (*DKGSetupResponse, error) {
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &DKGSetupResponse{}
+		return reply, c.SendProtobuf(dst, &DKGSetupRequest{Roster: r}, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*DKGSetupResponse), nil
+}
+
+// ThresholdSignatureRequest sends a threshold sign request to the Cothority
+// defined by the given Roster, which must have run the DKG setup before
+func (c *Client) ThresholdSignatureRequest(ctx context.Context, r *onet.Roster, msg []byte) (*ThresholdSignatureResponse, error) {
+	serviceReq := &ThresholdSignatureRequest{
+		Roster:  r,
+		Message: msg,
+	}
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &ThresholdSignatureResponse{}
+		return reply, c.SendProtobuf(dst, serviceReq, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*ThresholdSignatureResponse), nil
+}
+
+// BatchSignatureRequest sends a request to sign all the messages in a single
+// protocol run to the Cothority defined by the given Roster
+func (c *Client) BatchSignatureRequest(ctx context.Context, r *onet.Roster, msgs [][]byte) (*BatchSignatureResponse, error) {
+	serviceReq := &BatchSignatureRequest{
+		Roster:   r,
+		Messages: msgs,
+	}
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		log.Lvl4("Sending batch of", len(msgs), "messages to", dst)
+		reply := &BatchSignatureResponse{}
+		return reply, c.SendProtobuf(dst, serviceReq, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*BatchSignatureResponse), nil
+}
+
+// LookupSignature asks the members of the roster for the signatures they
+// keep for the hash of a message, signed by that same roster
+func (c *Client) LookupSignature(ctx context.Context, r *onet.Roster, hash []byte) (*LookupSignatureResponse, error) {
+	serviceReq := &LookupSignatureRequest{
+		Hash:     hash,
+		RosterID: r.ID[:],
+	}
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &LookupSignatureResponse{}
+		return reply, c.SendProtobuf(dst, serviceReq, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*LookupSignatureResponse), nil
+}
+
+// SubmitSignature starts the signature of msg by the Cothority defined by
+// the given Roster and returns the identifier of the request, to be used with
+// the node given in the response
+func (c *Client) SubmitSignature(ctx context.Context, r *onet.Roster, msg []byte) (*SubmitSignatureResponse, error) {
+	serviceReq := &SubmitSignatureRequest{
+		Roster:  r,
+		Message: msg,
+	}
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &SubmitSignatureResponse{}
+		return reply, c.SendProtobuf(dst, serviceReq, reply)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return reply.(*SubmitSignatureResponse), nil
+}
+
+// SignatureStream requests the signature of msg and returns the updates of
+// the round as the aggregate grows. The last update is the final signature.
+// The round is cancelled if ctx is done before.
+func (c *Client) SignatureStream(ctx context.Context, r *onet.Roster, msg []byte) (<-chan *SignatureProgressResponse, error) {
+	serviceReq := &SignatureStreamRequest{
+		Roster:  r,
+		Message: msg,
+	}
+	var entry *network.ServerIdentity
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		entry = dst
+		return c.Stream(dst, serviceReq)
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn := reply.(onet.StreamingConn)
+
+	// the round is cancelled if the context is done before the end
+	ids := make(chan []byte, 1)
+	ended := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-ended:
+			return
+		}
+		select {
+		case id := <-ids:
+			if err := c.CancelSignature(entry, id); err != nil {
+				log.Lvl3("Couldn't cancel the streamed round:", err)
+			}
+		case <-ended:
+		}
+	}()
+
+	updates := make(chan *SignatureProgressResponse)
+	go func() {
+		defer close(updates)
+		defer close(ended)
+		for first := true; ; first = false {
+			update := &SignatureProgressResponse{}
+			if err := conn.ReadMessage(update); err != nil {
+				log.Lvl3("Signature stream ended:", err)
+				return
+			}
+			if first {
+				ids <- update.RequestID
+			}
+			updates <- update
+			if update.Final {
+				return
+			}
+		}
+	}()
+	return updates, nil
+}
+
+// SignatureStatus returns the progress of a request submitted to dst
+func (c *Client) SignatureStatus(dst *network.ServerIdentity, id []byte) (*SignatureStatusResponse, error) {
+	reply := &SignatureStatusResponse{}
+	err := c.SendProtobuf(dst, &SignatureStatusRequest{RequestID: id}, reply)
+
+	return reply, err
+}
+
+// FetchSignature returns the signature of a request submitted to dst, it
+// fails if the protocol is not done yet
+func (c *Client) FetchSignature(dst *network.ServerIdentity, id []byte) (*SignatureResponse, error) {
+	reply := &SignatureResponse{}
+	err := c.SendProtobuf(dst, &FetchSignatureRequest{RequestID: id}, reply)
+
+	return reply, err
+}
+
+// CancelSignature aborts the round of a request submitted or streamed to dst
+func (c *Client) CancelSignature(dst *network.ServerIdentity, id []byte) error {
+	return c.SendProtobuf(dst, &CancelSignatureRequest{RequestID: id}, &CancelSignatureResponse{})
+}
+
+// RecoveredSignature asks the members of r for the final signature of a round
+// whose root was gone, given the hash of the message and the ID of the roster
+// of the round
+func (c *Client) RecoveredSignature(ctx context.Context, r *onet.Roster, rosterID onet.RosterID,
+	hash []byte) (*SignatureResponse, error) {
+	req := &RecoveredSignatureRequest{Hash: hash, RosterID: rosterID[:]}
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &SignatureResponse{}
+		return reply, c.SendProtobuf(dst, req, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*SignatureResponse), nil
+}
+
+// OpenSession opens a signing session on the first node of the roster, which
+// coordinates all the rounds of the session
+func (c *Client) OpenSession(r *onet.Roster, params protocol.Parameters) (*OpenSessionResponse, error) {
 	if len(r.List) == 0 {
 		return nil, errors.New("Got an empty roster-list")
 	}
 	dst := r.List[0]
-	log.Lvl4("Sending message to", dst)
-	reply := &SignatureResponse{}
-	err := c.SendProtobuf(dst, serviceReq, reply)
+	log.Lvl4("Opening session on", dst)
+	reply := &OpenSessionResponse{}
+	err := c.SendProtobuf(dst, &OpenSessionRequest{Roster: r, Params: params}, reply)
+
+	return reply, err
+}
+
+// SendSessionMessage adds a message to sign to a session opened on dst
+func (c *Client) SendSessionMessage(dst *network.ServerIdentity, id []byte, msg []byte) (*SessionMessageResponse, error) {
+	reply := &SessionMessageResponse{}
+	err := c.SendProtobuf(dst, &SessionMessageRequest{SessionID: id, Message: msg}, reply)
+
+	return reply, err
+}
+
+// StreamSession returns the signatures of a session opened on dst, in the
+// order of the rounds. The channel is closed when the session ends.
+func (c *Client) StreamSession(dst *network.ServerIdentity, id []byte) (<-chan *SessionSignatureResponse, error) {
+	conn, err := c.Stream(dst, &SessionStreamRequest{SessionID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	sigs := make(chan *SessionSignatureResponse)
+	go func() {
+		defer close(sigs)
+		for {
+			reply := &SessionSignatureResponse{}
+			if err := conn.ReadMessage(reply); err != nil {
+				log.Lvl3("Session stream ended:", err)
+				return
+			}
+			sigs <- reply
+		}
+	}()
+	return sigs, nil
+}
+
+// CloseSession closes a session opened on dst once its pending messages are
+// signed
+func (c *Client) CloseSession(dst *network.ServerIdentity, id []byte) (*CloseSessionResponse, error) {
+	reply := &CloseSessionResponse{}
+	err := c.SendProtobuf(dst, &CloseSessionRequest{SessionID: id}, reply)
 
 	return reply, err
 }
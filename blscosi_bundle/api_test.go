@@ -1,7 +1,9 @@
 package blscosi_bundle
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/onet/v4"
@@ -17,13 +19,13 @@ func TestClient_SignatureRequest(t *testing.T) {
 	client := NewClient()
 	msg := []byte("hello blscosi_bundle service")
 
-	_, err := client.SignatureRequest(&onet.Roster{}, msg)
+	_, err := client.SignatureRequest(context.Background(), &onet.Roster{}, msg)
 	require.Error(t, err)
 
 	for _, dst := range roster.List {
 		newRoster := roster.NewRosterWithRoot(dst)
 		log.Lvlf1("Sending request to service... %v", dst)
-		reply, err := client.SignatureRequest(newRoster, msg)
+		reply, err := client.SignatureRequest(context.Background(), newRoster, msg)
 		require.Nil(t, err, "Couldn't send")
 
 		publics := newRoster.ServicePublics(ServiceName)
@@ -32,3 +34,63 @@ func TestClient_SignatureRequest(t *testing.T) {
 		require.Nil(t, reply.Signature.Verify(testSuite, msg, publics))
 	}
 }
+
+func TestClient_Failover(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	servers, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	// the first entry node is down
+	require.NoError(t, servers[0].Close())
+
+	msg := []byte("hello failover")
+	publics := roster.ServicePublics(ServiceName)
+	for _, strategy := range []EntryStrategy{EntryFirst, EntryRandom, EntryLatency} {
+		client := NewClient()
+		client.Strategy = strategy
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		reply, err := client.SignatureRequest(ctx, roster, msg)
+		cancel()
+		require.NoError(t, err)
+		require.NoError(t, reply.Signature.VerifyAggregate(testSuite, msg, publics))
+	}
+
+	// only the dead node is in the roster
+	client := NewClient()
+	_, err := client.SignatureRequest(context.Background(), onet.NewRoster(roster.List[:1]), msg)
+	require.Error(t, err)
+	failure, ok := err.(*FailoverError)
+	require.True(t, ok)
+	require.Equal(t, 1, len(failure.Tried))
+	require.True(t, failure.Tried[0].Node.Equal(roster.List[0]))
+
+	// a node that got the request isn't replaced when it fails
+	_, err = client.BatchSignatureRequest(context.Background(), onet.NewRoster(roster.List[1:]), nil)
+	require.Error(t, err)
+	require.Equal(t, 1, len(err.(*FailoverError).Tried))
+
+	// a node that answers the ping but never replies to the request is
+	// replaced once its share of the request timeout is over
+	hanging := servers[1].Service(ServiceName).(*Service)
+	hanging.MaxRounds = 1
+	hanging.MaxQueue = 10
+	_, err = hanging.sched.acquire(0, hanging.MaxRounds, hanging.MaxQueue)
+	require.NoError(t, err)
+	defer hanging.sched.release()
+
+	alive := onet.NewRoster(roster.List[1:])
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	start := time.Now()
+	reply, err := client.SignatureRequest(ctx, alive, msg)
+	cancel()
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < 10*time.Second)
+	require.NoError(t, reply.Signature.VerifyAggregate(testSuite, msg, alive.ServicePublics(ServiceName)))
+
+	// a done context stops the client
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = client.SignatureRequest(ctx, roster, msg)
+	require.Error(t, err)
+	require.Equal(t, 1, len(err.(*FailoverError).Tried))
+}
@@ -0,0 +1,333 @@
+package blscosi_bundle
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/onet/v4/network"
+)
+
+// defaultRetention is the time the results of asynchronous requests are kept
+// once they are completed.
+const defaultRetention = 10 * time.Minute
+
+var (
+	// ErrCancelled is the error of a round that has been cancelled by the
+	// client.
+	ErrCancelled = errors.New("the signing round has been cancelled")
+	// ErrNoSignature is the error of a round that ended without a final
+	// signature, typically because it timed out.
+	ErrNoSignature = errors.New("the signing round ended without a signature")
+)
+
+// SubmitSignatureRequest starts the signature of a message without waiting
+// for the end of the protocol.
+type SubmitSignatureRequest struct {
+	Message  []byte
+	Roster   *onet.Roster
+	Params   protocol.Parameters
+	Priority int
+}
+
+// SubmitSignatureResponse contains the identifier of the request, which is
+// only known by Node.
+type SubmitSignatureResponse struct {
+	RequestID []byte
+	Node      *network.ServerIdentity
+}
+
+// SignatureStatusRequest asks for the progress of a submitted request.
+type SignatureStatusRequest struct {
+	RequestID []byte
+}
+
+// SignatureStatusResponse is the progress of a submitted request as seen by
+// the root of the protocol. Cancelled is set if the request ended because it
+// has been cancelled rather than because of an error.
+type SignatureStatusResponse struct {
+	Signers   int
+	Mask      []byte
+	Elapsed   time.Duration
+	Done      bool
+	Error     string
+	Cancelled bool
+}
+
+// FetchSignatureRequest asks for the result of a submitted request.
+type FetchSignatureRequest struct {
+	RequestID []byte
+}
+
+// CancelSignatureRequest asks the node to abort a submitted or streamed
+// request.
+type CancelSignatureRequest struct {
+	RequestID []byte
+}
+
+// CancelSignatureResponse confirms that the round is being aborted.
+type CancelSignatureResponse struct{}
+
+// SignatureStreamRequest asks for the signature of a message along with the
+// progress of the round.
+type SignatureStreamRequest struct {
+	Message []byte
+	Roster  *onet.Roster
+	Params  protocol.Parameters
+}
+
+// SignatureProgressResponse is an update of a streamed round. The signature
+// is the partial aggregate of the signers of the mask, or the final
+// signature in the last update. RequestID can be used to cancel the round.
+type SignatureProgressResponse struct {
+	Signers   int
+	Mask      []byte
+	Signature protocol.BlsSignature
+	Final     bool
+	Hash      []byte
+	RequestID []byte
+}
+
+// asyncRequest is a submitted request and, once the protocol is done, its
+// result.
+type asyncRequest struct {
+	p      *protocol.BlsCosi
+	start  time.Time
+	end    time.Time
+	done   bool
+	err    error
+	result *SignatureResponse
+}
+
+// asyncRequests holds the submitted requests of a node.
+type asyncRequests struct {
+	sync.Mutex
+	requests map[string]*asyncRequest
+}
+
+// SubmitSignature starts the protocol and returns with the identifier of the
+// request, once the request got a free round.
+func (s *Service) SubmitSignature(req *SubmitSignatureRequest) (network.Message, error) {
+	queued, err := s.sched.acquire(req.Priority, s.MaxRounds, s.MaxQueue)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.startSigning(req.Roster, req.Message, req.Params)
+	if err != nil {
+		s.sched.release()
+		return nil, err
+	}
+
+	ar := s.addAsync(p)
+	go func() {
+		sig := <-p.FinalSignature
+		s.sched.release()
+		if sig == nil {
+			s.endAsync(ar, nil, roundError(p))
+			return
+		}
+
+		h := s.suite.Hash()
+		h.Write(req.Message)
+		res := &SignatureResponse{Hash: h.Sum(nil), Signature: sig, QueueTime: queued}
+		s.storeSignature(newRecord(res.Hash, req.Roster, sig, gossipStrategy(p.Params), ar.start))
+		s.endAsync(ar, res, nil)
+	}()
+
+	id := p.Token().RoundID
+	return &SubmitSignatureResponse{RequestID: id[:], Node: s.ServerIdentity()}, nil
+}
+
+// SignatureStatus returns the number of signers known by the root, their mask
+// and the time elapsed since the submission.
+func (s *Service) SignatureStatus(req *SignatureStatusRequest) (network.Message, error) {
+	s.async.Lock()
+	defer s.async.Unlock()
+	ar, err := s.getAsync(req.RequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	signers, mask := ar.p.Progress()
+	res := &SignatureStatusResponse{
+		Signers: signers,
+		Mask:    mask,
+		Done:    ar.done,
+	}
+	if ar.done {
+		res.Elapsed = ar.end.Sub(ar.start)
+	} else {
+		res.Elapsed = time.Since(ar.start)
+	}
+	if ar.err != nil {
+		res.Error = ar.err.Error()
+		res.Cancelled = ar.err == ErrCancelled
+	}
+	return res, nil
+}
+
+// FetchSignature returns the final signature of a submitted request once the
+// protocol is done.
+func (s *Service) FetchSignature(req *FetchSignatureRequest) (network.Message, error) {
+	s.async.Lock()
+	defer s.async.Unlock()
+	ar, err := s.getAsync(req.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if !ar.done {
+		return nil, errors.New("the signature is not ready yet")
+	}
+	if ar.err != nil {
+		return nil, ar.err
+	}
+	return ar.result, nil
+}
+
+// CancelSignature aborts the round of a submitted or streamed request. The
+// request is then reported as cancelled.
+func (s *Service) CancelSignature(req *CancelSignatureRequest) (network.Message, error) {
+	s.async.Lock()
+	defer s.async.Unlock()
+	ar, err := s.getAsync(req.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if ar.done {
+		return nil, errors.New("the request is already done")
+	}
+	ar.p.Cancel()
+	return &CancelSignatureResponse{}, nil
+}
+
+// addAsync registers a round started by this node so that its status can be
+// requested.
+func (s *Service) addAsync(p *protocol.BlsCosi) *asyncRequest {
+	ar := &asyncRequest{p: p, start: time.Now()}
+	s.async.Lock()
+	s.purgeAsync()
+	s.async.requests[p.Token().RoundID.String()] = ar
+	s.async.Unlock()
+	return ar
+}
+
+// endAsync records the result of a registered round.
+func (s *Service) endAsync(ar *asyncRequest, res *SignatureResponse, err error) {
+	s.async.Lock()
+	defer s.async.Unlock()
+	ar.done = true
+	ar.end = time.Now()
+	ar.result = res
+	ar.err = err
+	log.Lvl3("Request", ar.p.Token().RoundID, "is done:", err)
+}
+
+// getAsync returns the request with the given identifier. The caller must
+// hold the lock of the requests.
+func (s *Service) getAsync(id []byte) (*asyncRequest, error) {
+	s.purgeAsync()
+	ar, ok := s.async.requests[uuidString(id)]
+	if !ok {
+		return nil, errors.New("unknown request")
+	}
+	return ar, nil
+}
+
+// purgeAsync removes the requests that are done since more than the
+// retention period. The caller must hold the lock of the requests.
+func (s *Service) purgeAsync() {
+	for id, ar := range s.async.requests {
+		if ar.done && time.Since(ar.end) > s.Retention {
+			delete(s.async.requests, id)
+		}
+	}
+}
+
+// SignatureStream signs the message and sends an update to the client every
+// time the aggregate of the root grows, then the final signature. The round
+// is cancelled if the client goes away before the end.
+func (s *Service) SignatureStream(req *SignatureStreamRequest) (chan *SignatureProgressResponse, chan bool, error) {
+	if _, err := s.sched.acquire(0, s.MaxRounds, s.MaxQueue); err != nil {
+		return nil, nil, err
+	}
+	p, err := s.newSigning(req.Roster, req.Message, req.Params)
+	if err != nil {
+		s.sched.release()
+		return nil, nil, err
+	}
+	p.ProgressChan = make(chan protocol.RoundProgress, 16)
+	if err := p.Start(); err != nil {
+		s.sched.release()
+		return nil, nil, err
+	}
+	ar := s.addAsync(p)
+	id := p.Token().RoundID
+
+	h := s.suite.Hash()
+	h.Write(req.Message)
+	hash := h.Sum(nil)
+
+	outChan := make(chan *SignatureProgressResponse)
+	stopChan := make(chan bool)
+	go func() {
+		defer s.sched.release()
+		defer close(outChan)
+		progress := p.ProgressChan
+		stop := stopChan
+		// the protocol runs until the end even if the client left, so that
+		// the request is correctly reported
+		for {
+			var res *SignatureProgressResponse
+			select {
+			case update, ok := <-progress:
+				if !ok {
+					progress = nil
+					continue
+				}
+				res = &SignatureProgressResponse{update.Signers, update.Mask, update.Aggregate, false, hash, id[:]}
+			case sig := <-p.FinalSignature:
+				if sig == nil {
+					err := roundError(p)
+					log.Lvl2("Streamed round finished without a signature:", err)
+					s.endAsync(ar, nil, err)
+					return
+				}
+				mask, err := sig.GetMask(s.suite, req.Roster.ServicePublics(ServiceName))
+				if err != nil {
+					log.Error("Couldn't read the final mask:", err)
+					s.endAsync(ar, nil, err)
+					return
+				}
+				res = &SignatureProgressResponse{mask.CountEnabled(), mask.Mask(), sig, true, hash, id[:]}
+				s.storeSignature(newRecord(hash, req.Roster, sig, gossipStrategy(p.Params), ar.start))
+				s.endAsync(ar, &SignatureResponse{Hash: hash, Signature: sig}, nil)
+			case <-stop:
+				log.Lvl2("Client left the stream, cancelling the round")
+				p.Cancel()
+				stop = nil
+				continue
+			}
+
+			if stop == nil {
+				if res.Final {
+					return
+				}
+				continue
+			}
+			select {
+			case outChan <- res:
+			case <-stop:
+				log.Lvl2("Client left the stream, cancelling the round")
+				p.Cancel()
+				stop = nil
+			}
+			if res.Final {
+				return
+			}
+		}
+	}()
+	return outChan, stopChan, nil
+}
@@ -0,0 +1,121 @@
+package blscosi_bundle
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+)
+
+// Prefixes used to separate the hashes of the leaves from the ones of the
+// inner nodes of the Merkle tree.
+const (
+	leafPrefix = byte(0)
+	nodePrefix = byte(1)
+)
+
+// MerkleStep is one level of an inclusion proof: the hash of the sibling and
+// whether it is on the left.
+type MerkleStep struct {
+	Hash []byte
+	Left bool
+}
+
+// BatchSignature is the signature of one message of a batch. The collective
+// signature is over the Merkle root of the batch, and the proof shows that
+// the message is one of its leaves.
+type BatchSignature struct {
+	Hash      []byte
+	Root      []byte
+	Proof     []MerkleStep
+	Signature protocol.BlsSignature
+}
+
+// Verify checks that the message is part of the batch and that the batch has
+// been signed by the given public keys with the default policy.
+func (bs *BatchSignature) Verify(suite pairing.Suite, msg []byte, publics []kyber.Point) error {
+	h := suite.Hash()
+	h.Write(msg)
+	if !bytes.Equal(h.Sum(nil), bs.Hash) {
+		return errors.New("hash of the message doesn't match")
+	}
+
+	root := merkleRootFromProof(suite, bs.Hash, bs.Proof)
+	if !bytes.Equal(root, bs.Root) {
+		return errors.New("message is not part of the signed batch")
+	}
+
+	return bs.Signature.VerifyAggregate(suite, bs.Root, publics)
+}
+
+// merkleTree computes the root of the tree with the given hashes as leaves,
+// and the inclusion proof of every leaf. An odd node is promoted to the next
+// level as is.
+func merkleTree(suite pairing.Suite, hashes [][]byte) ([]byte, [][]MerkleStep) {
+	proofs := make([][]MerkleStep, len(hashes))
+	// positions[i] is the index of the subtree containing leaf i in the
+	// current level
+	positions := make([]int, len(hashes))
+	level := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		level[i] = hashLeaf(suite, hash)
+		positions[i] = i
+	}
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, hashNode(suite, level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+
+		for leaf, pos := range positions {
+			if pos%2 == 0 && pos+1 < len(level) {
+				proofs[leaf] = append(proofs[leaf], MerkleStep{level[pos+1], false})
+			} else if pos%2 == 1 {
+				proofs[leaf] = append(proofs[leaf], MerkleStep{level[pos-1], true})
+			}
+			positions[leaf] = pos / 2
+		}
+		level = next
+	}
+
+	if len(level) == 0 {
+		return nil, proofs
+	}
+	return level[0], proofs
+}
+
+// merkleRootFromProof computes the root of the tree from a leaf and its
+// inclusion proof.
+func merkleRootFromProof(suite pairing.Suite, hash []byte, proof []MerkleStep) []byte {
+	current := hashLeaf(suite, hash)
+	for _, step := range proof {
+		if step.Left {
+			current = hashNode(suite, step.Hash, current)
+		} else {
+			current = hashNode(suite, current, step.Hash)
+		}
+	}
+	return current
+}
+
+func hashLeaf(suite pairing.Suite, hash []byte) []byte {
+	h := suite.Hash()
+	h.Write([]byte{leafPrefix})
+	h.Write(hash)
+	return h.Sum(nil)
+}
+
+func hashNode(suite pairing.Suite, left, right []byte) []byte {
+	h := suite.Hash()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
@@ -9,17 +9,38 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/dedis/student_19_elias/blscosi_bundle"
 	"github.com/dedis/student_19_elias/blscosi_bundle/blscosi_bundle/check"
+	"github.com/dedis/student_19_elias/blscosi_bundle/container"
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	kyberSign "go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v4"
 	"go.dedis.ch/onet/v4/app"
 	"go.dedis.ch/onet/v4/log"
 	cli "gopkg.in/urfave/cli.v1"
 )
 
+var cliSuite = pairing.NewSuiteBn256()
+
 type sigHex struct {
+	File      string `json:",omitempty"`
 	Hash      string
 	Signature string
+	// Root and Proof are only set for the signatures of a batch
+	Root  string          `json:",omitempty"`
+	Proof []merkleStepHex `json:",omitempty"`
+}
+
+type merkleStepHex struct {
+	Hash string
+	Left bool
 }
 
 // check contacts all servers and verifies if it receives a valid
@@ -28,7 +49,64 @@ func checkRequest(c *cli.Context) error {
 	tomlFileName := c.String(optionGroup)
 
 	log.Info("Checking the availability and responsiveness of the servers in the group...")
-	return check.CothorityCheck(tomlFileName, c.Bool("detail"))
+	report, err := check.CheckGroupFile(tomlFileName, check.CheckConfig{
+		Detail:      c.Bool("detail"),
+		Parallelism: c.Int("parallel"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		err = writeJSON(report, c.App.Writer)
+	} else {
+		err = writeCheckTable(report, c.App.Writer)
+	}
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// writeCheckTable prints the report of a check as tables
+func writeCheckTable(r *check.CheckReport, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "INDEX\tADDRESS\tDESCRIPTION\tREACHABLE\tLATENCY\tERROR")
+	for _, srv := range r.Servers {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%v\t%v\t%s\n", srv.Index, srv.Address, srv.Description,
+			srv.Reachable, srv.Latency, srv.Error)
+	}
+
+	if len(r.Rounds) > 0 {
+		fmt.Fprintln(tw, "\nROUND\tSERVERS\tSIGNERS\tLATENCY\tERROR")
+		for i, round := range r.Rounds {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%v\t%s\n", i, len(round.Servers), round.Signers, round.Latency, round.Error)
+		}
+	}
+
+	if len(r.Pairs) > 0 {
+		fmt.Fprint(tw, "\nFROM \\ TO")
+		for j := range r.Pairs {
+			fmt.Fprintf(tw, "\t%d", j)
+		}
+		fmt.Fprintln(tw)
+		for i, row := range r.Pairs {
+			fmt.Fprintf(tw, "%d", i)
+			for _, pair := range row {
+				switch {
+				case pair == nil:
+					fmt.Fprint(tw, "\t-")
+				case pair.OK:
+					fmt.Fprintf(tw, "\t%v", pair.Latency.Round(time.Millisecond))
+				default:
+					fmt.Fprint(tw, "\tfailed")
+				}
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	fmt.Fprintf(tw, "\nChecked in %v\n", r.Duration)
+	return tw.Flush()
 }
 
 // signFile will search for the file and sign it
@@ -37,14 +115,39 @@ func signFile(c *cli.Context) error {
 	if c.Args().First() == "" {
 		return errors.New("Please give the file to sign")
 	}
-	fileName := c.Args().First()
 	groupToml := c.String(optionGroup)
-	msg, err := ioutil.ReadFile(fileName)
-	if err != nil {
-		return errors.New("Couldn't read file to be signed:" + err.Error())
+	msgs := make([][]byte, c.NArg())
+	for i, fileName := range c.Args() {
+		msg, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return errors.New("Couldn't read file to be signed:" + err.Error())
+		}
+		msgs[i] = msg
 	}
 
-	sig, err := sign(msg, groupToml)
+	var sig interface{}
+	var err error
+	if len(msgs) > 1 {
+		if c.String(optionKey) != "" {
+			return errors.New("Threshold signatures of a batch are not supported")
+		}
+		if c.Bool(optionContainer) {
+			return errors.New("Containers of the signatures of a batch are not supported")
+		}
+		sig, err = signBatch(c.Args(), msgs, groupToml)
+	} else if keyFile := c.String(optionKey); keyFile != "" {
+		var res *blscosi_bundle.ThresholdSignatureResponse
+		res, err = signThreshold(msgs[0], groupToml, keyFile)
+		if err == nil && c.Bool(optionContainer) {
+			sig = check.NewThresholdContainer(res)
+		} else if err == nil {
+			sig = &blscosi_bundle.SignatureResponse{Hash: res.Hash, Signature: res.Signature}
+		}
+	} else if c.Bool(optionContainer) {
+		sig, err = signContainer(msgs[0], groupToml)
+	} else {
+		sig, err = sign(msgs[0], groupToml)
+	}
 	if err != nil {
 		return fmt.Errorf("Couldn't create signature: %s", err.Error())
 	}
@@ -60,7 +163,11 @@ func signFile(c *cli.Context) error {
 		outFile = os.Stdout
 	}
 
-	err = writeSigAsJSON(sig, outFile)
+	if res, ok := sig.(*blscosi_bundle.SignatureResponse); ok {
+		err = writeSigAsJSON(res, outFile)
+	} else {
+		err = writeJSON(sig, outFile)
+	}
 	if err != nil {
 		return err
 	}
@@ -77,7 +184,7 @@ func verifyFile(c *cli.Context) error {
 	}
 
 	sigOrEmpty := c.String("signature")
-	err := verify(c.Args().First(), sigOrEmpty, c.String(optionGroup))
+	err := verify(c.Args().First(), sigOrEmpty, c.String(optionGroup), c.String(optionKey), c.String(optionPolicy))
 	if err != nil {
 		return fmt.Errorf("Invalid: Signature verification failed: %s", err.Error())
 	}
@@ -86,13 +193,65 @@ func verifyFile(c *cli.Context) error {
 	return nil
 }
 
+// fetchFile gets the signature of a file from the servers of the group
+func fetchFile(c *cli.Context) error {
+	fileName := c.Args().First()
+	if fileName == "" {
+		return errors.New("Please give the file to fetch the signature of")
+	}
+	msg, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return errors.New("Couldn't read file:" + err.Error())
+	}
+	roster, err := readRoster(c.String(optionGroup))
+	if err != nil {
+		return err
+	}
+
+	rec, err := check.FetchSignature(msg, roster)
+	if err != nil {
+		return fmt.Errorf("Couldn't fetch signature: %s", err.Error())
+	}
+	log.Lvlf2("Got a %s signature issued at %v", rec.Strategy, time.Unix(0, rec.Finished))
+
+	proof := make([]merkleStepHex, len(rec.Proof))
+	for i, step := range rec.Proof {
+		proof[i] = merkleStepHex{hex.EncodeToString(step.Hash), step.Left}
+	}
+	sig := sigHex{
+		Hash:      hex.EncodeToString(rec.Hash),
+		Signature: hex.EncodeToString(rec.Signature),
+		Root:      hex.EncodeToString(rec.Root),
+		Proof:     proof,
+	}
+
+	outFileName := c.String("out")
+	if outFileName == "" {
+		return writeJSON(sig, c.App.Writer)
+	}
+	outFile, err := os.Create(outFileName)
+	if err != nil {
+		return fmt.Errorf("Couldn't create signature file: %s", err.Error())
+	}
+	defer outFile.Close()
+	if err := writeJSON(sig, outFile); err != nil {
+		return err
+	}
+	log.Lvlf2("Signature written to: %s", outFileName)
+	return nil
+}
+
 // writeSigAsJSON - writes the JSON out to a file
 func writeSigAsJSON(res *blscosi_bundle.SignatureResponse, outW io.Writer) error {
-	b, err := json.Marshal(sigHex{
+	return writeJSON(sigHex{
 		Hash:      hex.EncodeToString(res.Hash),
 		Signature: hex.EncodeToString(res.Signature)},
-	)
+		outW)
+}
 
+// writeJSON - writes the indented JSON of v out to a file
+func writeJSON(v interface{}, outW io.Writer) error {
+	b, err := json.Marshal(v)
 	if err != nil {
 		return fmt.Errorf("Couldn't encode signature: %s", err.Error())
 	}
@@ -112,9 +271,39 @@ func writeSigAsJSON(res *blscosi_bundle.SignatureResponse, outW io.Writer) error
 	return err
 }
 
-// sign takes a byte slice and a toml file defining the servers
-func sign(msg []byte, tomlFileName string) (*blscosi_bundle.SignatureResponse, error) {
-	log.Lvl2("Starting signature")
+// setupDKG runs the distributed key generation in the group and writes the
+// group public key
+func setupDKG(c *cli.Context) error {
+	roster, err := readRoster(c.String(optionGroup))
+	if err != nil {
+		return err
+	}
+
+	groupKey, err := check.SetupDKG(roster)
+	if err != nil {
+		return fmt.Errorf("Couldn't run the distributed key generation: %s", err.Error())
+	}
+
+	keyHex, err := encoding.PointToStringHex(cliSuite, groupKey)
+	if err != nil {
+		return err
+	}
+
+	outFileName := c.String("out")
+	if outFileName == "" {
+		fmt.Fprintln(c.App.Writer, keyHex)
+		return nil
+	}
+	err = ioutil.WriteFile(outFileName, []byte(keyHex+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("Couldn't write group key: %s", err.Error())
+	}
+	log.Lvlf2("Group key written to: %s", outFileName)
+	return nil
+}
+
+// readRoster reads the roster out of a toml file defining the servers
+func readRoster(tomlFileName string) (*onet.Roster, error) {
 	f, err := os.Open(tomlFileName)
 	if err != nil {
 		return nil, err
@@ -126,15 +315,235 @@ func sign(msg []byte, tomlFileName string) (*blscosi_bundle.SignatureResponse, e
 	if len(g.Roster.List) <= 0 {
 		return nil, fmt.Errorf("Empty or invalid blscosi group file: %s", tomlFileName)
 	}
+	return g.Roster, nil
+}
+
+// readGroupKey reads the hex encoded public key of a group
+func readGroupKey(keyFileName string) (kyber.Point, error) {
+	b, err := ioutil.ReadFile(keyFileName)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read group key: %s", err.Error())
+	}
+	return encoding.StringHexToPoint(cliSuite.G2(), strings.TrimSpace(string(b)))
+}
+
+// sign takes a byte slice and a toml file defining the servers. If the
+// servers have weights, the round completes with the weight threshold of the
+// group.
+func sign(msg []byte, tomlFileName string) (*blscosi_bundle.SignatureResponse, error) {
+	log.Lvl2("Starting signature")
+	roster, err := readRoster(tomlFileName)
+	if err != nil {
+		return nil, err
+	}
+	params, err := groupParams(tomlFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Lvl2("Sending signature to", roster)
+	return check.SignStatementWithParams(msg, roster, params)
+}
+
+// signContainer is sign with the signature wrapped in a container
+func signContainer(msg []byte, tomlFileName string) (*container.Container, error) {
+	roster, err := readRoster(tomlFileName)
+	if err != nil {
+		return nil, err
+	}
+	params, err := groupParams(tomlFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := check.SignStatementWithParams(msg, roster, params)
+	if err != nil {
+		return nil, err
+	}
+	return check.NewContainer(res, roster, params)
+}
+
+// groupParams returns the parameters of the rounds of the group, which
+// complete with the compound policy or the weights of its definition if it
+// has them.
+func groupParams(tomlFileName string) (protocol.Parameters, error) {
+	pol, err := check.ReadGroupPolicy(tomlFileName)
+	if err != nil {
+		return protocol.Parameters{}, err
+	}
+	if pol != nil {
+		params := protocol.DefaultParams()
+		params.Policy = pol
+		return params, nil
+	}
+
+	weights, threshold, err := check.ReadGroupWeights(tomlFileName)
+	if err != nil || weights == nil {
+		return protocol.Parameters{}, err
+	}
+	params := protocol.DefaultParams()
+	params.Weights = weights
+	params.WeightThreshold = threshold
+	return params, nil
+}
+
+// readPolicy returns the policy the signatures of the group of n nodes must
+// fulfill: the one of policyFile if it is given, or the one given by the
+// definition of the group.
+func readPolicy(tomlFileName, policyFile string, n int) (kyberSign.Policy, error) {
+	if policyFile != "" {
+		pol, err := check.ReadPolicyFile(policyFile)
+		if err != nil {
+			return nil, err
+		}
+		return pol, pol.Validate(n)
+	}
+	params, err := groupParams(tomlFileName)
+	if err != nil {
+		return nil, err
+	}
+	return params.SignPolicy(n, 0), nil
+}
+
+// signBatch takes the names and the content of several files and a toml file
+// defining the servers, and signs all the files in a single protocol run
+func signBatch(fileNames []string, msgs [][]byte, tomlFileName string) ([]sigHex, error) {
+	log.Lvl2("Starting batch signature")
+	roster, err := readRoster(tomlFileName)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Lvl2("Sending signature to", g.Roster)
-	return check.SignStatement(msg, g.Roster)
+	sigs, err := check.SignBatch(msgs, roster)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]sigHex, len(sigs))
+	for i, sig := range sigs {
+		proof := make([]merkleStepHex, len(sig.Proof))
+		for j, step := range sig.Proof {
+			proof[j] = merkleStepHex{hex.EncodeToString(step.Hash), step.Left}
+		}
+		res[i] = sigHex{
+			File:      fileNames[i],
+			Hash:      hex.EncodeToString(sig.Hash),
+			Signature: hex.EncodeToString(sig.Signature),
+			Root:      hex.EncodeToString(sig.Root),
+			Proof:     proof,
+		}
+	}
+	return res, nil
+}
+
+// readSigHex parses a signature file, which is either a single signature or
+// the list of signatures of a batch. In the latter case the signature with
+// the given hash is returned.
+func readSigHex(sigBytes []byte, hash []byte) (*sigHex, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(sigBytes), []byte("[")) {
+		sigStr := &sigHex{}
+		if err := json.Unmarshal(sigBytes, sigStr); err != nil {
+			return nil, err
+		}
+		return sigStr, nil
+	}
+
+	var sigStrs []sigHex
+	if err := json.Unmarshal(sigBytes, &sigStrs); err != nil {
+		return nil, err
+	}
+	hashHex := hex.EncodeToString(hash)
+	for i := range sigStrs {
+		if sigStrs[i].Hash == hashHex {
+			return &sigStrs[i], nil
+		}
+	}
+	return nil, errors.New("no signature of this file in the batch")
+}
+
+// decodeBatchSignature decodes the hex signature of a batch
+func decodeBatchSignature(sigStr *sigHex) (*blscosi_bundle.BatchSignature, error) {
+	var err error
+	sig := &blscosi_bundle.BatchSignature{Proof: make([]blscosi_bundle.MerkleStep, len(sigStr.Proof))}
+	if sig.Hash, err = hex.DecodeString(sigStr.Hash); err != nil {
+		return nil, err
+	}
+	if sig.Root, err = hex.DecodeString(sigStr.Root); err != nil {
+		return nil, err
+	}
+	if sig.Signature, err = hex.DecodeString(sigStr.Signature); err != nil {
+		return nil, err
+	}
+	for i, step := range sigStr.Proof {
+		sig.Proof[i].Left = step.Left
+		if sig.Proof[i].Hash, err = hex.DecodeString(step.Hash); err != nil {
+			return nil, err
+		}
+	}
+	return sig, nil
+}
+
+// signThreshold takes a byte slice, a toml file defining the servers and the
+// file of the group key, and requests a threshold signature
+func signThreshold(msg []byte, tomlFileName, keyFileName string) (*blscosi_bundle.ThresholdSignatureResponse, error) {
+	log.Lvl2("Starting threshold signature")
+	roster, err := readRoster(tomlFileName)
+	if err != nil {
+		return nil, err
+	}
+	groupKey, err := readGroupKey(keyFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return check.SignThresholdStatement(msg, roster, groupKey)
+}
+
+// readContainer parses a signature file holding a container, and returns nil
+// if it holds signatures of the legacy format
+func readContainer(sigBytes []byte) (*container.Container, error) {
+	var header struct{ Version uint8 }
+	if bytes.HasPrefix(bytes.TrimSpace(sigBytes), []byte("[")) ||
+		json.Unmarshal(sigBytes, &header) != nil || header.Version == 0 {
+		return nil, nil
+	}
+	c := &container.Container{}
+	if err := json.Unmarshal(sigBytes, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// verifyContainer checks the signature of a container over b. The policy of
+// policyFile applies, or else the one of the group, and the policy of the
+// container only in addition to it.
+func verifyContainer(b []byte, c *container.Container, groupToml, keyFileName, policyFile string) error {
+	if keyFileName != "" {
+		groupKey, err := readGroupKey(keyFileName)
+		if err != nil {
+			return err
+		}
+		return check.VerifyContainer(b, c, nil, groupKey, nil)
+	}
+
+	roster, err := readRoster(groupToml)
+	if err != nil {
+		return err
+	}
+	policy, err := readPolicy(groupToml, policyFile, len(roster.List))
+	if err != nil {
+		return err
+	}
+	log.Lvlf4("Verifying %s container %x %x", c.Scheme, b, c.Signature)
+	return check.VerifyContainer(b, c, roster, nil, policy)
 }
 
 // verify takes a file and a group-definition, calls the signature
 // verification and prints the result. If sigFileName is empty it
-// assumes to find the standard signature in fileName.sig
-func verify(fileName, sigFileName, groupToml string) error {
+// assumes to find the standard signature in fileName.sig. If keyFileName
+// is given, the signature is verified as a threshold signature. If
+// policyFile is given, the signers must fulfill its policy.
+func verify(fileName, sigFileName, groupToml, keyFileName, policyFile string) error {
 	// if the file hash matches the one in the signature
 	log.Lvl4("Reading file " + fileName)
 	b, err := ioutil.ReadFile(fileName)
@@ -142,22 +551,40 @@ func verify(fileName, sigFileName, groupToml string) error {
 		return errors.New("Couldn't open msgFile: " + err.Error())
 	}
 
-	// Read the JSON signature file
+	sigBytes, err := readSigFile(sigFileName)
+	if err != nil {
+		return err
+	}
+	return verifySignature(b, sigBytes, groupToml, keyFileName, policyFile)
+}
+
+// readSigFile reads the JSON signature file, or the standard input if
+// sigFileName is empty
+func readSigFile(sigFileName string) ([]byte, error) {
 	log.Lvl4("Reading signature")
-	var sigBytes []byte
 	if sigFileName == "" {
 		log.Print("[+] Reading signature from standard input ...")
-		sigBytes, err = ioutil.ReadAll(os.Stdin)
-	} else {
-		sigBytes, err = ioutil.ReadFile(sigFileName)
+		return ioutil.ReadAll(os.Stdin)
 	}
+	return ioutil.ReadFile(sigFileName)
+}
+
+// verifySignature checks the signature of b in the signature file sigBytes,
+// see verify.
+func verifySignature(b, sigBytes []byte, groupToml, keyFileName, policyFile string) error {
+	log.Lvl4("Unmarshalling signature ")
+	c, err := readContainer(sigBytes)
 	if err != nil {
 		return err
 	}
+	if c != nil {
+		return verifyContainer(b, c, groupToml, keyFileName, policyFile)
+	}
 
-	log.Lvl4("Unmarshalling signature ")
-	sigStr := &sigHex{}
-	if err = json.Unmarshal(sigBytes, sigStr); err != nil {
+	h := cliSuite.Hash()
+	h.Write(b)
+	sigStr, err := readSigHex(sigBytes, h.Sum(nil))
+	if err != nil {
 		return err
 	}
 
@@ -170,6 +597,19 @@ func verify(fileName, sigFileName, groupToml string) error {
 	if err != nil {
 		return err
 	}
+
+	if keyFileName != "" {
+		groupKey, err := readGroupKey(keyFileName)
+		if err != nil {
+			return err
+		}
+		log.Lvlf4("Verifying threshold signature %x %x", b, sig.Signature)
+		return check.VerifyThresholdSignatureHash(b, &blscosi_bundle.ThresholdSignatureResponse{
+			Hash:      sig.Hash,
+			Signature: sig.Signature,
+		}, groupKey)
+	}
+
 	fGroup, err := os.Open(groupToml)
 	if err != nil {
 		return err
@@ -181,6 +621,19 @@ func verify(fileName, sigFileName, groupToml string) error {
 		return err
 	}
 
+	if sigStr.Root != "" {
+		batchSig, err := decodeBatchSignature(sigStr)
+		if err != nil {
+			return err
+		}
+		log.Lvlf4("Verifying batch signature %x %x", b, batchSig.Signature)
+		return check.VerifyBatchSignatureHash(b, batchSig, g.Roster)
+	}
+
+	policy, err := readPolicy(groupToml, policyFile, len(g.Roster.List))
+	if err != nil {
+		return err
+	}
 	log.Lvlf4("Verifying signature %x %x", b, sig.Signature)
-	return check.VerifySignatureHash(b, sig, g.Roster)
+	return check.VerifySignatureHashWithPolicy(b, sig, g.Roster, policy)
 }
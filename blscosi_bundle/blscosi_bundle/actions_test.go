@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"testing"
 
+	"github.com/dedis/student_19_elias/blscosi_bundle/blscosi_bundle/check"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/onet/v4"
 	"go.dedis.ch/onet/v4/app"
+	"go.dedis.ch/onet/v4/network"
 )
 
 var testSuite = pairing.NewSuiteBn256()
@@ -35,6 +40,15 @@ func TestMain_Check(t *testing.T) {
 	require.NoError(t, err)
 	err = cliApp.Run([]string{"", "check", "-g", publicToml, "--detail"})
 	require.NoError(t, err)
+
+	var out bytes.Buffer
+	cliApp.Writer = &out
+	err = cliApp.Run([]string{"", "check", "-g", publicToml, "-p", "4", "--json"})
+	require.NoError(t, err)
+	report := &check.CheckReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.Len(t, report.Servers, 10)
+	require.Len(t, report.Rounds, 4)
 }
 
 // TestMain_Sign checks if the CLI commands sign and verify work correctly
@@ -85,3 +99,300 @@ func TestMain_Sign(t *testing.T) {
 	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-s", signatureFile, signatureFile})
 	require.Error(t, err)
 }
+
+// TestMain_SignContainer checks if a signature written as a container can be
+// verified, as well as the legacy signatures
+func TestMain_SignContainer(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	os.Chdir(tmp)
+
+	publicToml := path.Join(tmp, "public.toml")
+	signatureFile := path.Join(tmp, "sig.json")
+	otherToml := path.Join(tmp, "other.toml")
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(6, true)
+	group := &app.Group{Roster: onet.NewRoster(roster.List[:5])}
+	require.NoError(t, group.Save(testSuite, publicToml))
+	other := &app.Group{Roster: onet.NewRoster(roster.List[1:])}
+	require.NoError(t, other.Save(testSuite, otherToml))
+
+	cliApp := createApp()
+	require.NotNil(t, cliApp)
+
+	err := cliApp.Run([]string{"", "sign", "-g", publicToml, "--container", "-o", signatureFile, publicToml})
+	require.NoError(t, err)
+	sigBytes, err := ioutil.ReadFile(signatureFile)
+	require.NoError(t, err)
+	require.Contains(t, string(sigBytes), `"Scheme": "bdn"`)
+
+	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-s", signatureFile, publicToml})
+	require.NoError(t, err)
+
+	// the container gives the roster of the signature
+	err = cliApp.Run([]string{"", "verify", "-g", otherToml, "-s", signatureFile, publicToml})
+	require.Error(t, err)
+
+	// a batch is not written as a container
+	err = cliApp.Run([]string{"", "sign", "-g", publicToml, "--container", publicToml, otherToml})
+	require.Error(t, err)
+}
+
+// TestMain_Inspect checks if the CLI command inspect explains a signature
+func TestMain_Inspect(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	os.Chdir(tmp)
+
+	publicToml := path.Join(tmp, "public.toml")
+	signatureFile := path.Join(tmp, "sig.json")
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	hosts, roster, _ := local.GenTree(5, true)
+	group := &app.Group{Roster: roster, Description: map[*network.ServerIdentity]string{}}
+	for i, si := range roster.List {
+		group.Description[si] = fmt.Sprintf("node %d", i)
+	}
+	require.NoError(t, group.Save(testSuite, publicToml))
+
+	// the last node is down
+	hosts[4].Close()
+	cliApp := createApp()
+	err := cliApp.Run([]string{"", "sign", "-g", publicToml, "-o", signatureFile, publicToml})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	cliApp.Writer = &out
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-s", signatureFile, "--json", publicToml})
+	require.NoError(t, err)
+	report := &inspectReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.True(t, *report.FileMatches)
+	require.True(t, *report.Valid)
+	require.Equal(t, 4, report.Threshold)
+	require.Len(t, report.Signers, 4)
+	require.Equal(t, []inspectServer{{4, roster.List[4].Address.String(), "node 4"}}, report.Missing)
+
+	// another file
+	out.Reset()
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-s", signatureFile, signatureFile})
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "hash matches: false")
+	require.Contains(t, out.String(), "Signers:   4 of 5, threshold 4")
+	require.Contains(t, out.String(), "missing")
+
+	// the threshold is the one of the policy that applies
+	policyFile := path.Join(tmp, "policy.json")
+	require.NoError(t, ioutil.WriteFile(policyFile, []byte(`{"Threshold":5}`), 0644))
+	out.Reset()
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-s", signatureFile, "-p", policyFile, "--json"})
+	require.NoError(t, err)
+	report = &inspectReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.Equal(t, 5, report.Threshold)
+	require.False(t, report.PolicyFulfilled)
+}
+
+// TestMain_Bench checks if the CLI command bench reports the requests
+func TestMain_Bench(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	os.Chdir(tmp)
+
+	publicToml := path.Join(tmp, "public.toml")
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(5, true)
+	group := &app.Group{Roster: roster}
+	require.NoError(t, group.Save(testSuite, publicToml))
+
+	cliApp := createApp()
+	var out bytes.Buffer
+	cliApp.Writer = &out
+
+	err := cliApp.Run([]string{"", "bench", "-g", publicToml, "-n", "0"})
+	require.Error(t, err)
+
+	err = cliApp.Run([]string{"", "bench", "-g", publicToml, "-n", "6", "-c", "3", "-s", "64",
+		"--tick", "50ms", "--json"})
+	require.NoError(t, err)
+	report := &check.BenchReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.Equal(t, 6, report.Succeeded)
+	require.Equal(t, roster.List[0].Address.String(), report.Entry)
+	require.Equal(t, 1.0, report.SuccessRate)
+	require.Len(t, report.Results, 6)
+	require.True(t, report.MeanSigners >= 4)
+	require.True(t, report.Latency.Min <= report.Latency.P50)
+	require.True(t, report.Latency.P99 <= report.Latency.Max)
+
+	out.Reset()
+	err = cliApp.Run([]string{"", "bench", "-g", publicToml, "-n", "2"})
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "P50")
+
+	// empty messages still make distinct requests
+	out.Reset()
+	err = cliApp.Run([]string{"", "bench", "-g", publicToml, "-n", "3", "-s", "0", "-e", "latency", "--json"})
+	require.NoError(t, err)
+	report = &check.BenchReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.Equal(t, 3, report.Succeeded)
+	hashes := make(map[string]bool)
+	for _, res := range report.Results {
+		hashes[res.Hash] = true
+	}
+	require.Len(t, hashes, 3)
+
+	err = cliApp.Run([]string{"", "bench", "-g", publicToml, "-e", "nearest"})
+	require.Error(t, err)
+}
+
+// TestMain_Threshold checks if the CLI commands dkg, sign and verify work
+// correctly in the threshold mode
+func TestMain_Threshold(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	os.Chdir(tmp)
+
+	publicToml := path.Join(tmp, "public.toml")
+	keyFile := path.Join(tmp, "group.key")
+	signatureFile := path.Join(tmp, "sig.json")
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(5, true)
+	group := &app.Group{Roster: roster}
+	err := group.Save(testSuite, publicToml)
+	require.NoError(t, err)
+
+	cliApp := createApp()
+	require.NotNil(t, cliApp)
+
+	// no key yet
+	err = cliApp.Run([]string{"", "sign", "-g", publicToml, "-k", keyFile, publicToml})
+	require.Error(t, err)
+
+	err = cliApp.Run([]string{"", "dkg", "-g", publicToml, "-o", keyFile})
+	require.NoError(t, err)
+
+	err = cliApp.Run([]string{"", "sign", "-g", publicToml, "-k", keyFile, "-o", signatureFile, publicToml})
+	require.NoError(t, err)
+
+	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-k", keyFile, "-s", signatureFile, publicToml})
+	require.NoError(t, err)
+
+	// a threshold signature has no mask
+	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-s", signatureFile, publicToml})
+	require.Error(t, err)
+
+	// inspect checks it only with the key of the group
+	var out bytes.Buffer
+	cliApp.Writer = &out
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-k", keyFile, "-s", signatureFile, "--json", publicToml})
+	require.NoError(t, err)
+	report := &inspectReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.True(t, *report.Valid)
+	require.Empty(t, report.Error)
+
+	out.Reset()
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-s", signatureFile, "--json", publicToml})
+	require.NoError(t, err)
+	report = &inspectReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.Nil(t, report.Valid)
+
+	out.Reset()
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-s", signatureFile, publicToml})
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "valid: unchecked")
+
+	// not the signature of another file
+	out.Reset()
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-k", keyFile, "-s", signatureFile, "--json", signatureFile})
+	require.NoError(t, err)
+	report = &inspectReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.False(t, *report.Valid)
+}
+
+// TestMain_SignBatch checks if several files can be signed together and
+// verified one by one
+func TestMain_SignBatch(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	os.Chdir(tmp)
+
+	publicToml := path.Join(tmp, "public.toml")
+	otherFile := path.Join(tmp, "other.txt")
+	signatureFile := path.Join(tmp, "sig.json")
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(5, true)
+	group := &app.Group{Roster: roster}
+	err := group.Save(testSuite, publicToml)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(otherFile, []byte("other"), 0644)
+	require.NoError(t, err)
+
+	cliApp := createApp()
+	require.NotNil(t, cliApp)
+
+	err = cliApp.Run([]string{"", "sign", "-g", publicToml, "-o", signatureFile, publicToml, otherFile})
+	require.NoError(t, err)
+
+	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-s", signatureFile, publicToml})
+	require.NoError(t, err)
+	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-s", signatureFile, otherFile})
+	require.NoError(t, err)
+
+	// not part of the batch
+	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-s", signatureFile, signatureFile})
+	require.Error(t, err)
+}
+
+// TestMain_Fetch checks if the CLI command fetch gets back the signature of a
+// file from the servers
+func TestMain_Fetch(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	os.Chdir(tmp)
+
+	publicToml := path.Join(tmp, "public.toml")
+	signatureFile := path.Join(tmp, "sig.json")
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(5, true)
+	group := &app.Group{Roster: roster}
+	err := group.Save(testSuite, publicToml)
+	require.NoError(t, err)
+
+	cliApp := createApp()
+	require.NotNil(t, cliApp)
+
+	// not signed yet
+	err = cliApp.Run([]string{"", "fetch", "-g", publicToml, publicToml})
+	require.Error(t, err)
+
+	err = cliApp.Run([]string{"", "sign", "-g", publicToml, publicToml})
+	require.NoError(t, err)
+
+	err = cliApp.Run([]string{"", "fetch", "-g", publicToml, "-o", signatureFile, publicToml})
+	require.NoError(t, err)
+
+	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-s", signatureFile, publicToml})
+	require.NoError(t, err)
+}
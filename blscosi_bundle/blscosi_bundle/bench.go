@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle"
+	"github.com/dedis/student_19_elias/blscosi_bundle/blscosi_bundle/check"
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// benchGroup sends signature requests to the group and reports their
+// latency and their signers
+func benchGroup(c *cli.Context) error {
+	groupToml := c.String(optionGroup)
+	roster, err := readRoster(groupToml)
+	if err != nil {
+		return err
+	}
+	if c.Int("requests") < 1 {
+		return errors.New("Please give a positive number of requests")
+	}
+	strategy, err := blscosi_bundle.ParseEntryStrategy(c.String("entry"))
+	if err != nil {
+		return err
+	}
+
+	params, err := benchParams(c, groupToml)
+	if err != nil {
+		return err
+	}
+	report, err := check.Bench(roster, check.BenchConfig{
+		Requests:    c.Int("requests"),
+		Concurrency: c.Int("concurrency"),
+		MessageSize: c.Int("size"),
+		Strategy:    strategy,
+		Params:      params,
+		Timeout:     c.Duration("timeout"),
+	})
+	if err != nil {
+		return fmt.Errorf("Couldn't run the benchmark: %s", err.Error())
+	}
+
+	if c.Bool("json") {
+		return writeJSON(report, c.App.Writer)
+	}
+	return writeBenchTable(report, c.App.Writer)
+}
+
+// benchParams returns the parameters of the group with the strategy given by
+// the flags
+func benchParams(c *cli.Context, groupToml string) (protocol.Parameters, error) {
+	params, err := groupParams(groupToml)
+	if err != nil {
+		return params, err
+	}
+	if params.IsEmpty() {
+		params = protocol.DefaultParams()
+	}
+
+	if c.IsSet("tick") {
+		params.GossipTick = c.Duration("tick")
+	}
+	if c.IsSet("rumor-peers") {
+		params.RumorPeers = c.Int("rumor-peers")
+	}
+	if c.IsSet("shutdown-peers") {
+		params.ShutdownPeers = c.Int("shutdown-peers")
+	}
+	if c.IsSet("no-tree") {
+		params.TreeMode = false
+	}
+	if c.IsSet("leaderless") {
+		params.Leaderless = c.Bool("leaderless")
+	}
+	if c.IsSet("shutdown-tree") {
+		params.ShutdownTree = c.Bool("shutdown-tree")
+	}
+	if c.IsSet("adaptive") {
+		params.Adaptive = c.Bool("adaptive")
+	}
+	return params, nil
+}
+
+// writeBenchTable prints the report of a benchmark as tables
+func writeBenchTable(r *check.BenchReport, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Requests\t%d (concurrency %d, %d bytes)\n", r.Requests, r.Concurrency, r.MessageSize)
+	fmt.Fprintf(tw, "Succeeded\t%d (%.1f%%)\n", r.Succeeded, 100*r.SuccessRate)
+	fmt.Fprintf(tw, "Entry\t%s\n", r.Entry)
+	fmt.Fprintf(tw, "Duration\t%v\n", r.Duration)
+	fmt.Fprintf(tw, "Mean signers\t%.2f\n", r.MeanSigners)
+	fmt.Fprintln(tw, "\nMIN\tMEAN\tP50\tP90\tP99\tMAX")
+	l := r.Latency
+	fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", l.Min, l.Mean, l.P50, l.P90, l.P99, l.Max)
+
+	if len(r.Failures) > 0 {
+		fmt.Fprintln(tw, "\nREQUEST\tLATENCY\tFAILURE")
+		for i, res := range r.Results {
+			if res.Error != "" {
+				fmt.Fprintf(tw, "%d\t%v\t%s\n", i, res.Latency, res.Error)
+			}
+		}
+	}
+	return tw.Flush()
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 
+	"github.com/dedis/student_19_elias/blscosi_bundle/blscosi_bundle/check"
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/onet/v4/app"
 	"go.dedis.ch/onet/v4/cfgpath"
@@ -26,6 +27,14 @@ const (
 
 	optionConfig      = "config"
 	optionConfigShort = "c"
+
+	optionKey      = "key"
+	optionKeyShort = "k"
+
+	optionPolicy      = "policy"
+	optionPolicyShort = "p"
+
+	optionContainer = "container"
 )
 
 func main() {
@@ -67,14 +76,22 @@ func createApp() *cli.App {
 		{
 			Name:      "sign",
 			Aliases:   []string{"s"},
-			Usage:     "Request a collectively signature for a 'file'; signature is written to STDOUT by default",
-			ArgsUsage: "file",
+			Usage:     "Request a collectively signature for a 'file'; signature is written to STDOUT by default. Several files are signed together as a batch",
+			ArgsUsage: "file [file...]",
 			Action:    signFile,
 			Flags: append(clientFlags, []cli.Flag{
 				cli.StringFlag{
 					Name:  "out, o",
 					Usage: "Write signature to 'file.sig' instead of STDOUT",
 				},
+				cli.StringFlag{
+					Name:  optionKey + ", " + optionKeyShort,
+					Usage: "Request a threshold signature for the group public key in 'file.key'",
+				},
+				cli.BoolFlag{
+					Name:  optionContainer,
+					Usage: "Write the signature as a container describing the suite, the scheme, the roster and the policy",
+				},
 			}...),
 		},
 		{
@@ -88,6 +105,127 @@ func createApp() *cli.App {
 					Name:  "signature, s",
 					Usage: "Read signature from 'file.sig' instead of STDIN",
 				},
+				cli.StringFlag{
+					Name:  optionKey + ", " + optionKeyShort,
+					Usage: "Verify a threshold signature with the group public key in 'file.key'",
+				},
+				cli.StringFlag{
+					Name:  optionPolicy + ", " + optionPolicyShort,
+					Usage: "Verify that the signers fulfill the policy in 'file.json' instead of the one of the group",
+				},
+			}...),
+		},
+		{
+			Name:      "inspect",
+			Aliases:   []string{"i"},
+			Usage:     "Show which servers of the group produced a collective signature, and check it against 'file' if it is given; signature is read from STDIN by default",
+			ArgsUsage: "[file]",
+			Action:    inspectFile,
+			Flags: append(clientFlags, []cli.Flag{
+				cli.StringFlag{
+					Name:  "signature, s",
+					Usage: "Read signature from 'file.sig' instead of STDIN",
+				},
+				cli.StringFlag{
+					Name:  optionKey + ", " + optionKeyShort,
+					Usage: "Check a threshold signature with the group public key in 'file.key'",
+				},
+				cli.StringFlag{
+					Name:  optionPolicy + ", " + optionPolicyShort,
+					Usage: "Check the signers against the policy in 'file.json' instead of the one of the group",
+				},
+				cli.BoolFlag{
+					Name:  "json, j",
+					Usage: "Write the report as JSON",
+				},
+			}...),
+		},
+		{
+			Name:      "fetch",
+			Aliases:   []string{"f"},
+			Usage:     "Fetch the collective signature of a 'file' from the servers of the group; signature is written to STDOUT by default",
+			ArgsUsage: "file",
+			Action:    fetchFile,
+			Flags: append(clientFlags, []cli.Flag{
+				cli.StringFlag{
+					Name:  "out, o",
+					Usage: "Write signature to 'file.sig' instead of STDOUT",
+				},
+			}...),
+		},
+		{
+			Name:   "dkg",
+			Usage:  "Run a distributed key generation in the group; the group public key is written to STDOUT by default",
+			Action: setupDKG,
+			Flags: append(clientFlags, []cli.Flag{
+				cli.StringFlag{
+					Name:  "out, o",
+					Usage: "Write the group public key to 'file.key' instead of STDOUT",
+				},
+			}...),
+		},
+		{
+			Name:   "bench",
+			Usage:  "Send signature requests of random messages to the group and report their latency and their signers",
+			Action: benchGroup,
+			Flags: append(clientFlags, []cli.Flag{
+				cli.IntFlag{
+					Name:  "requests, n",
+					Value: 10,
+					Usage: "Number of signature requests",
+				},
+				cli.IntFlag{
+					Name:  "concurrency, c",
+					Value: 1,
+					Usage: "Number of requests sent at the same time",
+				},
+				cli.IntFlag{
+					Name:  "size, s",
+					Value: 1024,
+					Usage: "Size of the random messages in bytes, a nonce is added to each of them",
+				},
+				cli.StringFlag{
+					Name:  "entry, e",
+					Value: "first",
+					Usage: "Strategy choosing the entry node of the requests: first, random or latency",
+				},
+				cli.DurationFlag{
+					Name:  "timeout, t",
+					Value: check.RequestTimeOut,
+					Usage: "Time given to every request",
+				},
+				cli.DurationFlag{
+					Name:  "tick",
+					Usage: "Interval between the rumors of the nodes",
+				},
+				cli.IntFlag{
+					Name:  "rumor-peers",
+					Usage: "Number of peers a rumor is sent to",
+				},
+				cli.IntFlag{
+					Name:  "shutdown-peers",
+					Usage: "Number of peers the shutdown is sent to",
+				},
+				cli.BoolFlag{
+					Name:  "no-tree",
+					Usage: "Don't aggregate the responses wherever possible",
+				},
+				cli.BoolFlag{
+					Name:  "leaderless",
+					Usage: "Let any node reaching the threshold finalise",
+				},
+				cli.BoolFlag{
+					Name:  "shutdown-tree",
+					Usage: "Send the shutdown along a tree over the roster",
+				},
+				cli.BoolFlag{
+					Name:  "adaptive",
+					Usage: "Adapt the tick and the fanout to the progress of the rounds",
+				},
+				cli.BoolFlag{
+					Name:  "json, j",
+					Usage: "Write the report as JSON",
+				},
 			}...),
 		},
 		{
@@ -99,6 +237,15 @@ func createApp() *cli.App {
 				cli.BoolFlag{
 					Name:  "detail, l",
 					Usage: "Show details of all servers",
+				},
+				cli.IntFlag{
+					Name:  "parallel, p",
+					Value: 8,
+					Usage: "Number of checks run at the same time",
+				},
+				cli.BoolFlag{
+					Name:  "json, j",
+					Usage: "Write the report as JSON",
 				}),
 		},
 
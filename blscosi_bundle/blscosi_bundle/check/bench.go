@@ -0,0 +1,206 @@
+package check
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle"
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/onet/v4/network"
+)
+
+// benchNonceSize is the size of the random nonce that ends the message of
+// every request of a benchmark
+const benchNonceSize = 16
+
+// BenchConfig defines the load of a benchmark
+type BenchConfig struct {
+	Requests    int
+	Concurrency int
+	// MessageSize is the size of the random message of every request, which
+	// is followed by a nonce so that no two requests are the same and the
+	// nodes can't answer them with a signature they already have
+	MessageSize int
+	// Strategy selects the entry node that gets every request
+	Strategy blscosi_bundle.EntryStrategy
+	// Params are the parameters of the protocol, the default ones being
+	// used if they are empty
+	Params  protocol.Parameters
+	Timeout time.Duration
+}
+
+// BenchResult is the outcome of a request of a benchmark, Hash being the hash
+// of its message
+type BenchResult struct {
+	Hash    string
+	Latency time.Duration
+	Signers int
+	Error   string `json:",omitempty"`
+}
+
+// LatencyStats are the statistics of the latencies of the successful
+// requests
+type LatencyStats struct {
+	Min  time.Duration
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+// BenchReport is the outcome of a benchmark
+type BenchReport struct {
+	Requests    int
+	Concurrency int
+	MessageSize int
+	// Entry is the address of the node that got every request
+	Entry       string
+	Succeeded   int
+	SuccessRate float64
+	// Duration is the time taken by the whole benchmark
+	Duration    time.Duration
+	Latency     LatencyStats
+	MeanSigners float64
+	// Failures counts the failed requests by error
+	Failures map[string]int `json:",omitempty"`
+	Results  []BenchResult
+}
+
+// Bench sends cfg.Requests signature requests of random messages to the
+// roster, with at most cfg.Concurrency of them at the same time, and verifies
+// every signature. The requests all go to the entry node chosen by the
+// strategy, without failover, so that the latencies are the ones of the
+// signing rounds.
+func Bench(ro *onet.Roster, cfg BenchConfig) (*BenchReport, error) {
+	if cfg.MessageSize < 0 {
+		return nil, errors.New("negative message size")
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = RequestTimeOut
+	}
+
+	client := blscosi_bundle.NewClient()
+	client.Strategy = cfg.Strategy
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	entry, err := client.EntryNode(ctx, ro)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BenchReport{
+		Requests:    cfg.Requests,
+		Concurrency: cfg.Concurrency,
+		MessageSize: cfg.MessageSize,
+		Entry:       entry.Address.String(),
+		Results:     make([]BenchResult, cfg.Requests),
+	}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < cfg.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				report.Results[i] = benchRequest(entry, ro, cfg)
+			}
+		}()
+	}
+	for i := 0; i < cfg.Requests; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	report.Duration = time.Since(start)
+
+	report.summarize()
+	return report, nil
+}
+
+// benchRequest sends a single request of a benchmark to the entry node
+func benchRequest(entry *network.ServerIdentity, ro *onet.Roster, cfg BenchConfig) BenchResult {
+	client := blscosi_bundle.NewClient()
+	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
+
+	msg := make([]byte, cfg.MessageSize+benchNonceSize)
+	rand.Read(msg)
+	suite := client.Suite().(*pairing.SuiteBn256)
+	h := suite.Hash()
+	h.Write(msg)
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	start := time.Now()
+	response, err := client.SignatureRequestTo(ctx, entry, ro, msg, cfg.Params)
+	latency := time.Since(start)
+	if err != nil {
+		log.Lvl2("Bench request failed:", err)
+		return BenchResult{Hash: hash, Latency: latency, Error: err.Error()}
+	}
+
+	err = response.Signature.VerifyAggregateWithPolicy(suite, msg, publics, cfg.Params.SignPolicy(len(publics), 0))
+	if err != nil {
+		return BenchResult{Hash: hash, Latency: latency, Error: "invalid signature: " + err.Error()}
+	}
+	mask, err := response.Signature.GetMask(suite, publics)
+	if err != nil {
+		return BenchResult{Hash: hash, Latency: latency, Error: err.Error()}
+	}
+	return BenchResult{Hash: hash, Latency: latency, Signers: mask.CountEnabled()}
+}
+
+// summarize computes the statistics of the results
+func (r *BenchReport) summarize() {
+	var latencies []time.Duration
+	var total time.Duration
+	signers := 0
+	for _, res := range r.Results {
+		if res.Error != "" {
+			if r.Failures == nil {
+				r.Failures = make(map[string]int)
+			}
+			r.Failures[res.Error]++
+			continue
+		}
+		latencies = append(latencies, res.Latency)
+		total += res.Latency
+		signers += res.Signers
+	}
+
+	r.Succeeded = len(latencies)
+	if r.Requests > 0 {
+		r.SuccessRate = float64(r.Succeeded) / float64(r.Requests)
+	}
+	if r.Succeeded == 0 {
+		return
+	}
+	r.MeanSigners = float64(signers) / float64(r.Succeeded)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(math.Ceil(p*float64(len(latencies))))-1]
+	}
+	r.Latency = LatencyStats{
+		Min:  latencies[0],
+		Mean: total / time.Duration(len(latencies)),
+		P50:  percentile(0.5),
+		P90:  percentile(0.9),
+		P99:  percentile(0.99),
+		Max:  latencies[len(latencies)-1],
+	}
+}
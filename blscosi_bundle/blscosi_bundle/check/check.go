@@ -2,16 +2,30 @@ package check
 
 import (
 	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/dedis/student_19_elias/blscosi_bundle"
+	"github.com/dedis/student_19_elias/blscosi_bundle/container"
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	"github.com/dedis/student_19_elias/blscosi_bundle/verifier"
+	"github.com/dedis/student_19_elias/blscosi_bundle/verifier/grouptoml"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bls"
 	"go.dedis.ch/onet/v4"
 	"go.dedis.ch/onet/v4/app"
 	"go.dedis.ch/onet/v4/log"
@@ -22,153 +36,281 @@ import (
 // reply
 const RequestTimeOut = time.Second * 10
 
+// CheckConfig defines how a group is checked
+type CheckConfig struct {
+	// Detail checks every ordered pair of working servers
+	Detail bool
+	// Parallelism is the number of checks run at the same time
+	Parallelism int
+}
+
+// ServerStatus is the outcome of the check of a single server
+type ServerStatus struct {
+	Index       int
+	Address     string
+	Description string `json:",omitempty"`
+	Reachable   bool
+	Latency     time.Duration
+	Error       string `json:",omitempty"`
+}
+
+// RoundStatus is the outcome of a check of a roster, either of the working
+// servers or of a pair of them
+type RoundStatus struct {
+	// Servers are the indices of the servers of the roster, in its order
+	Servers []int
+	OK      bool
+	Signers int
+	Latency time.Duration
+	Error   string `json:",omitempty"`
+}
+
+// CheckReport is the outcome of the check of a group
+type CheckReport struct {
+	Servers []ServerStatus
+	// Rounds are the rounds over the working servers, in random orders
+	Rounds []RoundStatus
+	// Pairs is the matrix of the checks of the ordered pairs of working
+	// servers, by the indices of the servers. It is only given in detail.
+	Pairs    [][]*RoundStatus `json:",omitempty"`
+	Duration time.Duration
+}
+
+// Err returns the first failure of the report, or nil if every check passed
+func (r *CheckReport) Err() error {
+	for _, srv := range r.Servers {
+		if !srv.Reachable {
+			return fmt.Errorf("server %s: %s", srv.Address, srv.Error)
+		}
+	}
+	for _, round := range r.Rounds {
+		if !round.OK {
+			return fmt.Errorf("roster of %d servers: %s", len(round.Servers), round.Error)
+		}
+	}
+	for _, row := range r.Pairs {
+		for _, pair := range row {
+			if pair != nil && !pair.OK {
+				return fmt.Errorf("pair %v: %s", pair.Servers, pair.Error)
+			}
+		}
+	}
+	return nil
+}
+
 // CothorityCheck contacts all servers in the entity-list and then makes checks
 // on each pair. If server-descriptions are available, it will print them
 // along with the IP-address of the server.
 // In case a server doesn't reply in time or there is an error in the
 // signature, an error is returned.
 func CothorityCheck(tomlFileName string, detail bool) error {
+	report, err := CheckGroupFile(tomlFileName, CheckConfig{Detail: detail, Parallelism: 1})
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// CheckGroupFile checks the group defined in the file, see CheckGroup
+func CheckGroupFile(tomlFileName string, cfg CheckConfig) (*CheckReport, error) {
 	f, err := os.Open(tomlFileName)
 	if err != nil {
-		return fmt.Errorf("Couldn't open group definition file: %s", err.Error())
+		return nil, fmt.Errorf("Couldn't open group definition file: %s", err.Error())
 	}
+	defer f.Close()
 
 	group, err := app.ReadGroupDescToml(f)
 	if err != nil {
-		return fmt.Errorf("Error while reading group definition file: %s", err.Error())
+		return nil, fmt.Errorf("Error while reading group definition file: %s", err.Error())
 	}
 
 	if group.Roster == nil || len(group.Roster.List) == 0 {
-		return fmt.Errorf("Empty roster or invalid group defintion in: %s", tomlFileName)
+		return nil, fmt.Errorf("Empty roster or invalid group defintion in: %s", tomlFileName)
 	}
+	return CheckGroup(group, cfg), nil
+}
 
+// CheckGroup contacts all the servers of the group, then runs the roster of
+// the working ones sqrt(n) times in random orders, then every ordered pair of
+// working servers if cfg.Detail is set. Up to cfg.Parallelism checks run at
+// the same time.
+func CheckGroup(group *app.Group, cfg CheckConfig) *CheckReport {
+	if cfg.Parallelism < 1 {
+		cfg.Parallelism = 1
+	}
 	log.Lvlf3("Checking roster %v", group.Roster.List)
-	var checkErr error
-	// First check all servers individually and write the working servers
-	// in a list
-	working := []*network.ServerIdentity{}
-	for _, e := range group.Roster.List {
-		desc := []string{"none", "none"}
-		if d := group.GetDescription(e); d != "" {
-			desc = []string{d, d}
+	rand.Seed(int64(time.Now().Nanosecond()))
+	start := time.Now()
+	sem := make(chan struct{}, cfg.Parallelism)
+	var wg sync.WaitGroup
+	run := func(check func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			check()
+		}()
+	}
+	describe := func(indices []int) []string {
+		descs := make([]string, len(indices))
+		for i, idx := range indices {
+			descs[i] = group.GetDescription(group.Roster.List[idx])
 		}
-		ro := onet.NewRoster([]*network.ServerIdentity{e})
-		err := checkRoster(ro, desc, true)
-		if err == nil {
-			working = append(working, e)
-		} else {
-			checkErr = err
+		return descs
+	}
+
+	// First check all servers individually
+	report := &CheckReport{Servers: make([]ServerStatus, len(group.Roster.List))}
+	for i, si := range group.Roster.List {
+		i, si := i, si
+		report.Servers[i] = ServerStatus{Index: i, Address: si.Address.String(), Description: group.GetDescription(si)}
+		run(func() {
+			round := checkRoster(group.Roster, []int{i}, describe([]int{i}), true)
+			srv := &report.Servers[i]
+			srv.Reachable, srv.Latency, srv.Error = round.OK, round.Latency, round.Error
+		})
+	}
+	wg.Wait()
+
+	working := []int{}
+	for _, srv := range report.Servers {
+		if srv.Reachable {
+			working = append(working, srv.Index)
 		}
 	}
 
 	wn := len(working)
 	if wn > 1 {
 		// Check one big roster sqrt(len(working)) times.
-		descriptions := make([]string, wn)
-		rand.Seed(int64(time.Now().Nanosecond()))
-		for j := 0; j <= int(math.Sqrt(float64(wn))); j++ {
-			permutation := rand.Perm(wn)
-			for i, si := range working {
-				descriptions[permutation[i]] = group.GetDescription(si)
-			}
-			err = checkRoster(onet.NewRoster(working), descriptions, detail)
-			if err != nil {
-				checkErr = err
+		report.Rounds = make([]RoundStatus, int(math.Sqrt(float64(wn)))+1)
+		for j := range report.Rounds {
+			j := j
+			indices := make([]int, wn)
+			for i, p := range rand.Perm(wn) {
+				indices[i] = working[p]
 			}
+			run(func() {
+				report.Rounds[j] = checkRoster(group.Roster, indices, describe(indices), cfg.Detail)
+			})
 		}
 
 		// Then check pairs of servers if we want to have detail
-		if detail {
-			for i, first := range working {
-				for _, second := range working[i+1:] {
-					log.Lvl3("Testing connection between", first, second)
-					desc := []string{"none", "none"}
-					if d1 := group.GetDescription(first); d1 != "" {
-						desc = []string{d1, group.GetDescription(second)}
-					}
-					es := []*network.ServerIdentity{first, second}
-					err = checkRoster(onet.NewRoster(es), desc, detail)
-					if err != nil {
-						checkErr = err
-					}
-					es[0], es[1] = es[1], es[0]
-					desc[0], desc[1] = desc[1], desc[0]
-					err = checkRoster(onet.NewRoster(es), desc, detail)
-					if err != nil {
-						checkErr = err
+		if cfg.Detail {
+			report.Pairs = make([][]*RoundStatus, len(group.Roster.List))
+			for i := range report.Pairs {
+				report.Pairs[i] = make([]*RoundStatus, len(group.Roster.List))
+			}
+			for _, first := range working {
+				for _, second := range working {
+					if first == second {
+						continue
 					}
+					indices := []int{first, second}
+					log.Lvl3("Testing connection between", group.Roster.List[first], group.Roster.List[second])
+					run(func() {
+						round := checkRoster(group.Roster, indices, describe(indices), cfg.Detail)
+						report.Pairs[indices[0]][indices[1]] = &round
+					})
 				}
 			}
 		}
+		wg.Wait()
 	}
-	return checkErr
+	report.Duration = time.Since(start)
+	return report
 }
 
-// checkList sends a message to the cothority defined by list and
-// waits for the reply.
-// If the reply doesn't arrive in time, it will return an
-// error.
-func checkRoster(ro *onet.Roster, descs []string, detail bool) error {
+// checkRoster sends a message to the servers of the roster at the given
+// indices and waits for the reply.
+// If the reply doesn't arrive in time, the round fails.
+func checkRoster(roster *onet.Roster, indices []int, descs []string, detail bool) RoundStatus {
+	list := make([]*network.ServerIdentity, len(indices))
 	serverStr := ""
-	for i, s := range ro.List {
-		name := strings.Split(descs[i], " ")[0]
+	for i, idx := range indices {
+		list[i] = roster.List[idx]
+		name := "none"
+		if descs[i] != "" {
+			name = strings.Split(descs[i], " ")[0]
+		}
 		if detail {
-			serverStr += s.Address.NetworkAddress() + "_"
+			serverStr += list[i].Address.NetworkAddress() + "_"
 		}
 		serverStr += name + " "
 	}
+	ro := onet.NewRoster(list)
 	log.Lvl3("Sending message to: " + serverStr)
 	log.Lvlf3("Checking %d server(s) %s: ", len(ro.List), serverStr)
-	msg := []byte("verification")
+
+	// a fresh message keeps the checks from being merged with one another
+	nonce := make([]byte, 8)
+	crand.Read(nonce)
+	msg := []byte(fmt.Sprintf("verification %x", nonce))
+	round := RoundStatus{Servers: indices}
+	start := time.Now()
 	sig, err := SignStatement(msg, ro)
-	if err != nil {
-		return err
+	round.Latency = time.Since(start)
+	if err == nil {
+		err = VerifySignatureHash(msg, sig, ro)
+		if err != nil {
+			err = fmt.Errorf("Invalid signature: %s", err.Error())
+		}
 	}
-	err = VerifySignatureHash(msg, sig, ro)
 	if err != nil {
-		return fmt.Errorf("Invalid signature: %s", err.Error())
+		log.Lvlf2("Checking %s failed: %s", serverStr, err)
+		round.Error = err.Error()
+		return round
 	}
 
-	return nil
+	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
+	mask, err := sig.Signature.GetMask(suite, ro.ServicePublics(blscosi_bundle.ServiceName))
+	if err != nil {
+		round.Error = err.Error()
+		return round
+	}
+	round.OK, round.Signers = true, mask.CountEnabled()
+	return round
 }
 
 // SignStatement can be used to sign the contents passed in the io.Reader
 func SignStatement(msg []byte, ro *onet.Roster) (*blscosi_bundle.SignatureResponse, error) {
+	return SignStatementWithParams(msg, ro, protocol.Parameters{})
+}
+
+// SignStatementWithParams signs msg with the given parameters of the
+// protocol, and verifies the signature with the policy they define
+func SignStatementWithParams(msg []byte, ro *onet.Roster, params protocol.Parameters) (*blscosi_bundle.SignatureResponse, error) {
 	client := blscosi_bundle.NewClient()
 	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
 
 	log.Lvlf4("Signing message %x", msg)
 
-	pchan := make(chan *blscosi_bundle.SignatureResponse, 1)
-	echan := make(chan error, 1)
-	go func() {
-		log.Lvl3("Waiting for the response on SignRequest")
-		response, err := client.SignatureRequest(ro, msg[:])
-		if err != nil {
-			echan <- err
-			return
-		}
-		pchan <- response
-	}()
-
-	select {
-	case err := <-echan:
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeOut)
+	defer cancel()
+	log.Lvl3("Waiting for the response on SignRequest")
+	response, err := client.SignatureRequestWithParams(ctx, ro, msg[:], params)
+	if err != nil {
 		return nil, err
-	case response := <-pchan:
-		log.Lvlf5("Response: %x", response.Signature)
+	}
+	log.Lvlf5("Response: %x", response.Signature)
 
-		err := response.Signature.VerifyAggregate(client.Suite().(*pairing.SuiteBn256), msg[:], publics)
-		if err != nil {
-			return nil, err
-		}
-		return response, nil
-	case <-time.After(RequestTimeOut):
-		return nil, errors.New("timeout on signing request")
+	err = response.Signature.VerifyAggregateWithPolicy(client.Suite().(*pairing.SuiteBn256), msg[:], publics,
+		params.SignPolicy(len(publics), 0))
+	if err != nil {
+		return nil, err
 	}
+	return response, nil
 }
 
 // VerifySignatureHash checks that the signature is correct
 func VerifySignatureHash(b []byte, sig *blscosi_bundle.SignatureResponse, ro *onet.Roster) error {
+	return VerifySignatureHashWithPolicy(b, sig, ro, sign.NewThresholdPolicy(protocol.DefaultThreshold(len(ro.List))))
+}
+
+// VerifySignatureHashWithPolicy checks that the signature is correct and
+// that its signers fulfill the policy
+func VerifySignatureHashWithPolicy(b []byte, sig *blscosi_bundle.SignatureResponse, ro *onet.Roster,
+	policy sign.Policy) error {
 	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
 	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
 
@@ -185,7 +327,242 @@ func VerifySignatureHash(b []byte, sig *blscosi_bundle.SignatureResponse, ro *on
 			"doesn't match with the hash of the file.)")
 	}
 
-	if err := sig.Signature.VerifyAggregate(suite, b, publics); err != nil {
+	if err := sig.Signature.VerifyAggregateWithPolicy(suite, b, publics, policy); err != nil {
+		return errors.New("Invalid sig:" + err.Error())
+	}
+	return nil
+}
+
+// SetupDKG runs the distributed key generation on the roster and returns the
+// public key of the group
+func SetupDKG(ro *onet.Roster) (kyber.Point, error) {
+	client := blscosi_bundle.NewClient()
+	reply, err := client.SetupDKG(context.Background(), ro)
+	if err != nil {
+		return nil, err
+	}
+	return reply.GroupKey, nil
+}
+
+// SignThresholdStatement requests a threshold signature of msg and verifies
+// it against the group key
+func SignThresholdStatement(msg []byte, ro *onet.Roster, groupKey kyber.Point) (*blscosi_bundle.ThresholdSignatureResponse, error) {
+	client := blscosi_bundle.NewClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeOut)
+	defer cancel()
+	response, err := client.ThresholdSignatureRequest(ctx, ro, msg[:])
+	if err != nil {
+		return nil, err
+	}
+
+	suite := client.Suite().(*pairing.SuiteBn256)
+	if err := bls.Verify(suite, groupKey, msg, response.Signature); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// VerifyThresholdSignatureHash checks that the threshold signature is correct
+// using only the public key of the group
+func VerifyThresholdSignatureHash(b []byte, sig *blscosi_bundle.ThresholdSignatureResponse, groupKey kyber.Point) error {
+	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
+
+	h := suite.Hash()
+	_, err := h.Write(b)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h.Sum(nil), sig.Hash) {
+		return errors.New("You are trying to verify a signature " +
+			"belonging to another file. (The hash provided by the signature " +
+			"doesn't match with the hash of the file.)")
+	}
+
+	if err := bls.Verify(suite, groupKey, b, sig.Signature); err != nil {
+		return errors.New("Invalid sig:" + err.Error())
+	}
+	return nil
+}
+
+// SignBatch requests the signature of all the messages in a single protocol
+// run and verifies the signature of each of them
+func SignBatch(msgs [][]byte, ro *onet.Roster) ([]blscosi_bundle.BatchSignature, error) {
+	client := blscosi_bundle.NewClient()
+	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeOut)
+	defer cancel()
+	response, err := client.BatchSignatureRequest(ctx, ro, msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response.Signatures) != len(msgs) {
+		return nil, fmt.Errorf("got %d signatures for %d messages", len(response.Signatures), len(msgs))
+	}
+	suite := client.Suite().(*pairing.SuiteBn256)
+	for i, sig := range response.Signatures {
+		if err := sig.Verify(suite, msgs[i], publics); err != nil {
+			return nil, err
+		}
+	}
+	return response.Signatures, nil
+}
+
+// VerifyBatchSignatureHash checks that the message is part of a batch that
+// has a correct signature
+func VerifyBatchSignatureHash(b []byte, sig *blscosi_bundle.BatchSignature, ro *onet.Roster) error {
+	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
+	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
+
+	if err := sig.Verify(suite, b, publics); err != nil {
+		return errors.New("Invalid sig:" + err.Error())
+	}
+	return nil
+}
+
+// FetchSignature gets the signature of msg from any node of the roster and
+// verifies it, unless it is a threshold signature, which needs the group key
+func FetchSignature(msg []byte, ro *onet.Roster) (*blscosi_bundle.SignatureRecord, error) {
+	client := blscosi_bundle.NewClient()
+	suite := client.Suite().(*pairing.SuiteBn256)
+	publics := ro.ServicePublics(blscosi_bundle.ServiceName)
+
+	h := suite.Hash()
+	h.Write(msg)
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeOut)
+	defer cancel()
+	reply, err := client.LookupSignature(ctx, ro, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Records) == 0 {
+		return nil, errors.New("no signature for this message")
+	}
+
+	rec := &reply.Records[0]
+	switch rec.Strategy {
+	case blscosi_bundle.StrategyThreshold:
+		return rec, nil
+	case blscosi_bundle.StrategyBatch:
+		batchSig := &blscosi_bundle.BatchSignature{
+			Hash:      rec.Hash,
+			Root:      rec.Root,
+			Proof:     rec.Proof,
+			Signature: rec.Signature,
+		}
+		err = batchSig.Verify(suite, msg, publics)
+	default:
+		err = rec.Signature.VerifyAggregate(suite, msg, publics)
+	}
+	if err != nil {
+		return nil, errors.New("Invalid sig:" + err.Error())
+	}
+	return rec, nil
+}
+
+// ReadGroupWeights reads the weights of the servers of a group definition and
+// the weight threshold, which is the default one if it is not given. A server
+// without weight counts for one. The weights are nil if no server has one.
+func ReadGroupWeights(tomlFileName string) ([]int, int, error) {
+	g, err := readGroup(tomlFileName)
+	if err != nil {
+		return nil, 0, err
+	}
+	return g.Weights(), g.WeightThreshold, nil
+}
+
+// ReadGroupPolicy reads the compound policy of a group definition, which is
+// nil if it has none.
+func ReadGroupPolicy(tomlFileName string) (*protocol.Policy, error) {
+	g, err := readGroup(tomlFileName)
+	if err != nil {
+		return nil, err
+	}
+	return g.Policy, nil
+}
+
+// readGroup reads a group definition with the keys of the service
+func readGroup(tomlFileName string) (*verifier.Group, error) {
+	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
+	return grouptoml.ReadFile(suite, tomlFileName, blscosi_bundle.ServiceName)
+}
+
+// ReadPolicyFile reads a compound policy from a JSON file, or from a TOML
+// file if its extension is .toml
+func ReadPolicyFile(fileName string) (*protocol.Policy, error) {
+	pol := &protocol.Policy{}
+	if filepath.Ext(fileName) == ".toml" {
+		if _, err := toml.DecodeFile(fileName, pol); err != nil {
+			return nil, err
+		}
+		return pol, nil
+	}
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, pol); err != nil {
+		return nil, fmt.Errorf("Couldn't decode policy: %s", err.Error())
+	}
+	return pol, nil
+}
+
+// NewContainer wraps the signature of a response in a container that gives
+// the roster and the policy of the round with the given parameters
+func NewContainer(res *blscosi_bundle.SignatureResponse, ro *onet.Roster, params protocol.Parameters) (*container.Container, error) {
+	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
+	c, err := res.Signature.Container(suite)
+	if err != nil {
+		return nil, err
+	}
+	c.Hash = res.Hash
+	if c.RosterHash, err = container.RosterHash(ro.ServicePublics(blscosi_bundle.ServiceName)); err != nil {
+		return nil, err
+	}
+
+	var pol *protocol.Policy
+	switch {
+	case params.Policy != nil:
+		pol = params.Policy
+	case params.WeightThreshold > 0:
+		pol = &protocol.Policy{Weights: params.Weights, WeightThreshold: params.WeightThreshold}
+	}
+	if pol != nil {
+		if c.Policy, err = json.Marshal(pol); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// NewThresholdContainer wraps a threshold signature in a container
+func NewThresholdContainer(res *blscosi_bundle.ThresholdSignatureResponse) *container.Container {
+	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
+	c := container.New(suite, container.SchemeThreshold, res.Signature, nil)
+	c.Hash = res.Hash
+	return c
+}
+
+// VerifyContainer checks the signature of a container over b. The signers
+// must fulfill the given policy, or the default threshold if it is nil, and
+// the policy of the container, see verifier.VerifyContainer. A threshold
+// signature is verified with the group key and the roster is not used.
+func VerifyContainer(b []byte, c *container.Container, ro *onet.Roster, groupKey kyber.Point, policy sign.Policy) error {
+	suite := blscosi_bundle.NewClient().Suite().(*pairing.SuiteBn256)
+	var publics []kyber.Point
+	if c.Scheme == container.SchemeThreshold {
+		if groupKey == nil {
+			return errors.New("a threshold signature needs the group key")
+		}
+		publics = []kyber.Point{groupKey}
+	} else {
+		publics = ro.ServicePublics(blscosi_bundle.ServiceName)
+	}
+	if _, err := verifier.VerifyContainer(suite, publics, b, c, policy); err != nil {
 		return errors.New("Invalid sig:" + err.Error())
 	}
 	return nil
@@ -6,6 +6,8 @@ import (
 	"path"
 	"testing"
 
+	"github.com/dedis/student_19_elias/blscosi_bundle"
+	"github.com/dedis/student_19_elias/blscosi_bundle/verifier/grouptoml"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/onet/v4"
@@ -58,3 +60,66 @@ func TestCheck(t *testing.T) {
 	err = CothorityCheck(publicToml, false)
 	require.Error(t, err)
 }
+
+// TestReadGroup checks that the verifier reads the keys of the service in the
+// group definitions
+func TestReadGroup(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(3, true)
+
+	publicToml := path.Join(tmp, "public.toml")
+	group := &app.Group{Roster: roster}
+	require.NoError(t, group.Save(testSuite, publicToml))
+
+	require.Equal(t, blscosi_bundle.ServiceName, grouptoml.ServiceName)
+	g, err := readGroup(publicToml)
+	require.NoError(t, err)
+	publics := roster.ServicePublics(blscosi_bundle.ServiceName)
+	for i, pub := range g.Publics() {
+		require.True(t, pub.Equal(publics[i]))
+	}
+	weights, _, err := ReadGroupWeights(publicToml)
+	require.NoError(t, err)
+	require.Nil(t, weights)
+}
+
+// TestCheckGroup checks the report of a parallel check
+func TestCheckGroup(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	hosts, roster, _ := local.GenTree(5, true)
+	group := &app.Group{Roster: roster}
+
+	report := CheckGroup(group, CheckConfig{Detail: true, Parallelism: 4})
+	require.NoError(t, report.Err())
+	require.Len(t, report.Servers, 5)
+	require.Len(t, report.Rounds, 3)
+	for _, round := range report.Rounds {
+		require.Equal(t, 5, round.Signers)
+	}
+	for i, row := range report.Pairs {
+		for j, pair := range row {
+			require.Equal(t, i == j, pair == nil)
+			if pair != nil {
+				require.True(t, pair.OK)
+				require.Equal(t, []int{i, j}, pair.Servers)
+			}
+		}
+	}
+
+	// the failed server is left out of the rounds
+	hosts[2].Close()
+	report = CheckGroup(group, CheckConfig{Parallelism: 4})
+	require.Error(t, report.Err())
+	require.False(t, report.Servers[2].Reachable)
+	require.NotEmpty(t, report.Servers[2].Error)
+	require.Nil(t, report.Pairs)
+	for _, round := range report.Rounds {
+		require.True(t, round.OK)
+		require.NotContains(t, round.Servers, 2)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle"
+	"github.com/dedis/student_19_elias/blscosi_bundle/container"
+	"github.com/dedis/student_19_elias/blscosi_bundle/verifier"
+	"github.com/dedis/student_19_elias/blscosi_bundle/verifier/grouptoml"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// inspectServer is a server of the group in the report of inspect
+type inspectServer struct {
+	Index       int
+	Address     string
+	Description string `json:",omitempty"`
+}
+
+// inspectReport explains a signature against a group definition
+type inspectReport struct {
+	Scheme string
+	Hash   string
+	Batch  bool `json:",omitempty"`
+	// FileMatches and Valid are only given when the file of the signature is
+	// given, and Valid only with the key of the group for a threshold
+	// signature
+	FileMatches *bool  `json:",omitempty"`
+	Valid       *bool  `json:",omitempty"`
+	Error       string `json:",omitempty"`
+	// The signers are unknown for a threshold signature
+	Servers int
+	Signers []inspectServer
+	Missing []inspectServer
+	// Threshold, Weight and WeightThreshold are the ones of the policy that
+	// applies, Threshold is zero if it doesn't count the signers
+	Threshold       int
+	Weight          int `json:",omitempty"`
+	WeightThreshold int `json:",omitempty"`
+	// PolicyFulfilled tells if the signers fulfill the policy of the group,
+	// or the one given instead, and the policy of the signature if it has
+	// one
+	PolicyFulfilled bool
+}
+
+// inspectFile explains which servers of the group produced a signature, and
+// whether the signature is the one of the file if it is given
+func inspectFile(c *cli.Context) error {
+	sigBytes, err := readSigFile(c.String("signature"))
+	if err != nil {
+		return err
+	}
+	var msg []byte
+	if fileName := c.Args().First(); fileName != "" {
+		if msg, err = ioutil.ReadFile(fileName); err != nil {
+			return errors.New("Couldn't read file:" + err.Error())
+		}
+	}
+
+	report, err := inspect(msg, sigBytes, c.String(optionGroup), c.String(optionKey), c.String(optionPolicy))
+	if err != nil {
+		return fmt.Errorf("Couldn't inspect signature: %s", err.Error())
+	}
+	if c.Bool("json") {
+		return writeJSON(report, c.App.Writer)
+	}
+	return report.write(c.App.Writer)
+}
+
+// inspect decodes the signature file sigBytes against the group definition
+// and the policy of policyFile, or of the group if it is empty. If msg is not
+// nil, the signature is also verified over it, with the group key of keyFile
+// for a threshold signature.
+func inspect(msg, sigBytes []byte, groupToml, keyFile, policyFile string) (*inspectReport, error) {
+	g, err := grouptoml.ReadFile(cliSuite, groupToml, blscosi_bundle.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgHash []byte
+	if msg != nil {
+		h := cliSuite.Hash()
+		h.Write(msg)
+		msgHash = h.Sum(nil)
+	}
+
+	report := &inspectReport{Servers: len(g.Servers)}
+	cont, err := readContainer(sigBytes)
+	if err != nil {
+		return nil, err
+	}
+	if cont == nil {
+		sigStr, err := readSigHex(sigBytes, msgHash)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := hex.DecodeString(sigStr.Signature)
+		if err != nil {
+			return nil, err
+		}
+		if cont, err = container.Parse(cliSuite, raw); err != nil {
+			return nil, err
+		}
+		if cont.Hash, err = hex.DecodeString(sigStr.Hash); err != nil {
+			return nil, err
+		}
+		report.Batch = sigStr.Root != ""
+	}
+	report.Scheme = cont.Scheme.String()
+	report.Hash = hex.EncodeToString(cont.Hash)
+
+	if msg != nil {
+		matches := bytes.Equal(msgHash, cont.Hash)
+		report.FileMatches = &matches
+		var err error
+		switch {
+		case cont.Scheme != container.SchemeThreshold:
+			err = verifySignature(msg, sigBytes, groupToml, "", policyFile)
+		case keyFile != "":
+			var groupKey kyber.Point
+			if groupKey, err = readGroupKey(keyFile); err != nil {
+				return nil, err
+			}
+			_, err = cont.Verify(cliSuite, msg, []kyber.Point{groupKey}, nil)
+		}
+		// a threshold signature without the key of the group is unchecked
+		if cont.Scheme != container.SchemeThreshold || keyFile != "" {
+			valid := err == nil
+			report.Valid = &valid
+			if err != nil {
+				report.Error = err.Error()
+			}
+		}
+	}
+	if cont.Scheme == container.SchemeThreshold {
+		return report, nil
+	}
+
+	mask, err := sign.NewMask(cliSuite, g.Publics(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := mask.SetMask(cont.Mask); err != nil {
+		return nil, fmt.Errorf("the mask doesn't match the group: %s", err.Error())
+	}
+	for i, srv := range g.Servers {
+		s := inspectServer{Index: i, Address: srv.Address, Description: srv.Description}
+		if enabled, _ := mask.IndexEnabled(i); enabled {
+			report.Signers = append(report.Signers, s)
+		} else {
+			report.Missing = append(report.Missing, s)
+		}
+	}
+
+	policy, err := readPolicy(groupToml, policyFile, len(g.Servers))
+	if err != nil {
+		return nil, err
+	}
+	switch pol := policy.(type) {
+	case *verifier.Policy:
+		report.Threshold = pol.Threshold
+		if pol.WeightThreshold > 0 {
+			report.WeightThreshold = pol.WeightThreshold
+			report.Weight = verifier.NewWeightedPolicy(pol.Weights, pol.WeightThreshold).Weight(cont.Mask)
+		}
+	case *verifier.WeightedPolicy:
+		report.WeightThreshold = pol.Threshold()
+		report.Weight = pol.Weight(cont.Mask)
+	default:
+		report.Threshold = verifier.DefaultThreshold(len(g.Servers))
+	}
+	extra, err := verifier.ContainerPolicy(cont, len(g.Servers))
+	if err != nil {
+		return nil, err
+	}
+	report.PolicyFulfilled = policy.Check(mask) && (extra == nil || extra.Check(mask))
+	return report, nil
+}
+
+// write prints the report in a human-readable form
+func (r *inspectReport) write(w io.Writer) error {
+	fmt.Fprintf(w, "Scheme:    %s\n", r.Scheme)
+	fmt.Fprintf(w, "Hash:      %s\n", r.Hash)
+	if r.FileMatches != nil {
+		valid := "unchecked"
+		if r.Valid != nil {
+			valid = fmt.Sprint(*r.Valid)
+		}
+		fmt.Fprintf(w, "File:      hash matches: %v, valid: %s\n", *r.FileMatches, valid)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(w, "Error:     %s\n", r.Error)
+	}
+	if r.Scheme == container.SchemeThreshold.String() {
+		fmt.Fprintln(w, "Signers:   unknown for a threshold signature")
+		return nil
+	}
+
+	if r.Threshold > 0 {
+		fmt.Fprintf(w, "Signers:   %d of %d, threshold %d\n", len(r.Signers), r.Servers, r.Threshold)
+	} else {
+		fmt.Fprintf(w, "Signers:   %d of %d\n", len(r.Signers), r.Servers)
+	}
+	if r.WeightThreshold > 0 {
+		fmt.Fprintf(w, "Weight:    %d, threshold %d\n", r.Weight, r.WeightThreshold)
+	}
+	fmt.Fprintf(w, "Policy:    fulfilled: %v\n", r.PolicyFulfilled)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nINDEX\tSTATUS\tADDRESS\tDESCRIPTION")
+	signers, missing := r.Signers, r.Missing
+	for len(signers) > 0 || len(missing) > 0 {
+		status, s := "signed", inspectServer{}
+		if len(missing) == 0 || (len(signers) > 0 && signers[0].Index < missing[0].Index) {
+			s, signers = signers[0], signers[1:]
+		} else {
+			status, s, missing = "missing", missing[0], missing[1:]
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Index, status, s.Address, s.Description)
+	}
+	return tw.Flush()
+}
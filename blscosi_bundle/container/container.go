@@ -0,0 +1,303 @@
+// Package container defines a versioned signature format that describes how
+// a collective signature was produced: the suite, the aggregation scheme, the
+// roster, the message, the policy and the participation mask. It has a stable
+// binary encoding and a JSON form, and it only depends on kyber so that light
+// clients can decode it.
+package container
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/kyber/v3/sign/bls"
+)
+
+// Version is the version of the format written by Encode
+const Version = 1
+
+// magic starts the binary encoding of a container, which tells it apart from
+// a legacy signature
+var magic = []byte("BLSC")
+
+// Scheme is the way the signatures of the nodes are aggregated
+type Scheme uint8
+
+// The scheme 2 was an aggregate of plain BLS signatures. It is not accepted
+// anymore: without proofs of possession of the keys, which the rosters don't
+// give, such an aggregate can be forged with a rogue public key.
+const (
+	// SchemeBDN is an aggregate of BDN signatures with a participation mask,
+	// as produced by the gossip protocols
+	SchemeBDN Scheme = 1
+	// SchemeThreshold is a threshold signature verified with the single
+	// public key of the group
+	SchemeThreshold Scheme = 3
+)
+
+var schemeNames = map[Scheme]string{
+	SchemeBDN:       "bdn",
+	SchemeThreshold: "threshold",
+}
+
+func (s Scheme) String() string {
+	if name, ok := schemeNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(s))
+}
+
+// ParseScheme returns the scheme of the given name
+func ParseScheme(name string) (Scheme, error) {
+	for s, n := range schemeNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown scheme %s", name)
+}
+
+// Container is a collective signature along with what is needed to verify
+// it. The fields are empty when they are unknown, such as for a container
+// made from a legacy signature.
+type Container struct {
+	Version uint8
+	// Suite is the name of the suite of the keys and the signature
+	Suite  string
+	Scheme Scheme
+	// RosterHash is the hash of the public keys of the roster, see
+	// RosterHash
+	RosterHash []byte
+	// Hash is the hash of the message with the hash function of the suite
+	Hash []byte
+	// Policy is the JSON description of the policy the signers must fulfill,
+	// empty for the default threshold
+	Policy json.RawMessage
+	// Mask is the participation mask, in the order of the roster
+	Mask      []byte
+	Signature []byte
+}
+
+// New returns a container of the current version for a signature of the
+// given scheme and suite
+func New(suite pairing.Suite, scheme Scheme, sig, mask []byte) *Container {
+	return &Container{
+		Version:   Version,
+		Suite:     suite.String(),
+		Scheme:    scheme,
+		Mask:      mask,
+		Signature: sig,
+	}
+}
+
+// FromLegacy returns the container of a legacy signature, which is the
+// aggregate of the BDN signatures followed by the participation mask.
+func FromLegacy(suite pairing.Suite, raw []byte) (*Container, error) {
+	lenSig := suite.G1().PointLen()
+	if len(raw) < lenSig {
+		return nil, errors.New("signature too short")
+	}
+	return New(suite, SchemeBDN, raw[:lenSig], raw[lenSig:]), nil
+}
+
+// IsContainer returns true if b is the binary encoding of a container rather
+// than a legacy signature
+func IsContainer(b []byte) bool {
+	return bytes.HasPrefix(b, magic)
+}
+
+// Parse decodes either the binary encoding of a container or a legacy
+// signature
+func Parse(suite pairing.Suite, b []byte) (*Container, error) {
+	if IsContainer(b) {
+		return Decode(b)
+	}
+	return FromLegacy(suite, b)
+}
+
+// RosterHash returns the hash identifying a roster by its public keys, in
+// order
+func RosterHash(publics []kyber.Point) ([]byte, error) {
+	h := sha256.New()
+	for _, pub := range publics {
+		if _, err := pub.MarshalTo(h); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// Encode returns the binary encoding of the container: the magic bytes, the
+// version and the scheme, followed by every variable field prefixed with its
+// length as an uvarint.
+func (c *Container) Encode() []byte {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	buf.WriteByte(c.Version)
+	buf.WriteByte(byte(c.Scheme))
+	for _, field := range [][]byte{[]byte(c.Suite), c.RosterHash, c.Hash, c.Policy, c.Mask, c.Signature} {
+		var l [binary.MaxVarintLen64]byte
+		buf.Write(l[:binary.PutUvarint(l[:], uint64(len(field)))])
+		buf.Write(field)
+	}
+	return buf.Bytes()
+}
+
+// Decode parses the binary encoding of a container
+func Decode(b []byte) (*Container, error) {
+	if !IsContainer(b) {
+		return nil, errors.New("not a signature container")
+	}
+	b = b[len(magic):]
+	if len(b) < 2 {
+		return nil, errors.New("truncated signature container")
+	}
+	c := &Container{Version: b[0], Scheme: Scheme(b[1])}
+	if c.Version == 0 || c.Version > Version {
+		return nil, fmt.Errorf("unsupported container version %d", c.Version)
+	}
+	b = b[2:]
+
+	fields := make([][]byte, 6)
+	for i := range fields {
+		l, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < l {
+			return nil, errors.New("truncated signature container")
+		}
+		fields[i] = b[n : n+int(l)]
+		b = b[n+int(l):]
+	}
+	if len(b) != 0 {
+		return nil, errors.New("trailing bytes after the signature container")
+	}
+	c.Suite = string(fields[0])
+	c.RosterHash, c.Hash, c.Mask, c.Signature = fields[1], fields[2], fields[4], fields[5]
+	if len(fields[3]) > 0 {
+		c.Policy = fields[3]
+	}
+	return c, nil
+}
+
+// containerJSON is the JSON form of a container, with hex encoded bytes
+type containerJSON struct {
+	Version    uint8
+	Suite      string
+	Scheme     string
+	RosterHash string          `json:",omitempty"`
+	Hash       string          `json:",omitempty"`
+	Policy     json.RawMessage `json:",omitempty"`
+	Mask       string          `json:",omitempty"`
+	Signature  string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c *Container) MarshalJSON() ([]byte, error) {
+	return json.Marshal(containerJSON{
+		Version:    c.Version,
+		Suite:      c.Suite,
+		Scheme:     c.Scheme.String(),
+		RosterHash: hex.EncodeToString(c.RosterHash),
+		Hash:       hex.EncodeToString(c.Hash),
+		Policy:     c.Policy,
+		Mask:       hex.EncodeToString(c.Mask),
+		Signature:  hex.EncodeToString(c.Signature),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *Container) UnmarshalJSON(b []byte) error {
+	var cj containerJSON
+	if err := json.Unmarshal(b, &cj); err != nil {
+		return err
+	}
+	if cj.Version == 0 || cj.Version > Version {
+		return fmt.Errorf("unsupported container version %d", cj.Version)
+	}
+	scheme, err := ParseScheme(cj.Scheme)
+	if err != nil {
+		return err
+	}
+
+	res := Container{Version: cj.Version, Suite: cj.Suite, Scheme: scheme, Policy: cj.Policy}
+	for _, f := range []struct {
+		dst *[]byte
+		src string
+	}{{&res.RosterHash, cj.RosterHash}, {&res.Hash, cj.Hash}, {&res.Mask, cj.Mask}, {&res.Signature, cj.Signature}} {
+		if *f.dst, err = hex.DecodeString(f.src); err != nil {
+			return err
+		}
+	}
+	*c = res
+	return nil
+}
+
+// Verify checks the signature of the container over msg with the public keys
+// of the roster, or the public key of the group for a threshold signature,
+// and returns the mask of the signers. The suite, the roster and the hash of
+// the message are checked when the container gives them. The policy is only
+// checked if it is not nil.
+func (c *Container) Verify(suite pairing.Suite, msg []byte, publics []kyber.Point, policy sign.Policy) (*sign.Mask, error) {
+	if len(publics) == 0 {
+		return nil, errors.New("no public keys provided")
+	}
+	if c.Suite != "" && c.Suite != suite.String() {
+		return nil, fmt.Errorf("signature of suite %s, not %s", c.Suite, suite.String())
+	}
+	if len(c.Hash) > 0 {
+		h := suite.Hash()
+		h.Write(msg)
+		if !bytes.Equal(h.Sum(nil), c.Hash) {
+			return nil, errors.New("the hash of the signature doesn't match the message")
+		}
+	}
+	if len(c.RosterHash) > 0 {
+		rh, err := RosterHash(publics)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(rh, c.RosterHash) {
+			return nil, errors.New("the signature belongs to another roster")
+		}
+	}
+
+	mask, err := sign.NewMask(suite, publics, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Scheme {
+	case SchemeThreshold:
+		if len(publics) != 1 {
+			return nil, errors.New("a threshold signature needs the public key of the group")
+		}
+		if err := bls.Verify(suite, publics[0], msg, c.Signature); err != nil {
+			return nil, err
+		}
+		return mask, mask.SetBit(0, true)
+	case SchemeBDN:
+		if err := mask.SetMask(c.Mask); err != nil {
+			return nil, err
+		}
+		aggKey, err := bdn.AggregatePublicKeys(suite, mask)
+		if err == nil {
+			err = bdn.Verify(suite, aggKey, msg, c.Signature)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("didn't get a valid aggregate signature: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown scheme %s", c.Scheme)
+	}
+
+	if policy != nil && !policy.Check(mask) {
+		return nil, errors.New("the policy is not fulfilled")
+	}
+	return mask, nil
+}
@@ -0,0 +1,91 @@
+package container
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+var testSuite = pairing.NewSuiteBn256()
+
+// signAll returns the public keys of n nodes and the legacy signature of msg
+// by all of them
+func signAll(t *testing.T, n int, msg []byte) ([]kyber.Point, []byte) {
+	publics := make([]kyber.Point, n)
+	sigs := make([][]byte, n)
+	for i := range publics {
+		var sk kyber.Scalar
+		sk, publics[i] = bdn.NewKeyPair(testSuite, random.New())
+		sig, err := bdn.Sign(testSuite, sk, msg)
+		require.NoError(t, err)
+		sigs[i] = sig
+	}
+
+	mask, err := sign.NewMask(testSuite, publics, nil)
+	require.NoError(t, err)
+	for i := range publics {
+		require.NoError(t, mask.SetBit(i, true))
+	}
+	agg, err := bdn.AggregateSignatures(testSuite, sigs, mask)
+	require.NoError(t, err)
+	raw, err := agg.MarshalBinary()
+	require.NoError(t, err)
+	return publics, append(raw, mask.Mask()...)
+}
+
+func TestContainer_Encoding(t *testing.T) {
+	msg := []byte("hello container")
+	publics, legacy := signAll(t, 4, msg)
+
+	c, err := Parse(testSuite, legacy)
+	require.NoError(t, err)
+	require.Equal(t, SchemeBDN, c.Scheme)
+	h := testSuite.Hash()
+	h.Write(msg)
+	c.Hash = h.Sum(nil)
+	c.RosterHash, err = RosterHash(publics)
+	require.NoError(t, err)
+	c.Policy = json.RawMessage(`{"Threshold":3}`)
+
+	// binary form
+	buf := c.Encode()
+	require.True(t, IsContainer(buf))
+	c2, err := Parse(testSuite, buf)
+	require.NoError(t, err)
+	require.Equal(t, c, c2)
+	_, err = Decode(buf[:len(buf)-1])
+	require.Error(t, err)
+	_, err = Decode(append(buf, 0))
+	require.Error(t, err)
+
+	// JSON form
+	js, err := json.Marshal(c)
+	require.NoError(t, err)
+	c3 := &Container{}
+	require.NoError(t, json.Unmarshal(js, c3))
+	require.Equal(t, c.Encode(), c3.Encode())
+
+	mask, err := c3.Verify(testSuite, msg, publics, sign.NewThresholdPolicy(4))
+	require.NoError(t, err)
+	require.Equal(t, 4, mask.CountEnabled())
+
+	_, err = c3.Verify(testSuite, []byte("another message"), publics, nil)
+	require.Error(t, err)
+	_, err = c3.Verify(testSuite, msg, publics[1:], nil)
+	require.Error(t, err)
+	_, err = c3.Verify(testSuite, msg, publics, sign.NewThresholdPolicy(5))
+	require.Error(t, err)
+
+	// plain BLS aggregates are open to rogue keys and aren't accepted
+	c3.Scheme = 2
+	_, err = c3.Verify(testSuite, msg, publics, nil)
+	require.Error(t, err)
+	_, err = ParseScheme("pop")
+	require.Error(t, err)
+}
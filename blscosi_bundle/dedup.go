@@ -0,0 +1,114 @@
+package blscosi_bundle
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/protobuf"
+)
+
+// inflight is a protocol run shared by the identical requests that arrived
+// while it was running. done is closed once sig and err are set.
+type inflight struct {
+	done   chan struct{}
+	sig    protocol.BlsSignature
+	queued time.Duration
+	err    error
+}
+
+// cachedSignature is a recent result kept until expires.
+type cachedSignature struct {
+	sig     protocol.BlsSignature
+	expires time.Time
+}
+
+// dedup merges the identical signing requests.
+type dedup struct {
+	sync.Mutex
+	running map[string]*inflight
+	cache   map[string]cachedSignature
+}
+
+func newDedup() *dedup {
+	return &dedup{
+		running: make(map[string]*inflight),
+		cache:   make(map[string]cachedSignature),
+	}
+}
+
+// dedupKey identifies the requests that produce the same signature: same
+// message, same roster and same threshold, which includes the weights of the
+// nodes for a weight threshold, or the same compound policy.
+func (s *Service) dedupKey(roster *onet.Roster, msg []byte, params protocol.Parameters) string {
+	threshold := s.Threshold
+	if threshold <= 0 {
+		threshold = protocol.DefaultThreshold(len(roster.List))
+	}
+	h := s.suite.Hash()
+	h.Write(msg)
+	h.Write(roster.ID[:])
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(threshold))
+	h.Write(buf[:])
+	if params.WeightThreshold > 0 {
+		binary.LittleEndian.PutUint32(buf[:], uint32(params.WeightThreshold))
+		h.Write(buf[:])
+		for _, w := range params.Weights {
+			binary.LittleEndian.PutUint32(buf[:], uint32(w))
+			h.Write(buf[:])
+		}
+	}
+	if params.Policy != nil {
+		if buf, err := protobuf.Encode(params.Policy); err == nil {
+			h.Write(buf)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// signOnce signs msg over the roster, sharing the protocol run with the
+// identical requests that are running, or answering from the cache of
+// recent results if CacheTTL is set. The requests joining a running protocol
+// get the queue time of the first one.
+func (s *Service) signOnce(roster *onet.Roster, msg []byte, params protocol.Parameters, priority int) (protocol.BlsSignature, time.Duration, error) {
+	key := s.dedupKey(roster, msg, params)
+
+	s.dedup.Lock()
+	now := time.Now()
+	for k, c := range s.dedup.cache {
+		if now.After(c.expires) {
+			delete(s.dedup.cache, k)
+		}
+	}
+	if c, ok := s.dedup.cache[key]; ok {
+		s.dedup.Unlock()
+		log.Lvl3("Answering from the cache of recent signatures")
+		return c.sig, 0, nil
+	}
+	if run, ok := s.dedup.running[key]; ok {
+		s.dedup.Unlock()
+		log.Lvl3("Joining a running protocol for the same request")
+		<-run.done
+		return run.sig, run.queued, run.err
+	}
+	run := &inflight{done: make(chan struct{})}
+	s.dedup.running[key] = run
+	s.dedup.Unlock()
+
+	run.sig, run.queued, run.err = s.sign(roster, msg, params, priority)
+
+	s.dedup.Lock()
+	delete(s.dedup.running, key)
+	if run.err == nil && run.sig != nil && s.CacheTTL > 0 {
+		s.dedup.cache[key] = cachedSignature{run.sig, time.Now().Add(s.CacheTTL)}
+	}
+	s.dedup.Unlock()
+	close(run.done)
+
+	return run.sig, run.queued, run.err
+}
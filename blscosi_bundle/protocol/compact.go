@@ -0,0 +1,111 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/protobuf"
+)
+
+// digests returns the hash of the message and of the parameters of a round,
+// which identify it in the compact messages.
+func (p *BlsCosi) digests(msg []byte, params Parameters) ([]byte, []byte, error) {
+	h := p.suite.Hash()
+	h.Write(msg)
+	hash := h.Sum(nil)
+
+	buf, err := protobuf.Encode(&params)
+	if err != nil {
+		return nil, nil, err
+	}
+	h = p.suite.Hash()
+	h.Write(buf)
+	return hash, h.Sum(nil), nil
+}
+
+// setDigests computes the hashes of the message and the parameters of this
+// round, once they are known.
+func (p *BlsCosi) setDigests() error {
+	var err error
+	p.hash, p.paramsDigest, err = p.digests(p.Msg, p.Params)
+	return err
+}
+
+// matches returns true if the hashes are the ones of this round.
+func (p *BlsCosi) matches(hash, paramsDigest []byte) bool {
+	return bytes.Equal(hash, p.hash) && bytes.Equal(paramsDigest, p.paramsDigest)
+}
+
+// hasMessage records that the peer has the message of the round, so that it
+// gets the compact messages from now on.
+func (p *BlsCosi) hasMessage(tn *onet.TreeNode) {
+	p.known[tn.RosterIndex] = true
+}
+
+// rumorFor returns the rumor to send to the target, which is compact if the
+// target already has the message.
+func (p *BlsCosi) rumorFor(target *onet.TreeNode, responses Responses) interface{} {
+	if p.known[target.RosterIndex] {
+		return &CompactRumor{p.hash, p.paramsDigest, responses.Map()}
+	}
+	return &Rumor{p.Params, responses.Map(), p.Msg}
+}
+
+// shutdownFor returns the shutdown to send to the target, which is compact if
+// the target already has the message.
+func (p *BlsCosi) shutdownFor(target *onet.TreeNode, shutdown *Shutdown) interface{} {
+	if p.known[target.RosterIndex] {
+		return &CompactShutdown{p.hash, p.paramsDigest, shutdown.FinalCoSignature,
+			shutdown.RootSig, shutdown.Signer, shutdown.Takeover, shutdown.Tree}
+	}
+	return shutdown
+}
+
+// expandShutdown returns the full shutdown of a compact one, which must match
+// this round.
+func (p *BlsCosi) expandShutdown(msg CompactShutdownMessage) ShutdownMessage {
+	return ShutdownMessage{msg.TreeNode, Shutdown{
+		Params:           p.Params,
+		FinalCoSignature: msg.FinalCoSignature,
+		RootSig:          msg.RootSig,
+		Msg:              p.Msg,
+		Signer:           msg.Signer,
+		Takeover:         msg.Takeover,
+		Tree:             msg.Tree,
+	}}
+}
+
+// requestMessage asks the sender of a compact message for the message of the
+// round.
+func (p *BlsCosi) requestMessage(sender *onet.TreeNode, hash, paramsDigest []byte) {
+	log.Lvlf4("%v fetches the message from %v", p.ServerIdentity(), sender.ServerIdentity)
+	if err := p.sendTo(sender, &MessageRequest{hash, paramsDigest}); err != nil {
+		log.Lvl2("Couldn't request the message:", err)
+	}
+}
+
+// replyMessage sends the message of the round to a peer asking for it.
+func (p *BlsCosi) replyMessage(req MessageRequestMessage) {
+	if !p.matches(req.Hash, req.ParamsDigest) {
+		log.Lvl2("Got a request for another message")
+		return
+	}
+	if err := p.sendTo(req.TreeNode, &MessageReply{p.Params, p.Msg}); err != nil {
+		log.Lvl2("Couldn't send the message:", err)
+	}
+}
+
+// checkReply verifies that the fetched message and parameters match the
+// hashes that were requested.
+func (p *BlsCosi) checkReply(reply MessageReplyMessage, hash, paramsDigest []byte) error {
+	h, d, err := p.digests(reply.Msg, reply.Params)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(h, hash) || !bytes.Equal(d, paramsDigest) {
+		return errors.New("fetched message doesn't match its hash")
+	}
+	return nil
+}
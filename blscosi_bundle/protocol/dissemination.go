@@ -0,0 +1,106 @@
+package protocol
+
+import (
+	"time"
+
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+)
+
+// Dissemination tells how the final signature spread to a node. Finalised is
+// when the node created it, Shutdown when it first accepted a shutdown and
+// Tree when a shutdown came along the dissemination tree, before or after the
+// first one. The times of what didn't happen are zero.
+type Dissemination struct {
+	Finalised time.Time
+	Shutdown  time.Time
+	Tree      time.Time
+}
+
+// shutdownChildren returns the roster indices of the children of the node at
+// index in the binomial tree rooted at origin over n nodes. With the indices
+// relative to origin, the node r forwards to r + 2^k for every 2^k > r, so
+// that every node is reached in at most log2(n) hops.
+func shutdownChildren(origin, index, n int) []int {
+	rel := (index - origin + n) % n
+	step := 1
+	for step <= rel {
+		step <<= 1
+	}
+	var children []int
+	for ; rel+step < n; step <<= 1 {
+		children = append(children, (origin+rel+step)%n)
+	}
+	return children
+}
+
+// sendShutdownTree sends the shutdown to the children of the node at index in
+// the tree rooted at the signer of the shutdown. A child that can't be
+// reached is skipped and its own children get the shutdown instead. The nodes
+// the tree misses anyway get it from the random peers of sendShutdowns, or in
+// answer to their rumors.
+func (p *BlsCosi) sendShutdownTree(shutdown Shutdown, index int) {
+	shutdown.Tree = true
+	for _, child := range shutdownChildren(int(shutdown.Signer), index, len(p.Publics())) {
+		target := p.nodeAt(child)
+		if target == nil {
+			continue
+		}
+		err := p.sendTo(target, p.shutdownFor(target, &shutdown))
+		if err != nil {
+			log.Lvl2("Couldn't send the shutdown to", child, "taking over its children:", err)
+			p.sendShutdownTree(shutdown, child)
+		}
+	}
+}
+
+// nodeAt returns the node of the tree with the given roster index.
+func (p *BlsCosi) nodeAt(index int) *onet.TreeNode {
+	for _, tn := range p.List() {
+		if tn.RosterIndex == index {
+			return tn
+		}
+	}
+	return nil
+}
+
+// Dissemination returns when this node finalised the round or received the
+// shutdown. It can be called while the protocol runs.
+func (p *BlsCosi) Dissemination() Dissemination {
+	p.disseminationLock.Lock()
+	defer p.disseminationLock.Unlock()
+	return p.dissemination
+}
+
+// recordFinalised records that this node created the final signature.
+func (p *BlsCosi) recordFinalised() {
+	p.disseminationLock.Lock()
+	defer p.disseminationLock.Unlock()
+	p.dissemination.Finalised = time.Now()
+}
+
+// recordShutdown records the reception of a valid shutdown.
+func (p *BlsCosi) recordShutdown(shutdown Shutdown) {
+	p.disseminationLock.Lock()
+	defer p.disseminationLock.Unlock()
+	now := time.Now()
+	if p.dissemination.Shutdown.IsZero() {
+		p.dissemination.Shutdown = now
+	}
+	if shutdown.Tree && p.dissemination.Tree.IsZero() {
+		p.dissemination.Tree = now
+	}
+}
+
+// recordTreeShutdown records a shutdown received once the round is over if it
+// is the first valid one to come along the tree.
+func (p *BlsCosi) recordTreeShutdown(msg ShutdownMessage) {
+	if !msg.Tree || !p.Dissemination().Tree.IsZero() {
+		return
+	}
+	if err := p.verifyShutdown(msg); err != nil {
+		log.Lvl2("Got spoofed shutdown:", err)
+		return
+	}
+	p.recordShutdown(msg.Shutdown)
+}
@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+)
+
+var testSuite = pairing.NewSuiteBn256()
+
+const testServiceName = "TestServiceBlsCosiBundle"
+
+var testServiceID onet.ServiceID
+
+func init() {
+	var err error
+	testServiceID, err = onet.RegisterNewServiceWithSuite(testServiceName, testSuite, newTestService)
+	log.ErrFatal(err)
+}
+
+func TestShutdownChildren(t *testing.T) {
+	require.Equal(t, []int{1, 2, 4, 8}, shutdownChildren(0, 0, 16))
+	require.Equal(t, []int{5, 6}, shutdownChildren(0, 4, 16))
+	require.Equal(t, []int{7}, shutdownChildren(0, 6, 16))
+	require.Equal(t, []int(nil), shutdownChildren(0, 15, 16))
+	// the tree is rotated to start at its origin
+	require.Equal(t, []int{13, 14, 0, 4}, shutdownChildren(12, 12, 16))
+}
+
+func TestDissemination_ShutdownTree(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	servers, roster, _ := local.GenTree(16, false)
+	defer local.CloseAll()
+
+	services := local.GetServices(servers, testServiceID)
+	tree := roster.GenerateNaryTreeWithRoot(len(roster.List)-1, roster.List[0])
+	pi, err := services[0].(*testService).CreateProtocol(DefaultProtocolName, tree)
+	require.NoError(t, err)
+	root := pi.(*BlsCosi)
+	root.Msg = []byte("hello shutdown tree")
+	// the tree alone must reach the nodes, without random peers
+	root.Params = Parameters{GossipTick: 100 * time.Millisecond, RumorPeers: 15, ShutdownTree: true}
+	root.Threshold = len(servers) - 1
+
+	// the inner node 4 is gone, the root sends to its children 5 and 6
+	// itself, and 6 forwards to 7
+	require.NoError(t, servers[4].Close())
+
+	require.NoError(t, root.Start())
+	require.NotNil(t, <-root.FinalSignature)
+	finalised := root.Dissemination().Finalised
+	require.False(t, finalised.IsZero())
+
+	for i, s := range services {
+		if i == 0 || i == 4 {
+			continue
+		}
+		var d Dissemination
+		for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+			if d = s.(*testService).dissemination(); !d.Tree.IsZero() {
+				break
+			}
+		}
+		require.False(t, d.Tree.IsZero(), "node %d didn't get the shutdown along the tree", i)
+
+		delay := d.Tree.Sub(finalised)
+		log.Lvlf1("node %d got the shutdown %v after the root finalised", i, delay)
+		require.True(t, delay >= 0)
+		require.True(t, delay < time.Second)
+	}
+}
+
+// testService keeps the protocol instances created on the node.
+type testService struct {
+	*onet.ServiceProcessor
+	sync.Mutex
+	instances []*BlsCosi
+}
+
+func newTestService(c *onet.Context) (onet.Service, error) {
+	return &testService{ServiceProcessor: onet.NewServiceProcessor(c)}, nil
+}
+
+func (s *testService) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfig) (onet.ProtocolInstance, error) {
+	pi, err := NewDefaultProtocol(tn)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	s.instances = append(s.instances, pi.(*BlsCosi))
+	s.Unlock()
+	return pi, nil
+}
+
+// dissemination returns the dissemination of the first instance of the node,
+// which is zero if it has none yet.
+func (s *testService) dissemination() Dissemination {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.instances) == 0 {
+		return Dissemination{}
+	}
+	return s.instances[0].Dissemination()
+}
@@ -0,0 +1,198 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	dkg "go.dedis.ch/kyber/v3/share/dkg/pedersen"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+)
+
+// ShareFn is called on every node once the distributed key generation is
+// certified, with the share the node has to keep.
+type ShareFn func(dks *dkg.DistKeyShare) error
+
+// SetupDKG runs a Pedersen distributed key generation over the roster of the
+// tree. Every node gets a share of the group key and the root is notified
+// when every node holds a certified share.
+type SetupDKG struct {
+	*onet.TreeNodeInstance
+	// Timeout is the time we wait for the whole key generation
+	Timeout   time.Duration
+	Threshold int
+	Finished  chan bool // root only, true when every node has its share
+
+	stoppedOnce sync.Once
+	startChan   chan bool
+	shareFn     ShareFn
+
+	InitChan     chan DKGInitMessage
+	DealChan     chan DKGDealMessage
+	ResponseChan chan DKGResponseMessage
+	DoneChan     chan DKGDoneMessage
+}
+
+// NewSetupDKG creates the key generation protocol. The share is handed over
+// to shareFn, which is responsible for storing it.
+func NewSetupDKG(n *onet.TreeNodeInstance, shareFn ShareFn) (onet.ProtocolInstance, error) {
+	c := &SetupDKG{
+		TreeNodeInstance: n,
+		Timeout:          defaultTimeout,
+		Threshold:        DefaultThreshold(len(n.Roster().List)),
+		Finished:         make(chan bool, 1),
+		startChan:        make(chan bool, 1),
+		shareFn:          shareFn,
+	}
+
+	err := c.RegisterChannels(&c.InitChan, &c.DealChan, &c.ResponseChan, &c.DoneChan)
+	if err != nil {
+		return nil, errors.New("couldn't register channels: " + err.Error())
+	}
+
+	return c, nil
+}
+
+// Shutdown stops the protocol
+func (p *SetupDKG) Shutdown() error {
+	p.stoppedOnce.Do(func() {
+		close(p.startChan)
+		close(p.Finished)
+	})
+	return nil
+}
+
+// Start is done only by root and starts the protocol.
+func (p *SetupDKG) Start() error {
+	if p.shareFn == nil {
+		p.Done()
+		return fmt.Errorf("share function cannot be nil")
+	}
+	if p.Threshold > p.Tree().Size() || p.Threshold < 1 {
+		p.Done()
+		return fmt.Errorf("invalid threshold %d for %d nodes", p.Threshold, p.Tree().Size())
+	}
+
+	log.Lvlf3("Starting DKG on %v", p.ServerIdentity())
+	p.startChan <- true
+	return nil
+}
+
+// Dispatch is the main method of the protocol for all nodes.
+func (p *SetupDKG) Dispatch() error {
+	defer p.Done()
+
+	timeout := time.After(p.Timeout)
+
+	if p.IsRoot() {
+		select {
+		case _, ok := <-p.startChan:
+			if !ok {
+				return errors.New("protocol finished prematurely")
+			}
+		case <-time.After(time.Second):
+			return errors.New("timeout, did you forget to call Start?")
+		}
+		errs := p.Broadcast(&DKGInit{})
+		if len(errs) > 0 {
+			return fmt.Errorf("couldn't start the key generation: %v", errs)
+		}
+	} else {
+		select {
+		case <-p.InitChan:
+		case <-timeout:
+			return errors.New("timeout while waiting for the key generation to start")
+		}
+	}
+
+	gen, err := dkg.NewDistKeyGenerator(bn256.NewSuiteG2(), p.Private(), p.Publics(), p.Threshold)
+	if err != nil {
+		return err
+	}
+
+	deals, err := gen.Deals()
+	if err != nil {
+		return err
+	}
+	for i, deal := range deals {
+		target, err := p.nodeAt(i)
+		if err != nil {
+			return err
+		}
+		if err := p.SendTo(target, &DKGDeal{deal}); err != nil {
+			return err
+		}
+	}
+
+	// Responses can arrive before the deal they are about, so they are only
+	// processed once every deal is known.
+	var pending []*dkg.Response
+	nbrDeals := 0
+	nbrDone := 0
+	certified := false
+	for !certified || (p.IsRoot() && nbrDone < len(p.List())-1) {
+		select {
+		case deal := <-p.DealChan:
+			resp, err := gen.ProcessDeal(deal.Deal)
+			if err != nil {
+				log.Lvl1("Got invalid deal:", err)
+				continue
+			}
+			nbrDeals++
+			if errs := p.Broadcast(&DKGResponse{resp}); len(errs) > 0 {
+				log.Lvl1("Couldn't broadcast response:", errs)
+			}
+		case resp := <-p.ResponseChan:
+			pending = append(pending, resp.Response)
+		case <-p.DoneChan:
+			nbrDone++
+		case <-timeout:
+			return errors.New("timeout while generating the distributed key")
+		}
+
+		if nbrDeals < len(p.List())-1 {
+			continue
+		}
+		for _, resp := range pending {
+			if _, err := gen.ProcessResponse(resp); err != nil {
+				log.Lvl1("Got invalid response:", err)
+			}
+		}
+		pending = nil
+
+		if !certified && gen.Certified() {
+			certified = true
+			dks, err := gen.DistKeyShare()
+			if err != nil {
+				return err
+			}
+			if err := p.shareFn(dks); err != nil {
+				return err
+			}
+			log.Lvlf3("%v holds a certified share", p.ServerIdentity())
+			if !p.IsRoot() {
+				if err := p.SendToParent(&DKGDone{}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if p.IsRoot() {
+		p.Finished <- true
+	}
+	return nil
+}
+
+// nodeAt returns the tree node that has the given index in the roster.
+func (p *SetupDKG) nodeAt(idx int) (*onet.TreeNode, error) {
+	for _, tn := range p.List() {
+		if i, _ := p.Roster().Search(tn.ServerIdentity.ID); i == idx {
+			return tn, nil
+		}
+	}
+	return nil, fmt.Errorf("no node with index %d", idx)
+}
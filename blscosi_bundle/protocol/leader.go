@@ -0,0 +1,181 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+)
+
+// silentTicksFactor scales the number of gossip ticks without news from the
+// leader after which it is considered gone. A node hears from a given peer
+// every n/fanout ticks on average.
+const silentTicksFactor = 4
+
+// leaderIndex returns the roster index of the node that finalises the round.
+// It is the root, or its successors in the roster order once a takeover has
+// been agreed on.
+func (p *BlsCosi) leaderIndex() int {
+	return p.leaderOf(p.elections)
+}
+
+// leaderOf returns the roster index of the leader of the given term.
+func (p *BlsCosi) leaderOf(term int) int {
+	return (p.Root().RosterIndex + term) % len(p.Publics())
+}
+
+// isLeader returns true if this node currently finalises the round.
+func (p *BlsCosi) isLeader() bool {
+	return p.TreeNode().RosterIndex == p.leaderIndex()
+}
+
+// heardFrom resets the silence of the leader if it sent the message.
+func (p *BlsCosi) heardFrom(tn *onet.TreeNode) {
+	if tn.RosterIndex == p.leaderIndex() {
+		p.silentTicks = 0
+	}
+}
+
+// tickLeader counts a gossip tick without news from the leader and votes for
+// the next one if the leader has been silent for too long.
+func (p *BlsCosi) tickLeader() {
+	if p.isLeader() {
+		return
+	}
+	p.silentTicks++
+	peers := p.pace.peers
+	if peers < 1 {
+		peers = 1
+	}
+	if p.silentTicks > silentTicksFactor*len(p.Publics())/peers {
+		p.leaderGone()
+	}
+}
+
+// leaderGone votes for the takeover of the next node in the roster order and
+// sends the votes known for it to the other nodes. The next node only
+// becomes the leader once a majority voted, see elect.
+func (p *BlsCosi) leaderGone() {
+	term := p.elections + 1
+	if term >= len(p.Publics()) {
+		return
+	}
+	p.silentTicks = 0
+	if p.votes == nil {
+		p.votes = make(map[uint32][]byte)
+	}
+	self := uint32(p.TreeNode().RosterIndex)
+	if _, ok := p.votes[self]; !ok {
+		sig, err := bdn.Sign(p.suite, p.Private(), p.takeoverMessage(term))
+		if err != nil {
+			log.Error("Couldn't sign takeover vote:", err)
+			return
+		}
+		p.votes[self] = sig
+		log.Lvlf2("%v votes for node %d as the new leader", p.ServerIdentity(), p.leaderOf(term))
+	}
+
+	takeover := &Takeover{uint32(term), p.votes}
+	if len(p.votes) >= p.takeoverQuorum() {
+		p.elect(takeover)
+		return
+	}
+	p.broadcastTakeover(takeover)
+}
+
+// handleTakeover adopts a takeover that has the votes of a majority, or
+// collects its votes if it is for the next term.
+func (p *BlsCosi) handleTakeover(msg TakeoverMessage) {
+	p.heardFrom(msg.TreeNode)
+	term := int(msg.Term)
+	if term <= p.elections || term >= len(p.Publics()) {
+		return
+	}
+	votes := p.validVotes(&msg.Takeover)
+	if len(votes) >= p.takeoverQuorum() {
+		p.elect(&Takeover{msg.Term, votes})
+		return
+	}
+	if term != p.elections+1 {
+		return
+	}
+	if p.votes == nil {
+		p.votes = make(map[uint32][]byte)
+	}
+	for i, sig := range votes {
+		p.votes[i] = sig
+	}
+	if len(p.votes) >= p.takeoverQuorum() {
+		p.elect(&Takeover{msg.Term, p.votes})
+	}
+}
+
+// elect makes the node of the term of the takeover the leader and tells the
+// other nodes, the takeover being the proof of the election.
+func (p *BlsCosi) elect(takeover *Takeover) {
+	p.elections = int(takeover.Term)
+	p.takeover = takeover
+	p.votes = nil
+	p.silentTicks = 0
+	log.Lvlf2("%v elects node %d as the new leader", p.ServerIdentity(), p.leaderIndex())
+	p.broadcastTakeover(takeover)
+}
+
+// broadcastTakeover sends the takeover to every other node.
+func (p *BlsCosi) broadcastTakeover(takeover *Takeover) {
+	for _, tn := range p.List() {
+		if tn.Equal(p.TreeNode()) {
+			continue
+		}
+		if err := p.sendTo(tn, takeover); err != nil {
+			log.Lvl3("Couldn't send takeover:", err)
+		}
+	}
+}
+
+// verifyTakeover checks that the takeover has the votes of a majority.
+func (p *BlsCosi) verifyTakeover(takeover *Takeover) error {
+	if takeover.Term < 1 || int(takeover.Term) >= len(p.Publics()) {
+		return fmt.Errorf("invalid term %d", takeover.Term)
+	}
+	if len(p.validVotes(takeover)) < p.takeoverQuorum() {
+		return errors.New("not enough votes for the takeover")
+	}
+	return nil
+}
+
+// validVotes returns the votes of the takeover that are correctly signed.
+func (p *BlsCosi) validVotes(takeover *Takeover) map[uint32][]byte {
+	msg := p.takeoverMessage(int(takeover.Term))
+	votes := make(map[uint32][]byte)
+	for i, sig := range takeover.Votes {
+		if int(i) >= len(p.Publics()) {
+			continue
+		}
+		if err := verify(p.suite, sig, msg, p.Publics()[i]); err != nil {
+			log.Lvl2("Got a wrong takeover vote:", err)
+			continue
+		}
+		votes[i] = sig
+	}
+	return votes
+}
+
+// takeoverQuorum is the number of votes needed to elect a new leader, a
+// majority, so that the nodes cut off from a live leader can't replace it.
+func (p *BlsCosi) takeoverQuorum() int {
+	return len(p.Publics())/2 + 1
+}
+
+// takeoverMessage is the message signed by the nodes that vote for the
+// leader of the given term. It contains the round ID of the instance so that
+// it can't be replayed.
+func (p *BlsCosi) takeoverMessage(term int) []byte {
+	msg := []byte("takeover round " + p.Token().RoundID.String())
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(term))
+	return append(msg, buf[:]...)
+}
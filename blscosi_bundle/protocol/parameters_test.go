@@ -0,0 +1,46 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParameters_WithDefaults(t *testing.T) {
+	def := DefaultParams()
+	tests := []struct {
+		name   string
+		params Parameters
+		want   Parameters
+	}{
+		{"empty", Parameters{}, def},
+		{"defaults", def, def},
+		{"tree mode only", Parameters{TreeMode: true}, def},
+		{
+			"unset fanouts",
+			Parameters{GossipTick: time.Second},
+			Parameters{GossipTick: time.Second, RumorPeers: def.RumorPeers, ShutdownPeers: def.ShutdownPeers},
+		},
+		{
+			"unset tick",
+			Parameters{RumorPeers: 5, ShutdownPeers: 1},
+			Parameters{GossipTick: def.GossipTick, RumorPeers: 5, ShutdownPeers: 1},
+		},
+		{
+			"negative values",
+			Parameters{GossipTick: -1, RumorPeers: -1, ShutdownPeers: -1, Leaderless: true},
+			Parameters{GossipTick: def.GossipTick, RumorPeers: def.RumorPeers, ShutdownPeers: def.ShutdownPeers,
+				Leaderless: true},
+		},
+		{
+			"shutdown tree",
+			Parameters{ShutdownTree: true},
+			Parameters{GossipTick: def.GossipTick, RumorPeers: def.RumorPeers, ShutdownTree: true},
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.want, test.params.WithDefaults(), test.name)
+	}
+}
@@ -0,0 +1,11 @@
+package protocol
+
+import "github.com/dedis/student_19_elias/blscosi_bundle/verifier"
+
+// Policy is a compound policy, fulfilled when all of its clauses are, see
+// verifier.Policy.
+type Policy = verifier.Policy
+
+// PolicyGroup is a group of nodes of a compound policy, see
+// verifier.PolicyGroup.
+type PolicyGroup = verifier.PolicyGroup
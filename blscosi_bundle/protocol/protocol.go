@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dedis/student_19_elias/blscosi_bundle/verifier"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/sign"
@@ -39,9 +40,12 @@ type BlsCosi struct {
 	Data []byte
 	// Timeout is not a global timeout for the protocol, but a timeout used
 	// for waiting for responses.
-	Timeout        time.Duration
-	Threshold      int
-	FinalSignature chan BlsSignature // final signature that is sent back to client
+	Timeout   time.Duration
+	Threshold int
+	// FinalSignature gets the final signature that is sent back to client.
+	// Other nodes get it if they know it at the end of the round, from a
+	// shutdown message or because they created it.
+	FinalSignature chan BlsSignature
 
 	stoppedOnce    sync.Once
 	startChan      chan bool
@@ -49,9 +53,54 @@ type BlsCosi struct {
 	suite          *pairing.SuiteBn256
 	Params         Parameters // mainly for simulations
 
+	// ProgressChan, if set by the root before starting, gets the partial
+	// aggregate every time it grows. Updates are dropped if it is full.
+	ProgressChan chan RoundProgress
+
+	// progress is the mask of the signers known by this node, see Progress
+	progressLock sync.Mutex
+	progress     []byte
+	lastSigners  int
+
+	// elections is the term of the current leader, the root's being zero,
+	// and takeover the proof of its election. silentTicks is the number of
+	// ticks since we heard from the leader and votes the votes known for the
+	// next term.
+	elections   int
+	takeover    *Takeover
+	silentTicks int
+	votes       map[uint32][]byte
+
+	// cancelChan asks the root to abort the round, see Cancel
+	cancelChan chan bool
+	abortLock  sync.Mutex
+	aborted    bool
+
+	// dissemination tells when the shutdown was created and received, see
+	// Dissemination
+	disseminationLock sync.Mutex
+	dissemination     Dissemination
+
+	// traffic counts the messages of this instance, see Traffic
+	traffic *Traffic
+	// pace is the current tick and fanout of the gossip
+	pace *gossipPace
+
+	// known holds the roster indices of the peers that have the message,
+	// which get compact messages identified by hash and paramsDigest.
+	known        map[int]bool
+	hash         []byte
+	paramsDigest []byte
+
 	// internodes channels
-	RumorsChan   chan RumorMessage
-	ShutdownChan chan ShutdownMessage
+	RumorsChan          chan RumorMessage
+	ShutdownChan        chan ShutdownMessage
+	AbortChan           chan AbortMessage
+	CompactRumorsChan   chan CompactRumorMessage
+	CompactShutdownChan chan CompactShutdownMessage
+	MessageRequestChan  chan MessageRequestMessage
+	MessageReplyChan    chan MessageReplyMessage
+	TakeoverChan        chan TakeoverMessage
 }
 
 // NewDefaultProtocol is the default protocol function used for registration
@@ -71,8 +120,7 @@ func GlobalRegisterDefaultProtocols() {
 // DefaultThreshold computes the minimal threshold authorized using
 // the formula 3f+1
 func DefaultThreshold(n int) int {
-	f := (n - 1) / 3
-	return n - f
+	return verifier.DefaultThreshold(n)
 }
 
 // NewBlsCosi method is used to define the blscosi protocol.
@@ -84,11 +132,16 @@ func NewBlsCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite *pairing.Suit
 		Timeout:          defaultTimeout,
 		Threshold:        DefaultThreshold(nNodes),
 		startChan:        make(chan bool, 1),
+		traffic:          newTraffic(),
+		known:            make(map[int]bool),
+		cancelChan:       make(chan bool, 1),
 		verificationFn:   vf,
 		suite:            suite,
 	}
 
-	err := c.RegisterChannels(&c.RumorsChan, &c.ShutdownChan)
+	err := c.RegisterChannels(&c.RumorsChan, &c.ShutdownChan, &c.AbortChan,
+		&c.CompactRumorsChan, &c.CompactShutdownChan, &c.MessageRequestChan, &c.MessageReplyChan,
+		&c.TakeoverChan)
 	if err != nil {
 		return nil, errors.New("couldn't register channels: " + err.Error())
 	}
@@ -101,6 +154,9 @@ func (p *BlsCosi) Shutdown() error {
 	p.stoppedOnce.Do(func() {
 		close(p.startChan)
 		close(p.FinalSignature)
+		if p.ProgressChan != nil {
+			close(p.ProgressChan)
+		}
 	})
 	return nil
 }
@@ -119,9 +175,43 @@ func (p *BlsCosi) Start() error {
 	return nil
 }
 
+// Cancel aborts the round. It only has an effect on the root, which tells
+// the other nodes to stop with a signed abort message. The root then closes
+// FinalSignature without a signature.
+func (p *BlsCosi) Cancel() {
+	select {
+	case p.cancelChan <- true:
+	default:
+	}
+}
+
+// Aborted returns true if the round has been aborted by the root before its
+// end.
+func (p *BlsCosi) Aborted() bool {
+	p.abortLock.Lock()
+	defer p.abortLock.Unlock()
+	return p.aborted
+}
+
+// Traffic returns the counts of the messages exchanged by this instance. It
+// can be read once the round is over.
+func (p *BlsCosi) Traffic() *Traffic {
+	return p.traffic
+}
+
+// sendTo sends the message to a single peer and counts it.
+func (p *BlsCosi) sendTo(target *onet.TreeNode, msg interface{}) error {
+	err := p.SendTo(target, msg)
+	if err == nil {
+		p.traffic.countSent(msg)
+	}
+	return err
+}
+
 // Dispatch is the main method of the protocol for all nodes.
 func (p *BlsCosi) Dispatch() error {
 	defer p.Done()
+	defer p.traffic.record()
 
 	protocolTimeout := time.After(shutdownAfter)
 
@@ -133,8 +223,13 @@ func (p *BlsCosi) Dispatch() error {
 	// stays alive here on this node, but no more rumor messages are sent.
 	shutdown := false
 	done := false
+	// finalise is true when this node creates the final signature
+	finalise := false
 
 	var rumor *Rumor
+	// compacts are the compact rumors received before the message, their
+	// signatures are added once it is known
+	var compacts []CompactRumorMessage
 
 	// The root must wait for Start() to have been called.
 	if p.IsRoot() {
@@ -147,29 +242,80 @@ func (p *BlsCosi) Dispatch() error {
 			return errors.New("timeout, did you forget to call Start?")
 		}
 	} else {
-		select {
-		case rumorMsg := <-p.RumorsChan:
-			rumor = &rumorMsg.Rumor
-			p.Params = rumor.Params
-			// Copy bytes due to the way protobuf allows the bytes to be
-			// shared with the underlying buffer
-			p.Msg = rumor.Msg[:]
-		case shutdownMsg := <-p.ShutdownChan:
-			p.Params = shutdownMsg.Params
-			p.Msg = shutdownMsg.Msg[:]
-			log.Lvl5("Received shutdown")
-			if err := p.verifyShutdown(shutdownMsg); err == nil {
-				shutdownStruct = shutdownMsg.Shutdown
+		// A compact message can only be used once we have the message, which
+		// is then fetched from its sender.
+		var wantHash, wantDigest []byte
+		waiting := true
+		for waiting {
+			waiting = false
+			select {
+			case rumorMsg := <-p.RumorsChan:
+				p.traffic.countReceived(&rumorMsg.Rumor)
+				p.hasMessage(rumorMsg.TreeNode)
+				rumor = &rumorMsg.Rumor
+				p.Params = rumor.Params
+				// Copy bytes due to the way protobuf allows the bytes to be
+				// shared with the underlying buffer
+				p.Msg = rumor.Msg[:]
+			case shutdownMsg := <-p.ShutdownChan:
+				p.traffic.countReceived(&shutdownMsg.Shutdown)
+				p.hasMessage(shutdownMsg.TreeNode)
+				p.Params = shutdownMsg.Params
+				p.Msg = shutdownMsg.Msg[:]
+				log.Lvl5("Received shutdown")
+				if err := p.verifyShutdown(shutdownMsg); err == nil {
+					p.recordShutdown(shutdownMsg.Shutdown)
+					shutdownStruct = shutdownMsg.Shutdown
+					shutdown = true
+				} else {
+					log.Lvl1("Got first spoofed shutdown:", err)
+					// Don't take any action
+				}
+			case compact := <-p.CompactRumorsChan:
+				p.traffic.countReceived(&compact.CompactRumor)
+				compacts = append(compacts, compact)
+				wantHash, wantDigest = compact.Hash, compact.ParamsDigest
+				p.requestMessage(compact.TreeNode, wantHash, wantDigest)
+				waiting = true
+			case compact := <-p.CompactShutdownChan:
+				p.traffic.countReceived(&compact.CompactShutdown)
+				wantHash, wantDigest = compact.Hash, compact.ParamsDigest
+				p.requestMessage(compact.TreeNode, wantHash, wantDigest)
+				waiting = true
+			case reply := <-p.MessageReplyChan:
+				p.traffic.countReceived(&reply.MessageReply)
+				if err := p.checkReply(reply, wantHash, wantDigest); err != nil {
+					log.Lvl1("Got a wrong message:", err)
+					waiting = true
+					continue
+				}
+				p.hasMessage(reply.TreeNode)
+				p.Params = reply.Params
+				p.Msg = reply.Msg[:]
+			case takeover := <-p.TakeoverChan:
+				p.traffic.countReceived(&takeover.Takeover)
+				p.handleTakeover(takeover)
+				waiting = true
+			case abortMsg := <-p.AbortChan:
+				p.traffic.countReceived(&abortMsg.Abort)
+				if err := p.verifyAbort(abortMsg); err != nil {
+					// keep waiting for the announcement
+					log.Lvl1("Got spoofed abort:", err)
+					waiting = true
+					continue
+				}
+				log.Lvl3(p.ServerIdentity(), "aborts the round before joining it")
+				p.setAborted()
+				return nil
+			case <-protocolTimeout:
 				shutdown = true
-			} else {
-				log.Lvl1("Got first spoofed shutdown:", err)
-				// Don't take any action
+				done = true
 			}
-		case <-protocolTimeout:
-			shutdown = true
-			done = true
 		}
 	}
+	if err := p.setDigests(); err != nil {
+		return err
+	}
 
 	// responses is a map where we collect all signatures.
 	var responses Responses
@@ -189,36 +335,78 @@ func (p *BlsCosi) Dispatch() error {
 	if err != nil {
 		return err
 	}
+	p.setProgress(responses)
 
 	if rumor != nil {
 		err = responses.Update(rumor.ResponseMap)
 		if err != nil {
 			return err
 		}
+		p.setProgress(responses)
 		log.Lvlf5("Incoming first rumor, %d known, %d needed",
 			responses.Count(), p.Threshold)
+		if p.canFinalise() && p.isEnough(responses) {
+			shutdown = true
+			finalise = true
+		}
+	}
+	for _, compact := range compacts {
+		if shutdown {
+			break
+		}
+		p.hasMessage(compact.TreeNode)
+		if !p.matches(compact.Hash, compact.ParamsDigest) {
+			log.Lvl1("Got a compact rumor for another message")
+			continue
+		}
+		enough, err := p.handleRumor(responses, compact.TreeNode, compact.ResponseMap)
+		if err != nil {
+			return err
+		}
+		if enough {
+			shutdown = true
+			finalise = true
+		}
 	}
 
-	ticker := time.NewTicker(p.Params.GossipTick)
+	p.pace = newGossipPace(p.Params, len(p.Publics()))
+	ticker := time.NewTicker(p.pace.tick)
 	for !shutdown {
 		select {
 		case rumor := <-p.RumorsChan:
-			err = responses.Update(rumor.ResponseMap)
+			p.traffic.countReceived(&rumor.Rumor)
+			p.hasMessage(rumor.TreeNode)
+			enough, err := p.handleRumor(responses, rumor.TreeNode, rumor.ResponseMap)
 			if err != nil {
 				return err
 			}
-			log.Lvlf5("Incoming rumor, %d known, %d needed, is-root %v",
-				responses.Count(), p.Threshold, p.IsRoot())
-			if p.IsRoot() && p.isEnough(responses) {
+			if enough {
 				// We've got all the signatures.
-				//res := responses.(TreeResponses)
-				//log.Lvl5("Got all the signatures",
-				//	res.mask.CountEnabled(), res.responses, res.mask.Mask())
 				shutdown = true
+				finalise = true
+			}
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.hasMessage(compact.TreeNode)
+			if !p.matches(compact.Hash, compact.ParamsDigest) {
+				log.Lvl1("Got a compact rumor for another message")
+				continue
+			}
+			enough, err := p.handleRumor(responses, compact.TreeNode, compact.ResponseMap)
+			if err != nil {
+				return err
+			}
+			if enough {
+				// We've got all the signatures.
+				shutdown = true
+				finalise = true
 			}
 		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
+			p.hasMessage(shutdownMsg.TreeNode)
 			log.Lvl5("Received shutdown")
 			if err := p.verifyShutdown(shutdownMsg); err == nil {
+				p.recordShutdown(shutdownMsg.Shutdown)
 				shutdownStruct = shutdownMsg.Shutdown
 				shutdown = true
 			} else {
@@ -226,9 +414,61 @@ func (p *BlsCosi) Dispatch() error {
 				log.Lvl3("Length was:", len(shutdownMsg.FinalCoSignature))
 				// Don't take any action
 			}
+		case compact := <-p.CompactShutdownChan:
+			p.traffic.countReceived(&compact.CompactShutdown)
+			p.hasMessage(compact.TreeNode)
+			if !p.matches(compact.Hash, compact.ParamsDigest) {
+				log.Lvl1("Got a compact shutdown for another message")
+				continue
+			}
+			shutdownMsg := p.expandShutdown(compact)
+			if err := p.verifyShutdown(shutdownMsg); err == nil {
+				p.recordShutdown(shutdownMsg.Shutdown)
+				shutdownStruct = shutdownMsg.Shutdown
+				shutdown = true
+			} else {
+				log.Lvl1("Got spoofed shutdown:", err)
+			}
+		case req := <-p.MessageRequestChan:
+			p.traffic.countReceived(&req.MessageRequest)
+			p.replyMessage(req)
+		case reply := <-p.MessageReplyChan:
+			// we already have the message
+			p.traffic.countReceived(&reply.MessageReply)
+		case takeover := <-p.TakeoverChan:
+			p.traffic.countReceived(&takeover.Takeover)
+			p.handleTakeover(takeover)
+			if p.canFinalise() && p.isEnough(responses) {
+				shutdown = true
+				finalise = true
+			}
+		case abortMsg := <-p.AbortChan:
+			p.traffic.countReceived(&abortMsg.Abort)
+			if err := p.verifyAbort(abortMsg); err == nil {
+				p.setAborted()
+				shutdown = true
+			} else {
+				log.Lvl1("Got spoofed abort:", err)
+			}
+		case <-p.cancelChan:
+			if p.IsRoot() {
+				p.sendAborts()
+				p.setAborted()
+				shutdown = true
+			}
 		case <-ticker.C:
 			log.Lvl5("Outgoing rumor")
 			p.sendRumors(responses)
+			if p.pace.update(responses.Count()) {
+				ticker.Stop()
+				ticker = time.NewTicker(p.pace.tick)
+			}
+			p.tickLeader()
+			if p.canFinalise() && p.isEnough(responses) {
+				// The previous leader is gone and we can finish the round.
+				shutdown = true
+				finalise = true
+			}
 		case <-protocolTimeout:
 			shutdown = true
 			done = true
@@ -237,31 +477,28 @@ func (p *BlsCosi) Dispatch() error {
 	log.Lvl5("Done with gossiping")
 	ticker.Stop()
 
-	if p.IsRoot() {
-		log.Lvl3(p.ServerIdentity().Address, "collected all signature responses")
+	// An aborted round stops right away, without a final signature.
+	if p.Aborted() {
+		log.Lvl3(p.ServerIdentity(), "stops the aborted round")
+		return nil
+	}
 
-		log.Lvlf3("%v is aggregating signatures", p.ServerIdentity())
-		// generate root signature
-		signaturePoint, finalMask, err := responses.Aggregate(p.suite, p.Publics())
-		if err != nil {
-			return err
-		}
+	// The root creates the final signature with what it has if nobody else
+	// did, as it must reply to the client.
+	if p.IsRoot() && shutdownStruct.FinalCoSignature == nil {
+		finalise = true
+	}
 
-		signature, err := signaturePoint.MarshalBinary()
+	if finalise {
+		log.Lvl3(p.ServerIdentity().Address, "collected all signature responses")
+		shutdownStruct, err = p.finalise(responses)
 		if err != nil {
 			return err
 		}
+	}
 
-		finalSig := append(signature, finalMask.Mask()...)
-		log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), signature, finalMask.Mask())
-		p.FinalSignature <- finalSig
-
-		// Sign shutdown message
-		rootSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
-		if err != nil {
-			return err
-		}
-		shutdownStruct = Shutdown{p.Params, finalSig, rootSig, p.Msg}
+	if p.IsRoot() || shutdownStruct.FinalCoSignature != nil {
+		p.FinalSignature <- shutdownStruct.FinalCoSignature
 	}
 
 	p.sendShutdowns(shutdownStruct)
@@ -272,10 +509,31 @@ func (p *BlsCosi) Dispatch() error {
 	for !done {
 		select {
 		case rumor := <-p.RumorsChan:
+			p.traffic.countReceived(&rumor.Rumor)
+			p.hasMessage(rumor.TreeNode)
 			sender := rumor.TreeNode
 			log.Lvl5("Responding to rumor with shutdown", sender.Equal(p.TreeNode()))
 			p.sendShutdown(sender, shutdownStruct)
-		case <-p.ShutdownChan:
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.hasMessage(compact.TreeNode)
+			p.sendShutdown(compact.TreeNode, shutdownStruct)
+		case req := <-p.MessageRequestChan:
+			p.traffic.countReceived(&req.MessageRequest)
+			p.replyMessage(req)
+		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
+			p.recordTreeShutdown(shutdownMsg)
+		case compact := <-p.CompactShutdownChan:
+			p.traffic.countReceived(&compact.CompactShutdown)
+			if p.matches(compact.Hash, compact.ParamsDigest) {
+				p.recordTreeShutdown(p.expandShutdown(compact))
+			}
+		case reply := <-p.MessageReplyChan:
+			p.traffic.countReceived(&reply.MessageReply)
+			// ignore
+		case takeover := <-p.TakeoverChan:
+			p.traffic.countReceived(&takeover.Takeover)
 			// ignore
 		case <-protocolTimeout:
 			done = true
@@ -286,6 +544,106 @@ func (p *BlsCosi) Dispatch() error {
 	return nil
 }
 
+// finalise aggregates the responses into the final signature and creates the
+// shutdown message proving it.
+func (p *BlsCosi) finalise(responses Responses) (Shutdown, error) {
+	log.Lvlf3("%v is aggregating signatures", p.ServerIdentity())
+	signaturePoint, finalMask, err := responses.Aggregate(p.suite, p.Publics())
+	if err != nil {
+		return Shutdown{}, err
+	}
+
+	signature, err := signaturePoint.MarshalBinary()
+	if err != nil {
+		return Shutdown{}, err
+	}
+
+	finalSig := append(signature, finalMask.Mask()...)
+	log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), signature, finalMask.Mask())
+
+	// Sign shutdown message
+	signerSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
+	if err != nil {
+		return Shutdown{}, err
+	}
+	p.recordFinalised()
+	return Shutdown{p.Params, finalSig, signerSig, p.Msg, uint32(p.TreeNode().RosterIndex), p.takeover, false}, nil
+}
+
+// Progress returns the number of signers known by this node and their mask.
+// It can be called while the protocol runs.
+func (p *BlsCosi) Progress() (int, []byte) {
+	p.progressLock.Lock()
+	defer p.progressLock.Unlock()
+	count := 0
+	for _, b := range p.progress {
+		for ; b != 0; b &= b - 1 {
+			count++
+		}
+	}
+	return count, append([]byte{}, p.progress...)
+}
+
+// setProgress merges the masks of the responses as the current progress and
+// notifies the root's listener if the aggregate grew.
+func (p *BlsCosi) setProgress(responses Responses) {
+	progress := signersMask(responses, len(p.Publics()))
+	p.progressLock.Lock()
+	p.progress = progress
+	p.progressLock.Unlock()
+
+	if !p.IsRoot() || p.ProgressChan == nil || responses.Count() <= p.lastSigners {
+		return
+	}
+	p.lastSigners = responses.Count()
+	update, err := p.partialAggregate(responses)
+	if err != nil {
+		log.Lvl2("Couldn't aggregate the partial signature:", err)
+		return
+	}
+	select {
+	case p.ProgressChan <- update:
+	default:
+		log.Lvl3("Dropping a progress update")
+	}
+}
+
+// partialAggregate aggregates the responses known so far.
+func (p *BlsCosi) partialAggregate(responses Responses) (RoundProgress, error) {
+	point, mask, err := responses.Aggregate(p.suite, p.Publics())
+	if err != nil {
+		return RoundProgress{}, err
+	}
+	sig, err := point.MarshalBinary()
+	if err != nil {
+		return RoundProgress{}, err
+	}
+	return RoundProgress{
+		Signers:   mask.CountEnabled(),
+		Mask:      mask.Mask(),
+		Aggregate: append(sig, mask.Mask()...),
+	}, nil
+}
+
+// handleRumor merges the responses of a rumor and returns true if this node
+// can now create the final signature.
+func (p *BlsCosi) handleRumor(responses Responses, sender *onet.TreeNode, responseMap map[uint32](*Response)) (bool, error) {
+	p.heardFrom(sender)
+	if err := responses.Update(responseMap); err != nil {
+		return false, err
+	}
+	p.setProgress(responses)
+	log.Lvlf5("Incoming rumor, %d known, %d needed, is-root %v",
+		responses.Count(), p.Threshold, p.IsRoot())
+	return p.canFinalise() && p.isEnough(responses), nil
+}
+
+// canFinalise returns true if this node is allowed to create the final
+// signature, which is only the leader unless the protocol is leaderless.
+func (p *BlsCosi) canFinalise() bool {
+	return p.isLeader() || p.Params.Leaderless
+}
+
 func (p *BlsCosi) trySign(responses Responses) error {
 	if !p.verificationFn(p.Msg, p.Data) {
 		log.Lvlf4("Node %v refused to sign", p.ServerIdentity())
@@ -300,9 +658,10 @@ func (p *BlsCosi) trySign(responses Responses) error {
 	return nil
 }
 
-// sendRumors sends a rumor message to some peers.
+// sendRumors sends a rumor message to some peers, as many as the current
+// fanout.
 func (p *BlsCosi) sendRumors(responses Responses) {
-	targets, err := p.getRandomPeers(p.Params.RumorPeers)
+	targets, err := p.getRandomPeers(p.pace.peers)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers:", err)
 		return
@@ -313,13 +672,22 @@ func (p *BlsCosi) sendRumors(responses Responses) {
 	}
 }
 
-// sendRumor sends the given signatures to a random peer.
+// sendRumor sends the given signatures to a random peer. A leader that can't
+// be reached gets a vote for its replacement.
 func (p *BlsCosi) sendRumor(target *onet.TreeNode, responses Responses) {
-	p.SendTo(target, &Rumor{p.Params, responses.Map(), p.Msg})
+	err := p.sendTo(target, p.rumorFor(target, responses))
+	if err != nil && !p.isLeader() && target.RosterIndex == p.leaderIndex() {
+		log.Lvl2("Couldn't reach the leader:", err)
+		p.leaderGone()
+	}
 }
 
-// sendShutdowns sends a shutdown message to some random peers.
+// sendShutdowns sends a shutdown message to some random peers, and to the
+// children of the node in the dissemination tree if there is one.
 func (p *BlsCosi) sendShutdowns(shutdown Shutdown) {
+	if p.Params.ShutdownTree && shutdown.FinalCoSignature != nil {
+		p.sendShutdownTree(shutdown, p.TreeNode().RosterIndex)
+	}
 	targets, err := p.getRandomPeers(p.Params.ShutdownPeers)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers for shutdown:", err)
@@ -333,7 +701,8 @@ func (p *BlsCosi) sendShutdowns(shutdown Shutdown) {
 
 // sendShutdown sends a shutdown message to a single peer.
 func (p *BlsCosi) sendShutdown(target *onet.TreeNode, shutdown Shutdown) {
-	p.SendTo(target, &shutdown)
+	shutdown.Tree = false
+	p.sendTo(target, p.shutdownFor(target, &shutdown))
 }
 
 // verifyShutdown verifies the legitimacy of a shutdown message.
@@ -341,17 +710,72 @@ func (p *BlsCosi) verifyShutdown(msg ShutdownMessage) error {
 	if len(p.Publics()) == 0 {
 		return errors.New("Roster is empty")
 	}
-	rootPublic := p.Publics()[0]
+	signer := int(msg.Signer)
+	if signer >= len(p.Publics()) {
+		return errors.New("unknown signer of the shutdown")
+	}
+	term := 0
+	if msg.Takeover != nil {
+		if err := p.verifyTakeover(msg.Takeover); err != nil {
+			return err
+		}
+		term = int(msg.Takeover.Term)
+	}
+	if !p.Params.Leaderless && signer != p.leaderOf(term) {
+		return errors.New("shutdown not signed by the leader of its term")
+	}
+	signerKey := p.Publics()[signer]
 	finalSig := msg.FinalCoSignature
 
 	// verify final signature
-	err := msg.FinalCoSignature.VerifyAggregate(p.suite, p.Msg, p.Publics())
+	err := msg.FinalCoSignature.VerifyAggregateWithPolicy(p.suite, p.Msg, p.Publics(),
+		p.Params.SignPolicy(len(p.Publics()), p.Threshold))
 	if err != nil {
 		return err
 	}
 
-	// verify root signature of final signature
-	return verify(p.suite, msg.RootSig, finalSig, rootPublic)
+	// verify the signature of the final signature by its creator
+	return verify(p.suite, msg.RootSig, finalSig, signerKey)
+}
+
+// sendAborts signs the abort message of the round and sends it to every
+// other node. The tree is a star so they are all children of the root.
+func (p *BlsCosi) sendAborts() {
+	sig, err := bdn.Sign(p.suite, p.Private(), p.abortMessage())
+	if err != nil {
+		log.Error("Couldn't sign abort message:", err)
+		return
+	}
+	log.Lvl3(p.ServerIdentity(), "aborts the round")
+	for _, child := range p.Children() {
+		if err := p.sendTo(child, &Abort{sig}); err != nil {
+			log.Lvl2("Couldn't send abort:", err)
+		}
+	}
+}
+
+// verifyAbort verifies that the abort message has been signed by the root.
+func (p *BlsCosi) verifyAbort(msg AbortMessage) error {
+	return verify(p.suite, msg.RootSig, p.abortMessage(), rootPublic(p.TreeNodeInstance))
+}
+
+// abortMessage is the message signed by the root to abort the round. It
+// contains the round ID of the instance so that it can't be replayed.
+func (p *BlsCosi) abortMessage() []byte {
+	return []byte("abort round " + p.Token().RoundID.String())
+}
+
+// setAborted records that the round has been aborted.
+func (p *BlsCosi) setAborted() {
+	p.abortLock.Lock()
+	p.aborted = true
+	p.abortLock.Unlock()
+}
+
+// rootPublic returns the public key of the root. The roster of the tree is in
+// the order of the client, so the root isn't necessarily the first node.
+func rootPublic(n *onet.TreeNodeInstance) kyber.Point {
+	return n.Publics()[n.Root().RosterIndex]
 }
 
 // verify checks the signature over the message with a single key
@@ -369,15 +793,22 @@ func verify(suite pairing.Suite, sig []byte, msg []byte, public kyber.Point) err
 	return nil
 }
 
-// isEnough returns true if we have enough responses.
+// isEnough returns true if we have enough responses, or responses of enough
+// weight if the parameters have a weight threshold.
 func (p *BlsCosi) isEnough(responses Responses) bool {
-	return responses.Count() >= p.Threshold
+	return enough(p.Params, p.Threshold, responses, len(p.Publics()))
 }
 
 // getRandomPeers returns a slice of random peers (not including self).
 func (p *BlsCosi) getRandomPeers(numTargets int) ([]*onet.TreeNode, error) {
-	self := p.TreeNode()
-	root := p.Root()
+	return getRandomPeers(p.TreeNodeInstance, numTargets)
+}
+
+// getRandomPeers returns a slice of random peers of the star tree of n (not
+// including n itself).
+func getRandomPeers(n *onet.TreeNodeInstance, numTargets int) ([]*onet.TreeNode, error) {
+	self := n.TreeNode()
+	root := n.Root()
 	allNodes := append(root.Children, root)
 
 	numPeers := len(allNodes) - 1
@@ -437,6 +868,14 @@ func (p *BlsCosi) checkIntegrity() error {
 	if p.Threshold < 1 {
 		return fmt.Errorf("threshold of %d smaller than one node", p.Threshold)
 	}
+	if p.Params.WeightThreshold > 0 && len(p.Params.Weights) != len(p.Publics()) {
+		return fmt.Errorf("%d weights for %d nodes", len(p.Params.Weights), len(p.Publics()))
+	}
+	if p.Params.Policy != nil {
+		if err := p.Params.Policy.Validate(len(p.Publics())); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -450,8 +889,14 @@ func (p *BlsCosi) checkFailureThreshold(numFailure int) bool {
 // Sign the message and pack it with the mask as a response
 // idx is this node's index
 func (p *BlsCosi) makeResponse() (*Response, int, error) {
-	mask, err := sign.NewMask(p.suite, p.Publics(), p.Public())
-	log.Lvl2("signing with", p.Public())
+	return makeResponse(p.TreeNodeInstance, p.suite, p.Msg)
+}
+
+// makeResponse signs msg with the key of n and packs it with the mask as a
+// response. idx is the index of n.
+func makeResponse(n *onet.TreeNodeInstance, suite pairing.Suite, msg []byte) (*Response, int, error) {
+	mask, err := sign.NewMask(suite, n.Publics(), n.Public())
+	log.Lvl2("signing with", n.Public())
 	if err != nil {
 		return nil, 0, err
 	}
@@ -461,7 +906,7 @@ func (p *BlsCosi) makeResponse() (*Response, int, error) {
 		return nil, 0, errors.New("Couldn't find own index")
 	}
 
-	sig, err := bdn.Sign(p.suite, p.Private(), p.Msg)
+	sig, err := bdn.Sign(suite, n.Private(), msg)
 	if err != nil {
 		return nil, 0, err
 	}
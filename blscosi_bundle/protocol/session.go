@@ -0,0 +1,460 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+)
+
+// defaultIdleTimeout is the time a session stays alive without any round.
+const defaultIdleTimeout = 30 * time.Second
+
+// keptShutdowns is the number of past rounds for which a node still answers
+// late rumors with the shutdown of the round.
+const keptShutdowns = 8
+
+// SessionSignature is the final signature of one round of a session.
+type SessionSignature struct {
+	Round     uint32
+	Msg       []byte
+	Signature BlsSignature
+}
+
+// sessionRound is the state of a node for the round being signed.
+type sessionRound struct {
+	number    uint32
+	msg       []byte
+	responses Responses
+}
+
+// BlsCosiSession signs a sequence of messages with a single protocol
+// instance. The rounds are pipelined: the root starts round k+1 as soon as
+// round k is final, and the first rumor of round k+1 travels along the
+// shutdown of round k.
+// This protocol exists on all nodes.
+type BlsCosiSession struct {
+	*onet.TreeNodeInstance
+	Threshold int
+	Params    Parameters
+	// IdleTimeout is the time after which a node leaves the session if it
+	// hasn't seen any new round.
+	IdleTimeout time.Duration
+	// Messages is used by the root to receive the messages to sign. Closing
+	// it ends the session once the queued messages are signed.
+	Messages chan []byte
+	// FinalSignatures gets the final signatures of the root, in order.
+	FinalSignatures chan SessionSignature
+	// Closed is closed when the session ends on this node.
+	Closed chan bool
+
+	stoppedOnce    sync.Once
+	startChan      chan bool
+	verificationFn VerificationFn
+	suite          *pairing.SuiteBn256
+
+	current   *sessionRound
+	queue     [][]byte
+	nextRound uint32
+	shutdowns map[uint32]*SessionShutdown
+	// pace is the tick and fanout of the gossip, renewed with every round
+	pace *gossipPace
+
+	// internodes channels
+	RumorsChan   chan SessionRumorMessage
+	ShutdownChan chan SessionShutdownMessage
+	CloseChan    chan SessionCloseMessage
+}
+
+// NewDefaultSessionProtocol is the session protocol with an always-true
+// verification.
+func NewDefaultSessionProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	vf := func(a, b []byte) bool { return true }
+	return NewBlsCosiSession(n, vf, pairing.NewSuiteBn256())
+}
+
+// NewBlsCosiSession method is used to define the session protocol.
+func NewBlsCosiSession(n *onet.TreeNodeInstance, vf VerificationFn, suite *pairing.SuiteBn256) (onet.ProtocolInstance, error) {
+	c := &BlsCosiSession{
+		TreeNodeInstance: n,
+		Threshold:        DefaultThreshold(len(n.Roster().List)),
+		Params:           DefaultParams(),
+		IdleTimeout:      defaultIdleTimeout,
+		Messages:         make(chan []byte, 64),
+		FinalSignatures:  make(chan SessionSignature, 64),
+		Closed:           make(chan bool),
+		startChan:        make(chan bool, 1),
+		verificationFn:   vf,
+		suite:            suite,
+		shutdowns:        make(map[uint32]*SessionShutdown),
+	}
+
+	err := c.RegisterChannels(&c.RumorsChan, &c.ShutdownChan, &c.CloseChan)
+	if err != nil {
+		return nil, errors.New("couldn't register channels: " + err.Error())
+	}
+
+	return c, nil
+}
+
+// Shutdown stops the protocol
+func (p *BlsCosiSession) Shutdown() error {
+	p.stoppedOnce.Do(func() {
+		close(p.startChan)
+		close(p.FinalSignatures)
+		close(p.Closed)
+	})
+	return nil
+}
+
+// Start is done only by root and opens the session.
+func (p *BlsCosiSession) Start() error {
+	if p.verificationFn == nil {
+		p.Done()
+		return errors.New("verification function cannot be nil")
+	}
+	if p.Threshold > p.Tree().Size() || p.Threshold < 1 {
+		p.Done()
+		return errors.New("invalid threshold")
+	}
+
+	log.Lvlf3("Starting BLS CoSi session on %v", p.ServerIdentity())
+	p.startChan <- true
+	return nil
+}
+
+// Dispatch is the main method of the protocol for all nodes. It runs one
+// round after the other until the session is closed or idle.
+func (p *BlsCosiSession) Dispatch() error {
+	defer p.Done()
+
+	messages := p.Messages
+	if p.IsRoot() {
+		select {
+		case _, ok := <-p.startChan:
+			if !ok {
+				return errors.New("protocol finished prematurely")
+			}
+		case <-time.After(time.Second):
+			return errors.New("timeout, did you forget to call Start?")
+		}
+	} else {
+		// only the root receives messages to sign
+		messages = nil
+	}
+
+	idle := time.NewTimer(p.IdleTimeout)
+	defer idle.Stop()
+	p.pace = newGossipPace(p.Params, len(p.Publics()))
+	tick := p.pace.tick
+	ticker := time.NewTicker(tick)
+	defer func() { ticker.Stop() }()
+
+	closing := false
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				// sign what is left before closing
+				closing = true
+				messages = nil
+				break
+			}
+			p.queue = append(p.queue, msg)
+			if p.current == nil {
+				if err := p.startNextRound(); err != nil {
+					return err
+				}
+			}
+		case rumor := <-p.RumorsChan:
+			if err := p.handleRumor(rumor); err != nil {
+				return err
+			}
+		case shutdown := <-p.ShutdownChan:
+			if err := p.handleShutdown(shutdown); err != nil {
+				return err
+			}
+		case closeMsg := <-p.CloseChan:
+			if err := p.verifyClose(closeMsg.SessionClose); err != nil {
+				log.Lvl1("Got spoofed close:", err)
+				continue
+			}
+			p.sendCloseTo(closeMsg.SessionClose)
+			return nil
+		case <-ticker.C:
+			if p.current != nil {
+				p.sendRumors()
+				p.pace.update(p.current.responses.Count())
+			}
+			if p.pace.tick != tick {
+				tick = p.pace.tick
+				ticker.Stop()
+				ticker = time.NewTicker(tick)
+			}
+			continue
+		case <-idle.C:
+			log.Lvl3(p.ServerIdentity(), "leaves the idle session")
+			return nil
+		}
+		if closing && p.current == nil && len(p.queue) == 0 {
+			p.sendClose()
+			return nil
+		}
+		idle.Reset(p.IdleTimeout)
+	}
+}
+
+// startNextRound makes the root start signing the next queued message.
+func (p *BlsCosiSession) startNextRound() error {
+	if len(p.queue) == 0 {
+		p.current = nil
+		return nil
+	}
+	msg := p.queue[0]
+	p.queue = p.queue[1:]
+	err := p.startRound(p.nextRound, msg)
+	p.nextRound++
+	return err
+}
+
+// startRound resets the state of the node for the given round and adds its
+// own signature.
+func (p *BlsCosiSession) startRound(number uint32, msg []byte) error {
+	responses, err := p.newResponses()
+	if err != nil {
+		return err
+	}
+	p.current = &sessionRound{number, msg, responses}
+	p.pace = newGossipPace(p.Params, len(p.Publics()))
+	log.Lvlf4("%v starts round %d", p.ServerIdentity(), number)
+
+	if !p.verificationFn(msg, nil) {
+		log.Lvlf4("Node %v refused to sign", p.ServerIdentity())
+		return nil
+	}
+	own, idx, err := makeResponse(p.TreeNodeInstance, p.suite, msg)
+	if err != nil {
+		return err
+	}
+	return responses.Add(idx, own)
+}
+
+func (p *BlsCosiSession) newResponses() (Responses, error) {
+	if p.Params.TreeMode {
+		return NewTreeResponses(p.suite, p.Publics())
+	}
+	return make(SimpleResponses), nil
+}
+
+// handleRumor updates the current round, starts a new one or answers with
+// the shutdown of a finished round.
+func (p *BlsCosiSession) handleRumor(rumor SessionRumorMessage) error {
+	if shutdown, ok := p.shutdowns[rumor.Round]; ok {
+		p.sendShutdown(rumor.TreeNode, *shutdown)
+		return nil
+	}
+	return p.updateRound(&rumor.SessionRumor)
+}
+
+// updateRound merges the responses of a rumor into the current round.
+func (p *BlsCosiSession) updateRound(rumor *SessionRumor) error {
+	if p.current == nil || rumor.Round > p.current.number {
+		if p.IsRoot() {
+			// only the root can start rounds
+			return nil
+		}
+		p.Params = rumor.Params
+		if err := p.startRound(rumor.Round, rumor.Msg[:]); err != nil {
+			return err
+		}
+	}
+	if rumor.Round != p.current.number {
+		return nil
+	}
+
+	if err := p.current.responses.Update(rumor.ResponseMap); err != nil {
+		return err
+	}
+	log.Lvlf5("Incoming rumor for round %d, %d known, %d needed",
+		rumor.Round, p.current.responses.Count(), p.Threshold)
+	if p.IsRoot() && enough(p.Params, p.Threshold, p.current.responses, len(p.Publics())) {
+		return p.finishRound()
+	}
+	return nil
+}
+
+// finishRound is done by the root and creates the final signature of the
+// current round. The next round is started right away so that its first
+// rumor can be sent along the shutdown.
+func (p *BlsCosiSession) finishRound() error {
+	round := p.current
+	signaturePoint, finalMask, err := round.responses.Aggregate(p.suite, p.Publics())
+	if err != nil {
+		return err
+	}
+	signature, err := signaturePoint.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	finalSig := append(signature, finalMask.Mask()...)
+	log.Lvlf3("%v created final signature of round %d", p.ServerIdentity(), round.number)
+	p.FinalSignatures <- SessionSignature{round.number, round.msg, finalSig}
+
+	rootSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
+	if err != nil {
+		return err
+	}
+	shutdown := &SessionShutdown{
+		Round:            round.number,
+		Params:           p.Params,
+		FinalCoSignature: finalSig,
+		RootSig:          rootSig,
+		Msg:              round.msg,
+	}
+	p.keepShutdown(shutdown)
+
+	if err := p.startNextRound(); err != nil {
+		return err
+	}
+	p.sendShutdowns(*shutdown)
+	return nil
+}
+
+// handleShutdown finishes the round of the shutdown and starts the next one
+// if the shutdown carries it.
+func (p *BlsCosiSession) handleShutdown(msg SessionShutdownMessage) error {
+	if _, ok := p.shutdowns[msg.Round]; ok {
+		// already known, only take the piggybacked rumor
+		if msg.Next != nil {
+			return p.updateRound(msg.Next)
+		}
+		return nil
+	}
+	if err := p.verifyShutdown(msg.SessionShutdown); err != nil {
+		log.Lvl1("Got spoofed shutdown:", err)
+		return nil
+	}
+
+	shutdown := msg.SessionShutdown
+	shutdown.Next = nil
+	p.keepShutdown(&shutdown)
+	if p.current != nil && p.current.number <= shutdown.Round {
+		p.current = nil
+	}
+	if msg.Next != nil {
+		if err := p.updateRound(msg.Next); err != nil {
+			return err
+		}
+	}
+	p.sendShutdowns(shutdown)
+	return nil
+}
+
+// keepShutdown remembers the shutdown of a round to answer late rumors.
+func (p *BlsCosiSession) keepShutdown(shutdown *SessionShutdown) {
+	p.shutdowns[shutdown.Round] = shutdown
+	for round := range p.shutdowns {
+		if round+keptShutdowns < shutdown.Round {
+			delete(p.shutdowns, round)
+		}
+	}
+}
+
+// sendRumors sends the responses of the current round to some peers.
+func (p *BlsCosiSession) sendRumors() {
+	targets, err := getRandomPeers(p.TreeNodeInstance, p.pace.peers)
+	if err != nil {
+		log.Lvl1("Couldn't get random peers:", err)
+		return
+	}
+	for _, target := range targets {
+		p.SendTo(target, p.currentRumor())
+	}
+}
+
+func (p *BlsCosiSession) currentRumor() *SessionRumor {
+	return &SessionRumor{
+		Round:       p.current.number,
+		Params:      p.Params,
+		ResponseMap: p.current.responses.Map(),
+		Msg:         p.current.msg,
+	}
+}
+
+// sendShutdowns sends a shutdown message to some random peers.
+func (p *BlsCosiSession) sendShutdowns(shutdown SessionShutdown) {
+	targets, err := getRandomPeers(p.TreeNodeInstance, p.Params.ShutdownPeers)
+	if err != nil {
+		log.Lvl1("Couldn't get random peers for shutdown:", err)
+		return
+	}
+	for _, target := range targets {
+		p.sendShutdown(target, shutdown)
+	}
+}
+
+// sendShutdown sends a shutdown message to a single peer, with the responses
+// of the next round if this node is already signing it.
+func (p *BlsCosiSession) sendShutdown(target *onet.TreeNode, shutdown SessionShutdown) {
+	if p.current != nil && p.current.number > shutdown.Round {
+		shutdown.Next = p.currentRumor()
+	}
+	p.SendTo(target, &shutdown)
+}
+
+// verifyShutdown verifies the legitimacy of a shutdown message.
+func (p *BlsCosiSession) verifyShutdown(shutdown SessionShutdown) error {
+	if len(p.Publics()) == 0 {
+		return errors.New("Roster is empty")
+	}
+	err := shutdown.FinalCoSignature.VerifyAggregateWithPolicy(p.suite, shutdown.Msg, p.Publics(),
+		p.Params.SignPolicy(len(p.Publics()), p.Threshold))
+	if err != nil {
+		return err
+	}
+	return verify(p.suite, shutdown.RootSig, shutdown.FinalCoSignature, rootPublic(p.TreeNodeInstance))
+}
+
+// sendClose is done by the root to end the session on every node.
+func (p *BlsCosiSession) sendClose() {
+	sig, err := bdn.Sign(p.suite, p.Private(), p.closeMessage(p.nextRound))
+	if err != nil {
+		log.Error("Couldn't sign close message:", err)
+		return
+	}
+	p.sendCloseTo(SessionClose{p.nextRound, sig})
+}
+
+// sendCloseTo forwards a close message to some random peers.
+func (p *BlsCosiSession) sendCloseTo(closeMsg SessionClose) {
+	targets, err := getRandomPeers(p.TreeNodeInstance, p.Params.ShutdownPeers)
+	if err != nil {
+		log.Lvl1("Couldn't get random peers for close:", err)
+		return
+	}
+	for _, target := range targets {
+		p.SendTo(target, &closeMsg)
+	}
+}
+
+// verifyClose checks that the close message has been signed by the root.
+func (p *BlsCosiSession) verifyClose(closeMsg SessionClose) error {
+	if len(p.Publics()) == 0 {
+		return errors.New("Roster is empty")
+	}
+	return verify(p.suite, closeMsg.RootSig, p.closeMessage(closeMsg.Rounds), rootPublic(p.TreeNodeInstance))
+}
+
+// closeMessage is the message signed by the root to close a session. It
+// contains the round ID of the instance so that it can't be replayed.
+func (p *BlsCosiSession) closeMessage(rounds uint32) []byte {
+	msg := []byte("close session " + p.Token().RoundID.String())
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], rounds)
+	return append(msg, buf[:]...)
+}
@@ -2,18 +2,32 @@ package protocol
 
 import (
 	"errors"
-	"fmt"
 
+	"github.com/dedis/student_19_elias/blscosi_bundle/container"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/sign"
-	"go.dedis.ch/kyber/v3/sign/bdn"
 	"go.dedis.ch/onet/v4/log"
 )
 
-// BlsSignature contains the raw signature
+// BlsSignature contains the raw signature, which is either the aggregate
+// followed by the mask or the binary encoding of a container
 type BlsSignature []byte
 
+// RoundProgress is the aggregate of the root during a round. Aggregate has
+// the same format as a final signature and is valid for the signers of Mask.
+type RoundProgress struct {
+	Signers   int
+	Mask      []byte
+	Aggregate BlsSignature
+}
+
+// Container returns the container of the signature, whether it is already
+// one or a raw signature
+func (sig BlsSignature) Container(suite pairing.Suite) (*container.Container, error) {
+	return container.Parse(suite, sig)
+}
+
 // GetMask creates and returns the mask associated with the signature. If
 // no mask has been appended, mask with every bit enabled is assumed
 func (sig BlsSignature) GetMask(suite pairing.Suite, publics []kyber.Point) (*sign.Mask, error) {
@@ -22,12 +36,12 @@ func (sig BlsSignature) GetMask(suite pairing.Suite, publics []kyber.Point) (*si
 		return nil, err
 	}
 
-	lenCom := suite.G1().PointLen()
-	if len(sig) < lenCom {
+	c, err := sig.Container(suite)
+	if err != nil {
 		return nil, errors.New("signature too short to get mask")
 	}
 
-	err = mask.SetMask(sig[lenCom:])
+	err = mask.SetMask(c.Mask)
 	if err != nil {
 		return nil, err
 	}
@@ -36,11 +50,11 @@ func (sig BlsSignature) GetMask(suite pairing.Suite, publics []kyber.Point) (*si
 }
 
 func (sig BlsSignature) RawSignature(suite pairing.Suite) ([]byte, error) {
-	lenCom := suite.G1().PointLen()
-	if len(sig) < lenCom {
-		return nil, errors.New("signature too short")
+	c, err := sig.Container(suite)
+	if err != nil {
+		return nil, err
 	}
-	return sig[:lenCom], nil
+	return c.Signature, nil
 }
 
 // Point creates the point associated with the signature in G1
@@ -69,36 +83,20 @@ func (sig BlsSignature) VerifyAggregateWithPolicy(suite pairing.Suite, msg []byt
 		return errors.New("no message provided")
 	}
 
-	rawSig, err := sig.RawSignature(suite)
-	if err != nil {
-		return err
-	}
-
-	// Unpack the participation mask
-	mask, err := sig.GetMask(suite, publics)
+	c, err := sig.Container(suite)
 	if err != nil {
 		return err
 	}
 
-	log.Lvlf5("Verifying against %v", rawSig)
+	log.Lvlf5("Verifying against %v", c.Signature)
 
-	// get the aggregate public key
-	aggKey, err := bdn.AggregatePublicKeys(suite, mask)
+	mask, err := c.Verify(suite, msg, publics, policy)
 	if err != nil {
 		return err
 	}
 
-	err = bdn.Verify(suite, aggKey, msg, rawSig)
-	if err != nil {
-		return fmt.Errorf("didn't get a valid aggregate signature: %s", err)
-	}
-
 	log.Lvl3("Signature verified and is correct!")
 	log.Lvl3("m.CountEnabled():", mask.CountEnabled())
 
-	if !policy.Check(mask) {
-		return errors.New("the policy is not fulfilled")
-	}
-
 	return nil
 }
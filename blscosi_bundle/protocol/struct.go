@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	dkg "go.dedis.ch/kyber/v3/share/dkg/pedersen"
 	"go.dedis.ch/onet/v4"
 	"go.dedis.ch/onet/v4/network"
 )
@@ -10,8 +11,25 @@ import (
 // the default cothority.Suite.
 const DefaultProtocolName = "bundleCoSiDefault"
 
+// DKGProtocolName is the name of the protocol that runs the distributed key
+// generation needed by the threshold mode.
+const DKGProtocolName = "bundleCoSiDKG"
+
+// ThresholdProtocolName is the name of the gossip protocol that collects
+// partial threshold signatures.
+const ThresholdProtocolName = "bundleCoSiThreshold"
+
+// SessionProtocolName is the name of the protocol that signs a sequence of
+// messages in pipelined rounds.
+const SessionProtocolName = "bundleCoSiSession"
+
 func init() {
-	network.RegisterMessages(&Rumor{}, &Shutdown{}, &Response{}, &Stop{})
+	network.RegisterMessages(&Rumor{}, &Shutdown{}, &Response{}, &Stop{}, &Abort{})
+	network.RegisterMessages(&CompactRumor{}, &CompactShutdown{}, &MessageRequest{}, &MessageReply{})
+	network.RegisterMessages(&Takeover{})
+	network.RegisterMessages(&DKGInit{}, &DKGDeal{}, &DKGResponse{}, &DKGDone{})
+	network.RegisterMessages(&ThresholdRumor{}, &ThresholdShutdown{})
+	network.RegisterMessages(&SessionRumor{}, &SessionShutdown{}, &SessionClose{})
 }
 
 // Rumor is a struct that can be sent in the gossip protocol
@@ -33,11 +51,18 @@ type RumorMessage struct {
 // final signature. This is to prevent faked shutdown messages that take down the
 // gossip protocol. Thus the shutdown message contains the final signature,
 // which in turn is signed by root.
+// In leaderless mode, any node can create the final signature, Signer is then
+// the roster index of that node and RootSig its signature. A successor of the
+// root gives the Takeover that elected it. Tree is set when the shutdown is
+// sent along the dissemination tree.
 type Shutdown struct {
 	Params           Parameters
 	FinalCoSignature BlsSignature
 	RootSig          []byte
 	Msg              []byte
+	Signer           uint32
+	Takeover         *Takeover
+	Tree             bool
 }
 
 // ShutdownMessage just contains a Shutdown and the data necessary to identify
@@ -47,6 +72,97 @@ type ShutdownMessage struct {
 	Shutdown
 }
 
+// CompactRumor is the Rumor sent to a peer known to have the message of the
+// round: the message and the parameters are replaced by their hashes.
+type CompactRumor struct {
+	Hash         []byte
+	ParamsDigest []byte
+	ResponseMap  map[uint32](*Response)
+}
+
+// CompactRumorMessage is a wrapper around CompactRumor for it to work with
+// onet
+type CompactRumorMessage struct {
+	*onet.TreeNode
+	CompactRumor
+}
+
+// CompactShutdown is the Shutdown sent to a peer known to have the message of
+// the round, see CompactRumor.
+type CompactShutdown struct {
+	Hash             []byte
+	ParamsDigest     []byte
+	FinalCoSignature BlsSignature
+	RootSig          []byte
+	Signer           uint32
+	Takeover         *Takeover
+	Tree             bool
+}
+
+// CompactShutdownMessage is a wrapper around CompactShutdown for it to work
+// with onet
+type CompactShutdownMessage struct {
+	*onet.TreeNode
+	CompactShutdown
+}
+
+// MessageRequest is sent by a node that received a compact message without
+// having the message of the round. It asks the sender for the message and
+// the parameters matching the hashes.
+type MessageRequest struct {
+	Hash         []byte
+	ParamsDigest []byte
+}
+
+// MessageRequestMessage is a wrapper around MessageRequest for it to work
+// with onet
+type MessageRequestMessage struct {
+	*onet.TreeNode
+	MessageRequest
+}
+
+// MessageReply carries the message and the parameters of the round, in reply
+// to a MessageRequest.
+type MessageReply struct {
+	Params Parameters
+	Msg    []byte
+}
+
+// MessageReplyMessage is a wrapper around MessageReply for it to work with
+// onet
+type MessageReplyMessage struct {
+	*onet.TreeNode
+	MessageReply
+}
+
+// Takeover elects the leader of a term once the leader of the previous one
+// has been silent. Votes are the signatures of the nodes that voted for it,
+// indexed by roster index, and the takeover is only valid with the votes of a
+// majority of the roster.
+type Takeover struct {
+	Term  uint32
+	Votes map[uint32][]byte
+}
+
+// TakeoverMessage is a wrapper around Takeover for it to work with onet
+type TakeoverMessage struct {
+	*onet.TreeNode
+	Takeover
+}
+
+// Abort stops a round before its end, for instance because the client went
+// away. It is signed by the root over the round ID of the instance so that it
+// can't be replayed, see abortMessage.
+type Abort struct {
+	RootSig []byte
+}
+
+// AbortMessage is a wrapper around Abort for it to work with onet
+type AbortMessage struct {
+	*onet.TreeNode
+	Abort
+}
+
 // Response is the blscosi response message
 type Response struct {
 	Signature []byte
@@ -72,3 +188,121 @@ type StructStop struct {
 	*onet.TreeNode
 	Stop
 }
+
+// DKGInit is sent by the root to start the distributed key generation
+type DKGInit struct{}
+
+// DKGInitMessage is a wrapper around DKGInit for it to work with onet
+type DKGInitMessage struct {
+	*onet.TreeNode
+	DKGInit
+}
+
+// DKGDeal contains the deal a node has prepared for the receiver
+type DKGDeal struct {
+	Deal *dkg.Deal
+}
+
+// DKGDealMessage is a wrapper around DKGDeal for it to work with onet
+type DKGDealMessage struct {
+	*onet.TreeNode
+	DKGDeal
+}
+
+// DKGResponse contains the response of a node to a deal, it is sent to
+// every other node
+type DKGResponse struct {
+	Response *dkg.Response
+}
+
+// DKGResponseMessage is a wrapper around DKGResponse for it to work with onet
+type DKGResponseMessage struct {
+	*onet.TreeNode
+	DKGResponse
+}
+
+// DKGDone is sent to the root once a node holds its certified share
+type DKGDone struct{}
+
+// DKGDoneMessage is a wrapper around DKGDone for it to work with onet
+type DKGDoneMessage struct {
+	*onet.TreeNode
+	DKGDone
+}
+
+// ThresholdRumor is the rumor of the threshold mode, it carries the partial
+// signatures known by the sender, indexed by their share index.
+type ThresholdRumor struct {
+	Params   Parameters
+	Partials map[uint32][]byte
+	Msg      []byte
+}
+
+// ThresholdRumorMessage is a wrapper around ThresholdRumor for it to work
+// with onet
+type ThresholdRumorMessage struct {
+	*onet.TreeNode
+	ThresholdRumor
+}
+
+// ThresholdShutdown contains the recovered group signature. It doesn't need
+// to be signed by the root as the group signature is a proof in itself.
+type ThresholdShutdown struct {
+	Params         Parameters
+	GroupSignature []byte
+	Msg            []byte
+}
+
+// ThresholdShutdownMessage is a wrapper around ThresholdShutdown for it to
+// work with onet
+type ThresholdShutdownMessage struct {
+	*onet.TreeNode
+	ThresholdShutdown
+}
+
+// SessionRumor is the rumor of one round of a session
+type SessionRumor struct {
+	Round       uint32
+	Params      Parameters
+	ResponseMap map[uint32](*Response)
+	Msg         []byte
+}
+
+// SessionRumorMessage is a wrapper around SessionRumor for it to work with
+// onet
+type SessionRumorMessage struct {
+	*onet.TreeNode
+	SessionRumor
+}
+
+// SessionShutdown ends one round of a session. Next is the rumor of the
+// following round, if the sender already signs it, so that the next round
+// starts with the shutdown traffic of the current one.
+type SessionShutdown struct {
+	Round            uint32
+	Params           Parameters
+	FinalCoSignature BlsSignature
+	RootSig          []byte
+	Msg              []byte
+	Next             *SessionRumor
+}
+
+// SessionShutdownMessage is a wrapper around SessionShutdown for it to work
+// with onet
+type SessionShutdownMessage struct {
+	*onet.TreeNode
+	SessionShutdown
+}
+
+// SessionClose ends a session, it is signed by the root.
+type SessionClose struct {
+	Rounds  uint32
+	RootSig []byte
+}
+
+// SessionCloseMessage is a wrapper around SessionClose for it to work with
+// onet
+type SessionCloseMessage struct {
+	*onet.TreeNode
+	SessionClose
+}
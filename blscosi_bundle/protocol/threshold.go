@@ -0,0 +1,291 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/sign/bls"
+	"go.dedis.ch/kyber/v3/sign/tbls"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+)
+
+// ThresholdCosi gossips partial threshold signatures. Any node that holds
+// Threshold valid partials recovers the group signature, which can be
+// verified with the group public key only.
+// This protocol exists on all nodes.
+type ThresholdCosi struct {
+	*onet.TreeNodeInstance
+	Msg            []byte
+	Data           []byte
+	Threshold      int
+	FinalSignature chan []byte // final signature that is sent back to client
+
+	// Share is the private share of this node and PubPoly the public
+	// polynomial of the distributed key, both coming from the DKG.
+	Share   *share.PriShare
+	PubPoly *share.PubPoly
+
+	stoppedOnce    sync.Once
+	startChan      chan bool
+	verificationFn VerificationFn
+	suite          *pairing.SuiteBn256
+	Params         Parameters
+
+	// pace is the current tick and fanout of the gossip
+	pace *gossipPace
+
+	// internodes channels
+	RumorsChan   chan ThresholdRumorMessage
+	ShutdownChan chan ThresholdShutdownMessage
+}
+
+// NewThresholdCosi creates the threshold protocol for a node holding the
+// given share of the distributed key.
+func NewThresholdCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite *pairing.SuiteBn256,
+	priShare *share.PriShare, pubPoly *share.PubPoly, t int) (onet.ProtocolInstance, error) {
+	c := &ThresholdCosi{
+		TreeNodeInstance: n,
+		FinalSignature:   make(chan []byte, 1),
+		Threshold:        t,
+		Share:            priShare,
+		PubPoly:          pubPoly,
+		startChan:        make(chan bool, 1),
+		verificationFn:   vf,
+		suite:            suite,
+	}
+
+	err := c.RegisterChannels(&c.RumorsChan, &c.ShutdownChan)
+	if err != nil {
+		return nil, errors.New("couldn't register channels: " + err.Error())
+	}
+
+	return c, nil
+}
+
+// Shutdown stops the protocol
+func (p *ThresholdCosi) Shutdown() error {
+	p.stoppedOnce.Do(func() {
+		close(p.startChan)
+		close(p.FinalSignature)
+	})
+	return nil
+}
+
+// Start is done only by root and starts the protocol.
+func (p *ThresholdCosi) Start() error {
+	err := p.checkIntegrity()
+	if err != nil {
+		p.Done()
+		return err
+	}
+
+	log.Lvlf3("Starting threshold BLS CoSi on %v", p.ServerIdentity())
+	p.startChan <- true
+	return nil
+}
+
+// Dispatch is the main method of the protocol for all nodes.
+func (p *ThresholdCosi) Dispatch() error {
+	defer p.Done()
+
+	protocolTimeout := time.After(shutdownAfter)
+
+	var shutdownStruct ThresholdShutdown
+	shutdown := false
+	done := false
+
+	var rumor *ThresholdRumor
+
+	if p.IsRoot() {
+		select {
+		case _, ok := <-p.startChan:
+			if !ok {
+				return errors.New("protocol finished prematurely")
+			}
+		case <-time.After(time.Second):
+			return errors.New("timeout, did you forget to call Start?")
+		}
+	} else {
+		select {
+		case rumorMsg := <-p.RumorsChan:
+			rumor = &rumorMsg.ThresholdRumor
+			p.Params = rumor.Params
+			p.Msg = rumor.Msg[:]
+		case shutdownMsg := <-p.ShutdownChan:
+			p.Params = shutdownMsg.Params
+			p.Msg = shutdownMsg.Msg[:]
+			if err := p.verifyShutdown(shutdownMsg); err == nil {
+				shutdownStruct = shutdownMsg.ThresholdShutdown
+				shutdown = true
+			} else {
+				log.Lvl1("Got first spoofed shutdown:", err)
+			}
+		case <-protocolTimeout:
+			shutdown = true
+			done = true
+		}
+	}
+
+	partials := make(map[uint32][]byte)
+	if p.Share == nil || p.PubPoly == nil {
+		log.Lvlf2("%v has no key share and cannot sign", p.ServerIdentity())
+	} else if p.verificationFn(p.Msg, p.Data) {
+		partial, err := tbls.Sign(p.suite, p.Share, p.Msg)
+		if err != nil {
+			return err
+		}
+		partials[uint32(p.Share.I)] = partial
+	}
+
+	if rumor != nil {
+		p.updatePartials(partials, rumor.Partials)
+	}
+
+	p.pace = newGossipPace(p.Params, len(p.List()))
+	ticker := time.NewTicker(p.pace.tick)
+	for !shutdown {
+		if len(partials) >= p.Threshold {
+			// Any node with enough partials can finish the protocol.
+			sig, err := p.recover(partials)
+			if err != nil {
+				return err
+			}
+			shutdownStruct = ThresholdShutdown{p.Params, sig, p.Msg}
+			shutdown = true
+			break
+		}
+
+		select {
+		case rumor := <-p.RumorsChan:
+			p.updatePartials(partials, rumor.Partials)
+			log.Lvlf5("Incoming rumor, %d known, %d needed", len(partials), p.Threshold)
+		case shutdownMsg := <-p.ShutdownChan:
+			if err := p.verifyShutdown(shutdownMsg); err == nil {
+				shutdownStruct = shutdownMsg.ThresholdShutdown
+				shutdown = true
+			} else {
+				log.Lvl1("Got spoofed shutdown:", err)
+			}
+		case <-ticker.C:
+			p.sendRumors(partials)
+			if p.pace.update(len(partials)) {
+				ticker.Stop()
+				ticker = time.NewTicker(p.pace.tick)
+			}
+		case <-protocolTimeout:
+			shutdown = true
+			done = true
+		}
+	}
+	ticker.Stop()
+
+	if p.IsRoot() && shutdownStruct.GroupSignature != nil {
+		log.Lvlf3("%v got the group signature %x", p.ServerIdentity(), shutdownStruct.GroupSignature)
+		p.FinalSignature <- shutdownStruct.GroupSignature
+	}
+
+	if shutdownStruct.GroupSignature != nil {
+		p.sendShutdowns(shutdownStruct)
+	}
+
+	for !done {
+		select {
+		case rumor := <-p.RumorsChan:
+			if shutdownStruct.GroupSignature != nil {
+				p.SendTo(rumor.TreeNode, &shutdownStruct)
+			}
+		case <-p.ShutdownChan:
+			// ignore
+		case <-protocolTimeout:
+			done = true
+		}
+	}
+
+	return nil
+}
+
+// updatePartials adds the valid partial signatures to the known ones.
+func (p *ThresholdCosi) updatePartials(partials map[uint32][]byte, newPartials map[uint32][]byte) {
+	for idx, partial := range newPartials {
+		if _, ok := partials[idx]; ok {
+			continue
+		}
+		if i, err := tbls.SigShare(partial).Index(); err != nil || i != int(idx) {
+			log.Lvl2("Partial signature with a wrong index")
+			continue
+		}
+		if err := tbls.Verify(p.suite, p.PubPoly, p.Msg, partial); err != nil {
+			log.Lvl2("Invalid partial signature:", err)
+			continue
+		}
+		partials[idx] = partial
+	}
+}
+
+// recover computes the group signature out of the partials.
+func (p *ThresholdCosi) recover(partials map[uint32][]byte) ([]byte, error) {
+	sigs := make([][]byte, 0, len(partials))
+	for _, partial := range partials {
+		sigs = append(sigs, partial)
+	}
+	return tbls.Recover(p.suite, p.PubPoly, p.Msg, sigs, p.Threshold, len(p.List()))
+}
+
+// sendRumors sends the known partials to some random peers.
+func (p *ThresholdCosi) sendRumors(partials map[uint32][]byte) {
+	targets, err := getRandomPeers(p.TreeNodeInstance, p.pace.peers)
+	if err != nil {
+		log.Lvl1("Couldn't get random peers:", err)
+		return
+	}
+	for _, target := range targets {
+		p.SendTo(target, &ThresholdRumor{p.Params, partials, p.Msg})
+	}
+}
+
+// sendShutdowns sends the group signature to some random peers.
+func (p *ThresholdCosi) sendShutdowns(shutdown ThresholdShutdown) {
+	targets, err := getRandomPeers(p.TreeNodeInstance, p.Params.ShutdownPeers)
+	if err != nil {
+		log.Lvl1("Couldn't get random peers for shutdown:", err)
+		return
+	}
+	for _, target := range targets {
+		p.SendTo(target, &shutdown)
+	}
+}
+
+// verifyShutdown checks the group signature of a shutdown message.
+func (p *ThresholdCosi) verifyShutdown(msg ThresholdShutdownMessage) error {
+	if p.PubPoly == nil {
+		return errors.New("no public polynomial to verify against")
+	}
+	return bls.Verify(p.suite, p.PubPoly.Commit(), p.Msg, msg.GroupSignature)
+}
+
+// checkIntegrity checks if the protocol has been instantiated with
+// correct parameters
+func (p *ThresholdCosi) checkIntegrity() error {
+	if p.Msg == nil {
+		return fmt.Errorf("no proposal msg specified")
+	}
+	if p.verificationFn == nil {
+		return fmt.Errorf("verification function cannot be nil")
+	}
+	if p.Share == nil || p.PubPoly == nil {
+		return fmt.Errorf("no distributed key share for this roster")
+	}
+	if p.Threshold > p.Tree().Size() {
+		return fmt.Errorf("threshold (%d) bigger than number of nodes (%d)", p.Threshold, p.Tree().Size())
+	}
+	if p.Threshold < 1 {
+		return fmt.Errorf("threshold of %d smaller than one node", p.Threshold)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/onet/v4/network"
+)
+
+func TestTraffic_Count(t *testing.T) {
+	size := func(msg network.Message) int {
+		buf, err := network.Marshal(msg)
+		require.NoError(t, err)
+		return len(buf)
+	}
+
+	small := &Rumor{Params: DefaultParams(), Msg: []byte("a")}
+	large := &Rumor{Params: DefaultParams(), Msg: make([]byte, 1000),
+		ResponseMap: map[uint32]*Response{0: {Signature: make([]byte, 64)}}}
+	compact := &CompactRumor{Hash: make([]byte, 32), ParamsDigest: make([]byte, 32)}
+	shutdown := &Shutdown{Params: DefaultParams(), FinalCoSignature: make([]byte, 80), Msg: []byte("a")}
+
+	// the messages of the different types are interleaved
+	traffic := newTraffic()
+	traffic.countReceived(small)
+	traffic.countReceived(compact)
+	traffic.countReceived(large)
+	traffic.countReceived(shutdown)
+	traffic.countReceived(compact)
+	traffic.countSent(large)
+
+	rx := traffic.Received()
+	require.Equal(t, TrafficCount{2, size(small) + size(large)}, rx["rumor"])
+	require.Equal(t, TrafficCount{2, 2 * size(compact)}, rx["compactrumor"])
+	require.Equal(t, TrafficCount{1, size(shutdown)}, rx["shutdown"])
+	require.Equal(t, map[string]TrafficCount{"rumor": {1, size(large)}}, traffic.Sent())
+}
@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"github.com/dedis/student_19_elias/blscosi_bundle/verifier"
+	"go.dedis.ch/kyber/v3/sign"
+)
+
+// WeightedPolicy is fulfilled when the summed weight of the signers reaches
+// the threshold, see verifier.WeightedPolicy.
+type WeightedPolicy = verifier.WeightedPolicy
+
+// NewWeightedPolicy returns the policy that needs signers weighing at least
+// threshold.
+func NewWeightedPolicy(weights []int, threshold int) *WeightedPolicy {
+	return verifier.NewWeightedPolicy(weights, threshold)
+}
+
+// DefaultWeightThreshold computes the minimal weight threshold authorized
+// using the formula 3f+1 on the total weight
+func DefaultWeightThreshold(weights []int) int {
+	return verifier.DefaultWeightThreshold(weights)
+}
+
+// SignPolicy returns the policy that a round run with the parameters
+// fulfills over n nodes: the compound policy if there is one, the weighted
+// one if there is a weight threshold, and threshold signers otherwise, or the
+// default threshold if it isn't set.
+func (params Parameters) SignPolicy(n, threshold int) sign.Policy {
+	if params.Policy != nil {
+		return params.Policy
+	}
+	if params.WeightThreshold > 0 {
+		return NewWeightedPolicy(params.Weights, params.WeightThreshold)
+	}
+	if threshold <= 0 {
+		threshold = DefaultThreshold(n)
+	}
+	return sign.NewThresholdPolicy(threshold)
+}
+
+// enough returns true if the responses complete a round run with the
+// parameters: the signers fulfill the compound policy if there is one, their
+// weight reaches the weight threshold if there is one, and their number
+// reaches threshold otherwise.
+func enough(params Parameters, threshold int, responses Responses, n int) bool {
+	if params.Policy != nil {
+		return params.Policy.Fulfilled(signersMask(responses, n))
+	}
+	if params.WeightThreshold > 0 {
+		policy := NewWeightedPolicy(params.Weights, params.WeightThreshold)
+		return policy.Weight(signersMask(responses, n)) >= params.WeightThreshold
+	}
+	return responses.Count() >= threshold
+}
+
+// signersMask returns the union of the masks of the responses over n nodes.
+func signersMask(responses Responses, n int) []byte {
+	mask := make([]byte, (n+7)/8)
+	for _, r := range responses.Map() {
+		for i := 0; i < len(mask) && i < len(r.Mask); i++ {
+			mask[i] |= r.Mask[i]
+		}
+	}
+	return mask
+}
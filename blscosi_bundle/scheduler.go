@@ -0,0 +1,87 @@
+package blscosi_bundle
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ticket is a request waiting in the queue of the scheduler. ready is closed
+// when the request can start.
+type ticket struct {
+	priority int
+	enqueued time.Time
+	ready    chan struct{}
+}
+
+// scheduler limits the number of rounds this node coordinates at the same
+// time, and the number of instances it joins for other roots. The requests
+// beyond the limit wait in a bounded queue ordered by priority, then by
+// arrival.
+type scheduler struct {
+	sync.Mutex
+	running int
+	joined  int
+	queue   []*ticket
+}
+
+// acquire waits for a free round and returns the time spent in the queue.
+// maxRounds <= 0 means no limit, and maxQueue is the number of requests that
+// can wait.
+func (sc *scheduler) acquire(priority, maxRounds, maxQueue int) (time.Duration, error) {
+	sc.Lock()
+	if maxRounds <= 0 || (sc.running < maxRounds && len(sc.queue) == 0) {
+		sc.running++
+		sc.Unlock()
+		return 0, nil
+	}
+	if len(sc.queue) >= maxQueue {
+		sc.Unlock()
+		return 0, fmt.Errorf("too many signing requests: %d rounds running and %d waiting",
+			sc.running, len(sc.queue))
+	}
+
+	t := &ticket{priority, time.Now(), make(chan struct{})}
+	// after the requests of the same or a higher priority
+	i := sort.Search(len(sc.queue), func(i int) bool { return sc.queue[i].priority < priority })
+	sc.queue = append(sc.queue, nil)
+	copy(sc.queue[i+1:], sc.queue[i:])
+	sc.queue[i] = t
+	sc.Unlock()
+
+	<-t.ready
+	return time.Since(t.enqueued), nil
+}
+
+// release frees a round, which is handed over to the first waiting request.
+func (sc *scheduler) release() {
+	sc.Lock()
+	defer sc.Unlock()
+	if len(sc.queue) == 0 {
+		sc.running--
+		return
+	}
+	t := sc.queue[0]
+	sc.queue = sc.queue[1:]
+	close(t.ready)
+}
+
+// join counts an instance joined for another root, unless there are already
+// maxJoined of them. maxJoined <= 0 means no limit.
+func (sc *scheduler) join(maxJoined int) error {
+	sc.Lock()
+	defer sc.Unlock()
+	if maxJoined > 0 && sc.joined >= maxJoined {
+		return fmt.Errorf("already %d protocol instances joined", sc.joined)
+	}
+	sc.joined++
+	return nil
+}
+
+// leave frees an instance joined for another root.
+func (sc *scheduler) leave() {
+	sc.Lock()
+	sc.joined--
+	sc.Unlock()
+}
@@ -3,11 +3,17 @@
 package blscosi_bundle
 
 import (
+	"encoding/hex"
 	"errors"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/share"
+	dkg "go.dedis.ch/kyber/v3/share/dkg/pedersen"
 	"go.dedis.ch/kyber/v3/suites"
 	"go.dedis.ch/onet/v4"
 	"go.dedis.ch/onet/v4/log"
@@ -16,6 +22,8 @@ import (
 
 const protocolTimeout = 20 * time.Second
 
+var storageKey = []byte("dkgShares")
+
 var suite = suites.MustFind("bn256.adapter").(*pairing.SuiteBn256)
 
 // ServiceID is the key to get the service later
@@ -28,6 +36,35 @@ func init() {
 	ServiceID, _ = onet.RegisterNewServiceWithSuite(ServiceName, suite, newCoSiService)
 	network.RegisterMessage(&SignatureRequest{})
 	network.RegisterMessage(&SignatureResponse{})
+	network.RegisterMessage(&DKGSetupRequest{})
+	network.RegisterMessage(&DKGSetupResponse{})
+	network.RegisterMessage(&ThresholdSignatureRequest{})
+	network.RegisterMessage(&ThresholdSignatureResponse{})
+	network.RegisterMessage(&BatchSignatureRequest{})
+	network.RegisterMessage(&BatchSignatureResponse{})
+	network.RegisterMessage(&SubmitSignatureRequest{})
+	network.RegisterMessage(&SubmitSignatureResponse{})
+	network.RegisterMessage(&CancelSignatureRequest{})
+	network.RegisterMessage(&CancelSignatureResponse{})
+	network.RegisterMessage(&SignatureStatusRequest{})
+	network.RegisterMessage(&SignatureStatusResponse{})
+	network.RegisterMessage(&FetchSignatureRequest{})
+	network.RegisterMessage(&SignatureStreamRequest{})
+	network.RegisterMessage(&SignatureProgressResponse{})
+	network.RegisterMessage(&RecoveredSignatureRequest{})
+	network.RegisterMessage(&LookupSignatureRequest{})
+	network.RegisterMessage(&LookupSignatureResponse{})
+	network.RegisterMessage(&PingRequest{})
+	network.RegisterMessage(&PingResponse{})
+	network.RegisterMessage(&OpenSessionRequest{})
+	network.RegisterMessage(&OpenSessionResponse{})
+	network.RegisterMessage(&SessionMessageRequest{})
+	network.RegisterMessage(&SessionMessageResponse{})
+	network.RegisterMessage(&SessionStreamRequest{})
+	network.RegisterMessage(&SessionSignatureResponse{})
+	network.RegisterMessage(&CloseSessionRequest{})
+	network.RegisterMessage(&CloseSessionResponse{})
+	network.RegisterMessage(&storage{})
 }
 
 // Service is the service that handles collective signing operations
@@ -36,31 +73,290 @@ type Service struct {
 	suite     pairing.Suite
 	Threshold int
 	Timeout   time.Duration
+	// Retention is the time the results of asynchronous requests are kept
+	Retention time.Duration
+	// CacheTTL is the time a signature answers identical requests, zero
+	// disables the cache but running requests are still shared
+	CacheTTL time.Duration
+	// MaxRounds is the number of rounds this node coordinates at the same
+	// time, zero means no limit
+	MaxRounds int
+	// MaxQueue is the number of requests waiting for a round, beyond which
+	// they are rejected
+	MaxQueue int
+	// MaxJoined is the number of protocol instances this node joins for other
+	// roots at the same time, zero means no limit
+	MaxJoined int
+
+	storage *storage
+
+	async asyncRequests
+	dedup *dedup
+	sched scheduler
+
+	sessionsLock sync.Mutex
+	sessions     map[string]*session
+
+	// signatures keeps the signatures issued by this node
+	signatures *signatureStore
+}
+
+// session is a signing session opened by a client on this node.
+type session struct {
+	p         *protocol.BlsCosiSession
+	nextRound uint32
+	streaming bool
+}
+
+// storage holds the key shares of the distributed keys this node is part of.
+// They are indexed by the key of the roster, see rosterKey.
+type storage struct {
+	sync.Mutex
+	Shares map[string]*KeyShare
+}
+
+// KeyShare is the share of a distributed key held by this node.
+type KeyShare struct {
+	Index     int
+	Share     kyber.Scalar
+	Commits   []kyber.Point
+	Threshold int
+}
+
+// PubPoly returns the public polynomial of the distributed key.
+func (ks *KeyShare) PubPoly(suite pairing.Suite) *share.PubPoly {
+	return share.NewPubPoly(suite.G2(), suite.G2().Point().Base(), ks.Commits)
 }
 
 // SignatureRequest is what the Cosi service is expected to receive from clients.
+// The requests of higher priority leave the queue of the node first.
 type SignatureRequest struct {
+	Message  []byte
+	Roster   *onet.Roster
+	Params   protocol.Parameters
+	Priority int
+}
+
+// SignatureResponse is what the Cosi service will reply to clients. QueueTime
+// is the time the request waited for a free round.
+type SignatureResponse struct {
+	Hash      []byte
+	Signature protocol.BlsSignature
+	QueueTime time.Duration
+}
+
+// DKGSetupRequest asks the roster to run a distributed key generation, which
+// is needed before threshold signatures can be requested.
+type DKGSetupRequest struct {
+	Roster *onet.Roster
+}
+
+// DKGSetupResponse contains the public key of the group, which is the only
+// key needed to verify a threshold signature.
+type DKGSetupResponse struct {
+	GroupKey kyber.Point
+}
+
+// ThresholdSignatureRequest asks for a threshold signature from a roster that
+// already ran the distributed key generation.
+type ThresholdSignatureRequest struct {
 	Message []byte
 	Roster  *onet.Roster
 	Params  protocol.Parameters
 }
 
-// SignatureResponse is what the Cosi service will reply to clients.
-type SignatureResponse struct {
+// ThresholdSignatureResponse contains the group signature, which has a
+// constant size and no participation mask.
+type ThresholdSignatureResponse struct {
+	Hash      []byte
+	Signature []byte
+}
+
+// BatchSignatureRequest asks for the signature of several messages in a
+// single protocol run.
+type BatchSignatureRequest struct {
+	Messages [][]byte
+	Roster   *onet.Roster
+	Params   protocol.Parameters
+	Priority int
+}
+
+// BatchSignatureResponse contains one signature per message of the batch, in
+// the same order as the request.
+type BatchSignatureResponse struct {
+	Signatures []BatchSignature
+	QueueTime  time.Duration
+}
+
+// RecoveredSignatureRequest asks a node for the final signature of a message
+// that it created because the root of the round was gone. RosterID is the ID
+// of the roster of the round, which the mask of the signature refers to.
+type RecoveredSignatureRequest struct {
+	Hash     []byte
+	RosterID []byte
+}
+
+// PingRequest is used by clients to measure the latency of a node.
+type PingRequest struct{}
+
+// PingResponse is the reply to a PingRequest.
+type PingResponse struct{}
+
+// OpenSessionRequest opens a signing session over the roster, with this node
+// as the root. The same protocol instance signs all the messages of the
+// session.
+type OpenSessionRequest struct {
+	Roster *onet.Roster
+	Params protocol.Parameters
+}
+
+// OpenSessionResponse contains the identifier of the new session.
+type OpenSessionResponse struct {
+	SessionID []byte
+}
+
+// SessionMessageRequest adds a message to sign to a session.
+type SessionMessageRequest struct {
+	SessionID []byte
+	Message   []byte
+}
+
+// SessionMessageResponse contains the round in which the message is signed.
+type SessionMessageResponse struct {
+	Round uint32
+}
+
+// SessionStreamRequest asks for the signatures of a session, they are
+// streamed in the order of the rounds.
+type SessionStreamRequest struct {
+	SessionID []byte
+}
+
+// SessionSignatureResponse is the signature of one round of a session.
+type SessionSignatureResponse struct {
+	Round     uint32
 	Hash      []byte
 	Signature protocol.BlsSignature
 }
 
+// CloseSessionRequest closes a session once the pending messages are signed.
+type CloseSessionRequest struct {
+	SessionID []byte
+}
+
+// CloseSessionResponse contains the number of rounds of the closed session.
+type CloseSessionResponse struct {
+	Rounds uint32
+}
+
 // SignatureRequest treats external request to this service.
 func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, error) {
-	// generate the tree
-	rooted := req.Roster.NewRosterWithRoot(s.ServerIdentity())
-	if rooted == nil {
-		return nil, errors.New("we're not in the roster")
+	started := time.Now()
+	sig, queued, err := s.signOnce(req.Roster, req.Message, req.Params, req.Priority)
+	if err != nil {
+		return nil, err
 	}
-	tree := rooted.GenerateStar()
-	if tree == nil {
-		return nil, errors.New("failed to generate tree")
+
+	// The hash is the message blscosi actually signs, we recompute it the
+	// same way as blscosi and then return it.
+	h := s.suite.Hash()
+	h.Write(req.Message)
+	s.storeSignature(newRecord(h.Sum(nil), req.Roster, sig, gossipStrategy(req.Params), started))
+	return &SignatureResponse{Hash: h.Sum(nil), Signature: sig, QueueTime: queued}, nil
+}
+
+// BatchSignatureRequest signs the Merkle root of the messages of the batch and
+// returns the inclusion proof of each message along with the signature.
+func (s *Service) BatchSignatureRequest(req *BatchSignatureRequest) (network.Message, error) {
+	if len(req.Messages) == 0 {
+		return nil, errors.New("no message in the batch")
+	}
+
+	hashes := make([][]byte, len(req.Messages))
+	for i, msg := range req.Messages {
+		h := s.suite.Hash()
+		h.Write(msg)
+		hashes[i] = h.Sum(nil)
+	}
+	root, proofs := merkleTree(s.suite, hashes)
+
+	started := time.Now()
+	sig, queued, err := s.signOnce(req.Roster, root, req.Params, req.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BatchSignatureResponse{Signatures: make([]BatchSignature, len(hashes)), QueueTime: queued}
+	for i := range hashes {
+		res.Signatures[i] = BatchSignature{
+			Hash:      hashes[i],
+			Root:      root,
+			Proof:     proofs[i],
+			Signature: sig,
+		}
+		rec := newRecord(hashes[i], req.Roster, sig, StrategyBatch, started)
+		rec.Root = root
+		rec.Proof = proofs[i]
+		s.storeSignature(rec)
+	}
+	return res, nil
+}
+
+// sign runs the gossip protocol over the roster, with this node as the root,
+// and returns the final signature of msg along with the time the request
+// waited for a free round.
+func (s *Service) sign(roster *onet.Roster, msg []byte, params protocol.Parameters, priority int) (protocol.BlsSignature, time.Duration, error) {
+	queued, err := s.sched.acquire(priority, s.MaxRounds, s.MaxQueue)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer s.sched.release()
+
+	p, err := s.startSigning(roster, msg, params)
+	if err != nil {
+		return nil, queued, err
+	}
+
+	// wait for reply. This will always eventually return.
+	sig := <-p.FinalSignature
+	if sig == nil {
+		return nil, queued, roundError(p)
+	}
+	return sig, queued, nil
+}
+
+// roundError is the reason why a round started by this node ended without a
+// signature.
+func roundError(p *protocol.BlsCosi) error {
+	if p.Aborted() {
+		return ErrCancelled
+	}
+	return ErrNoSignature
+}
+
+// startSigning starts the gossip protocol over the roster, with this node as
+// the root, to sign msg.
+func (s *Service) startSigning(roster *onet.Roster, msg []byte, params protocol.Parameters) (*protocol.BlsCosi, error) {
+	p, err := s.newSigning(roster, msg, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// start the protocol
+	log.Lvl3("CoSi service starting up gossip protocol")
+	if err = p.Start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newSigning creates the gossip protocol over the roster, with this node as
+// the root, to sign msg. It is not started.
+func (s *Service) newSigning(roster *onet.Roster, msg []byte, params protocol.Parameters) (*protocol.BlsCosi, error) {
+	// generate the tree
+	tree, err := s.starTree(roster)
+	if err != nil {
+		return nil, err
 	}
 
 	// configure the BlsCosi protocol
@@ -70,32 +366,274 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 	}
 	p := pi.(*protocol.BlsCosi)
 	p.Timeout = s.Timeout
-	p.Msg = req.Message
-	p.Params = req.Params
-	if p.Params == (protocol.Parameters{}) {
-		p.Params = protocol.DefaultParams()
-	}
+	p.Msg = msg
+	p.Params = params.WithDefaults()
 
 	// Threshold before the subtrees so that we can optimize situation
 	// like a threshold of one
 	if s.Threshold > 0 {
 		p.Threshold = s.Threshold
 	}
+	return p, nil
+}
 
-	// start the protocol
-	log.Lvl3("CoSi service starting up gossip protocol")
+// starTree generates a star tree with this node as the root. The tree keeps
+// the roster in the order given by the client, so that the masks refer to
+// that order whichever node coordinates the protocol.
+func (s *Service) starTree(roster *onet.Roster) (*onet.Tree, error) {
+	if i, _ := roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, errors.New("we're not in the roster")
+	}
+	tree := roster.GenerateNaryTreeWithRoot(len(roster.List)-1, s.ServerIdentity())
+	if tree == nil {
+		return nil, errors.New("failed to generate tree")
+	}
+	return tree, nil
+}
+
+// SetupDKG runs the distributed key generation for the roster and returns
+// the public key of the group.
+func (s *Service) SetupDKG(req *DKGSetupRequest) (network.Message, error) {
+	tree, err := s.starTree(req.Roster)
+	if err != nil {
+		return nil, err
+	}
+
+	pi, err := s.CreateProtocol(protocol.DKGProtocolName, tree)
+	if err != nil {
+		return nil, errors.New("Couldn't make new protocol: " + err.Error())
+	}
+	p := pi.(*protocol.SetupDKG)
+	p.Timeout = s.Timeout
+
+	log.Lvl3("CoSi service starting up the distributed key generation")
 	if err = pi.Start(); err != nil {
 		return nil, err
 	}
 
-	// wait for reply. This will always eventually return.
-	sig := <-p.FinalSignature
+	select {
+	case ok := <-p.Finished:
+		if !ok {
+			return nil, errors.New("distributed key generation failed")
+		}
+	case <-time.After(s.Timeout):
+		return nil, errors.New("timeout while waiting for the distributed key generation")
+	}
+
+	ks, err := s.getKeyShare(req.Roster.ServicePublics(ServiceName))
+	if err != nil {
+		return nil, err
+	}
+	return &DKGSetupResponse{GroupKey: ks.PubPoly(s.suite).Commit()}, nil
+}
+
+// ThresholdSignatureRequest treats external request for threshold signatures.
+func (s *Service) ThresholdSignatureRequest(req *ThresholdSignatureRequest) (network.Message, error) {
+	if _, err := s.sched.acquire(0, s.MaxRounds, s.MaxQueue); err != nil {
+		return nil, err
+	}
+	defer s.sched.release()
+
+	tree, err := s.starTree(req.Roster)
+	if err != nil {
+		return nil, err
+	}
+
+	pi, err := s.CreateProtocol(protocol.ThresholdProtocolName, tree)
+	if err != nil {
+		return nil, errors.New("Couldn't make new protocol: " + err.Error())
+	}
+	p := pi.(*protocol.ThresholdCosi)
+	p.Msg = req.Message
+	p.Params = req.Params.WithDefaults()
+
+	log.Lvl3("CoSi service starting up threshold gossip protocol")
+	started := time.Now()
+	if err = pi.Start(); err != nil {
+		return nil, err
+	}
+
+	sig, ok := <-p.FinalSignature
+	if !ok || sig == nil {
+		return nil, errors.New("couldn't recover the group signature")
+	}
 
-	// The hash is the message blscosi actually signs, we recompute it the
-	// same way as blscosi and then return it.
 	h := s.suite.Hash()
 	h.Write(req.Message)
-	return &SignatureResponse{h.Sum(nil), sig}, nil
+	s.storeSignature(newRecord(h.Sum(nil), req.Roster, sig, StrategyThreshold, started))
+	return &ThresholdSignatureResponse{h.Sum(nil), sig}, nil
+}
+
+// RecoveredSignature returns the final signature of a message that this
+// node knows, in particular when it finished the round in place of the root.
+// Only the signatures of the gossip rounds are returned, the other ones
+// aren't collective signatures of the message alone.
+func (s *Service) RecoveredSignature(req *RecoveredSignatureRequest) (network.Message, error) {
+	if len(req.RosterID) == 0 {
+		return nil, errors.New("missing roster ID")
+	}
+	recs, err := s.signatures.lookup(req.Hash, req.RosterID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		if rec.Strategy == StrategyGossip || rec.Strategy == StrategyLeaderless {
+			return &SignatureResponse{Hash: req.Hash, Signature: rec.Signature}, nil
+		}
+	}
+	return nil, errors.New("no recovered signature for this hash")
+}
+
+// waitFinal keeps the final signature of a non-root protocol instance, which
+// it gets from the shutdown of the round or by creating it in place of the
+// root.
+func (s *Service) waitFinal(p *protocol.BlsCosi, started time.Time) {
+	sig, ok := <-p.FinalSignature
+	if !ok || sig == nil {
+		return
+	}
+	h := s.suite.Hash()
+	h.Write(p.Msg)
+	log.Lvlf3("%v keeps the signature of %x", s.ServerIdentity(), h.Sum(nil))
+	s.storeSignature(newRecord(h.Sum(nil), p.Roster(), sig, gossipStrategy(p.Params), started))
+}
+
+// Ping replies right away, so that clients can measure the latency.
+func (s *Service) Ping(req *PingRequest) (network.Message, error) {
+	return &PingResponse{}, nil
+}
+
+// OpenSession starts a session protocol over the roster and returns its
+// identifier.
+func (s *Service) OpenSession(req *OpenSessionRequest) (network.Message, error) {
+	tree, err := s.starTree(req.Roster)
+	if err != nil {
+		return nil, err
+	}
+
+	pi, err := s.CreateProtocol(protocol.SessionProtocolName, tree)
+	if err != nil {
+		return nil, errors.New("Couldn't make new protocol: " + err.Error())
+	}
+	p := pi.(*protocol.BlsCosiSession)
+	p.Params = req.Params.WithDefaults()
+	if s.Threshold > 0 {
+		p.Threshold = s.Threshold
+	}
+
+	log.Lvl3("CoSi service starting up a signing session")
+	if err = pi.Start(); err != nil {
+		return nil, err
+	}
+
+	id := p.Token().RoundID
+	sess := &session{p: p}
+	s.sessionsLock.Lock()
+	s.sessions[id.String()] = sess
+	s.sessionsLock.Unlock()
+	go s.forgetSession(id.String(), sess)
+	return &OpenSessionResponse{SessionID: id[:]}, nil
+}
+
+// forgetSession removes the session once its protocol has ended, when it is
+// closed or idle.
+func (s *Service) forgetSession(id string, sess *session) {
+	<-sess.p.Closed
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	if s.sessions[id] == sess {
+		delete(s.sessions, id)
+	}
+}
+
+// SessionMessage queues a message to be signed in the next free round of the
+// session.
+func (s *Service) SessionMessage(req *SessionMessageRequest) (network.Message, error) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	sess, err := s.getSession(req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-sess.p.Closed:
+		return nil, errors.New("the session has ended")
+	default:
+	}
+	select {
+	case sess.p.Messages <- req.Message:
+	default:
+		return nil, errors.New("too many pending messages in the session")
+	}
+	round := sess.nextRound
+	sess.nextRound++
+	return &SessionMessageResponse{Round: round}, nil
+}
+
+// SessionStream streams the signatures of the session to the client. Only
+// one stream can be opened per session.
+func (s *Service) SessionStream(req *SessionStreamRequest) (chan *SessionSignatureResponse, chan bool, error) {
+	s.sessionsLock.Lock()
+	sess, err := s.getSession(req.SessionID)
+	if err == nil && sess.streaming {
+		err = errors.New("the session is already streamed")
+	}
+	if err != nil {
+		s.sessionsLock.Unlock()
+		return nil, nil, err
+	}
+	sess.streaming = true
+	s.sessionsLock.Unlock()
+
+	outChan := make(chan *SessionSignatureResponse)
+	stopChan := make(chan bool)
+	go func() {
+		defer close(outChan)
+		started := time.Now()
+		for sig := range sess.p.FinalSignatures {
+			h := s.suite.Hash()
+			h.Write(sig.Msg)
+			s.storeSignature(newRecord(h.Sum(nil), sess.p.Roster(), sig.Signature, StrategySession, started))
+			started = time.Now()
+			select {
+			case outChan <- &SessionSignatureResponse{sig.Round, h.Sum(nil), sig.Signature}:
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+	return outChan, stopChan, nil
+}
+
+// CloseSession ends the session once the queued messages are signed.
+func (s *Service) CloseSession(req *CloseSessionRequest) (network.Message, error) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
+	sess, err := s.getSession(req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.sessions, uuidString(req.SessionID))
+	close(sess.p.Messages)
+	return &CloseSessionResponse{Rounds: sess.nextRound}, nil
+}
+
+// getSession returns the session with the given identifier. The caller must
+// hold the sessions lock.
+func (s *Service) getSession(id []byte) (*session, error) {
+	sess, ok := s.sessions[uuidString(id)]
+	if !ok {
+		return nil, errors.New("unknown session")
+	}
+	return sess, nil
+}
+
+// uuidString converts a session identifier to the key of the sessions map.
+func uuidString(id []byte) string {
+	var u onet.RoundID
+	copy(u[:], id)
+	return u.String()
 }
 
 // NewProtocol is called on all nodes of a Tree (except the root, since it is
@@ -103,10 +641,136 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 // generate the PI on all others node.
 func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfig) (onet.ProtocolInstance, error) {
 	log.Lvl3("Cosi Service received on", s.ServerIdentity(), "received new protocol event-", tn.ProtocolName())
-	if tn.ProtocolName() != protocol.DefaultProtocolName {
-		return nil, errors.New("no such protocol " + tn.ProtocolName())
+	switch tn.ProtocolName() {
+	case protocol.DefaultProtocolName:
+		if err := s.sched.join(s.MaxJoined); err != nil {
+			log.Lvl2(s.ServerIdentity(), "declines the protocol:", err)
+			return nil, err
+		}
+		pi, err := protocol.NewDefaultProtocol(tn)
+		if err != nil {
+			s.sched.leave()
+			return nil, err
+		}
+		go func() {
+			s.waitFinal(pi.(*protocol.BlsCosi), time.Now())
+			s.sched.leave()
+		}()
+		return pi, nil
+	case protocol.SessionProtocolName:
+		return protocol.NewDefaultSessionProtocol(tn)
+	case protocol.DKGProtocolName:
+		return s.newSetupDKG(tn)
+	case protocol.ThresholdProtocolName:
+		return s.newThresholdCosi(tn)
+	}
+	return nil, errors.New("no such protocol " + tn.ProtocolName())
+}
+
+// newSetupDKG creates a distributed key generation which stores the share of
+// this node once it is done.
+func (s *Service) newSetupDKG(tn *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	publics := tn.Publics()
+	return protocol.NewSetupDKG(tn, func(dks *dkg.DistKeyShare) error {
+		return s.storeKeyShare(publics, dks)
+	})
+}
+
+// newThresholdCosi creates a threshold signing protocol with the share of
+// this node of the distributed key of the roster.
+func (s *Service) newThresholdCosi(tn *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	vf := func(a, b []byte) bool { return true }
+	ks, err := s.getKeyShare(tn.Publics())
+	if err != nil {
+		log.Lvl2(s.ServerIdentity(), "joins the threshold protocol without a share:", err)
+		return protocol.NewThresholdCosi(tn, vf, s.suite, nil, nil, protocol.DefaultThreshold(len(tn.Roster().List)))
+	}
+	priShare := &share.PriShare{I: ks.Index, V: ks.Share}
+	return protocol.NewThresholdCosi(tn, vf, s.suite, priShare, ks.PubPoly(s.suite), ks.Threshold)
+}
+
+// storeKeyShare saves the share of the distributed key of the roster defined
+// by the public keys.
+func (s *Service) storeKeyShare(publics []kyber.Point, dks *dkg.DistKeyShare) error {
+	key, err := rosterKey(publics)
+	if err != nil {
+		return err
+	}
+
+	s.storage.Lock()
+	s.storage.Shares[key] = &KeyShare{
+		Index:     dks.Share.I,
+		Share:     dks.Share.V,
+		Commits:   dks.Commits,
+		Threshold: len(dks.Commits),
 	}
-	return protocol.NewDefaultProtocol(tn)
+	s.storage.Unlock()
+	return s.save()
+}
+
+// getKeyShare returns the share of the distributed key of the roster defined
+// by the public keys.
+func (s *Service) getKeyShare(publics []kyber.Point) (*KeyShare, error) {
+	key, err := rosterKey(publics)
+	if err != nil {
+		return nil, err
+	}
+
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	ks, ok := s.storage.Shares[key]
+	if !ok {
+		return nil, errors.New("no distributed key for this roster, run the DKG setup first")
+	}
+	return ks, nil
+}
+
+// rosterKey computes an identifier of a roster that doesn't depend on the
+// order of the nodes, as clients can give the roster in any order.
+func rosterKey(publics []kyber.Point) (string, error) {
+	keys := make([]string, len(publics))
+	for i, pub := range publics {
+		buf, err := pub.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		keys[i] = string(buf)
+	}
+	sort.Strings(keys)
+
+	h := suite.Hash()
+	for _, k := range keys {
+		h.Write([]byte(k))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// save stores the key shares in the service's database.
+func (s *Service) save() error {
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	return s.Save(storageKey, s.storage)
+}
+
+// tryLoad loads the key shares from the service's database, if any.
+func (s *Service) tryLoad() error {
+	s.storage = &storage{Shares: make(map[string]*KeyShare)}
+	msg, err := s.Load(storageKey)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return nil
+	}
+	var ok bool
+	s.storage, ok = msg.(*storage)
+	if !ok {
+		return errors.New("data of wrong type")
+	}
+	if s.storage.Shares == nil {
+		s.storage.Shares = make(map[string]*KeyShare)
+	}
+	return nil
 }
 
 func newCoSiService(c *onet.Context) (onet.Service, error) {
@@ -114,12 +778,43 @@ func newCoSiService(c *onet.Context) (onet.Service, error) {
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		suite:            suite,
 		Timeout:          protocolTimeout,
+		Retention:        defaultRetention,
+		async:            asyncRequests{requests: make(map[string]*asyncRequest)},
+		dedup:            newDedup(),
+		sessions:         make(map[string]*session),
+	}
+
+	if err := s.RegisterHandlers(s.SignatureRequest, s.BatchSignatureRequest,
+		s.SetupDKG, s.ThresholdSignatureRequest, s.SubmitSignature,
+		s.SignatureStatus, s.FetchSignature, s.CancelSignature, s.RecoveredSignature,
+		s.LookupSignature, s.Ping,
+		s.OpenSession, s.SessionMessage, s.CloseSession); err != nil {
+		log.Error("couldn't register messages:", err)
+		return nil, err
+	}
+	if err := s.RegisterStreamingHandlers(s.SignatureStream, s.SessionStream); err != nil {
+		log.Error("couldn't register streaming handler:", err)
+		return nil, err
 	}
 
-	if err := s.RegisterHandler(s.SignatureRequest); err != nil {
-		log.Error("couldn't register message:", err)
+	// the root of these protocols needs the state of the service
+	if _, err := s.ProtocolRegister(protocol.DKGProtocolName, s.newSetupDKG); err != nil {
 		return nil, err
 	}
+	if _, err := s.ProtocolRegister(protocol.SessionProtocolName, protocol.NewDefaultSessionProtocol); err != nil {
+		return nil, err
+	}
+	if _, err := s.ProtocolRegister(protocol.ThresholdProtocolName, s.newThresholdCosi); err != nil {
+		return nil, err
+	}
+
+	if err := s.tryLoad(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	db, bucket := s.GetAdditionalBucket(signaturesBucket)
+	s.signatures = newSignatureStore(db, bucket)
 
 	return s, nil
 }
@@ -1,13 +1,19 @@
 package blscosi_bundle
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bls"
 	"go.dedis.ch/kyber/v3/sign/cosi"
 	"go.dedis.ch/onet/v4"
 	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/onet/v4/network"
 )
 
 var testSuite = pairing.NewSuiteBn256()
@@ -68,3 +74,666 @@ func TestService_SignatureRequest(t *testing.T) {
 	// verify the response still
 	require.Nil(t, res.Signature.VerifyWithPolicy(testSuite, msg, publics, cosi.NewThresholdPolicy(1)))
 }
+
+func TestService_ThresholdSignatureRequest(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(7, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	msg := []byte("hello threshold service")
+
+	// no distributed key yet
+	_, err := service.ThresholdSignatureRequest(&ThresholdSignatureRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.Error(t, err)
+
+	buf, err := service.SetupDKG(&DKGSetupRequest{Roster: roster})
+	require.NoError(t, err)
+	groupKey := buf.(*DKGSetupResponse).GroupKey
+
+	// any node can coordinate, the shares don't depend on the root
+	other := hosts[3].Service(ServiceName).(*Service)
+	buf, err = other.ThresholdSignatureRequest(&ThresholdSignatureRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.NoError(t, err)
+
+	res := buf.(*ThresholdSignatureResponse)
+	require.Equal(t, testSuite.G1().PointLen(), len(res.Signature))
+	require.NoError(t, bls.Verify(testSuite, groupKey, msg, res.Signature))
+
+	// every node stored its share of the same key
+	for _, h := range hosts {
+		s := h.Service(ServiceName).(*Service)
+		ks, err := s.getKeyShare(roster.ServicePublics(ServiceName))
+		require.NoError(t, err)
+		require.True(t, ks.PubPoly(testSuite).Commit().Equal(groupKey))
+	}
+
+	// the root signs as well
+	buf, err = service.ThresholdSignatureRequest(&ThresholdSignatureRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.NoError(t, err)
+	require.NoError(t, bls.Verify(testSuite, groupKey, msg, buf.(*ThresholdSignatureResponse).Signature))
+
+	// a threshold signature isn't a recovered signature of the roster
+	_, err = other.RecoveredSignature(&RecoveredSignatureRequest{Hash: res.Hash, RosterID: roster.ID[:]})
+	require.Error(t, err)
+}
+
+func TestService_BatchSignatureRequest(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+
+	_, err := service.BatchSignatureRequest(&BatchSignatureRequest{Roster: roster})
+	require.Error(t, err)
+
+	msgs := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	buf, err := service.BatchSignatureRequest(&BatchSignatureRequest{
+		Roster:   roster,
+		Messages: msgs,
+	})
+	require.NoError(t, err)
+
+	publics := roster.ServicePublics(ServiceName)
+	res := buf.(*BatchSignatureResponse)
+	require.Equal(t, len(msgs), len(res.Signatures))
+	for i, sig := range res.Signatures {
+		require.NoError(t, sig.Verify(testSuite, msgs[i], publics))
+		require.Error(t, sig.Verify(testSuite, msgs[(i+1)%len(msgs)], publics))
+	}
+}
+
+func TestService_Session(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+
+	_, err := service.SessionMessage(&SessionMessageRequest{SessionID: []byte("unknown")})
+	require.Error(t, err)
+
+	buf, err := service.OpenSession(&OpenSessionRequest{Roster: roster})
+	require.NoError(t, err)
+	id := buf.(*OpenSessionResponse).SessionID
+
+	sigs, _, err := service.SessionStream(&SessionStreamRequest{SessionID: id})
+	require.NoError(t, err)
+	_, _, err = service.SessionStream(&SessionStreamRequest{SessionID: id})
+	require.Error(t, err)
+
+	msgs := [][]byte{[]byte("block 0"), []byte("block 1"), []byte("block 2"), []byte("block 3")}
+	for i, msg := range msgs {
+		buf, err := service.SessionMessage(&SessionMessageRequest{SessionID: id, Message: msg})
+		require.NoError(t, err)
+		require.Equal(t, uint32(i), buf.(*SessionMessageResponse).Round)
+	}
+
+	// the queued messages are still signed after the close
+	buf, err = service.CloseSession(&CloseSessionRequest{SessionID: id})
+	require.NoError(t, err)
+	require.Equal(t, uint32(len(msgs)), buf.(*CloseSessionResponse).Rounds)
+	_, err = service.SessionMessage(&SessionMessageRequest{SessionID: id, Message: msgs[0]})
+	require.Error(t, err)
+
+	publics := roster.ServicePublics(ServiceName)
+	for i, msg := range msgs {
+		sig := <-sigs
+		require.NotNil(t, sig)
+		require.Equal(t, uint32(i), sig.Round)
+		require.NoError(t, sig.Signature.VerifyAggregate(testSuite, msg, publics))
+	}
+	_, ok := <-sigs
+	require.False(t, ok)
+}
+
+func TestService_SignatureRequestAnyRoot(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	msg := []byte("hello from any root")
+	publics := roster.ServicePublics(ServiceName)
+	for _, host := range hosts {
+		service := host.Service(ServiceName).(*Service)
+		buf, err := service.SignatureRequest(&SignatureRequest{
+			Roster:  roster,
+			Message: msg,
+		})
+		require.NoError(t, err)
+
+		// the mask refers to the roster of the client, whatever the root
+		res := buf.(*SignatureResponse)
+		require.NoError(t, res.Signature.VerifyAggregate(testSuite, msg, publics))
+	}
+}
+
+func TestService_SignatureRequestLeaderless(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(7, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	params := protocol.DefaultParams()
+	params.Leaderless = true
+
+	msg := []byte("hello leaderless")
+	buf, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Params:  params,
+	})
+	require.NoError(t, err)
+
+	publics := roster.ServicePublics(ServiceName)
+	res := buf.(*SignatureResponse)
+	require.NoError(t, res.Signature.VerifyAggregate(testSuite, msg, publics))
+}
+
+func TestService_RootFailover(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	params := protocol.DefaultParams()
+	// slow ticks so that the root is gone before it collects the responses
+	params.GossipTick = time.Second
+
+	msg := []byte("hello without root")
+	go service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Params:  params,
+	})
+	// the root sends its first rumor after one tick and dies
+	time.Sleep(1500 * time.Millisecond)
+	require.NoError(t, hosts[0].Close())
+
+	h := testSuite.Hash()
+	h.Write(msg)
+	client := NewClient()
+	alive := onet.NewRoster(roster.List[1:])
+	publics := roster.ServicePublics(ServiceName)
+
+	var res *SignatureResponse
+	var err error
+	for i := 0; i < 20 && res == nil; i++ {
+		time.Sleep(500 * time.Millisecond)
+		res, err = client.RecoveredSignature(context.Background(), alive, roster.ID, h.Sum(nil))
+	}
+	require.NoError(t, err)
+	require.NoError(t, res.Signature.VerifyAggregate(testSuite, msg, publics))
+}
+
+func TestService_RecoveredSignatureRoster(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	// the same message is signed by two rosters
+	msg := []byte("hello two rosters")
+	h := testSuite.Hash()
+	h.Write(msg)
+	rosters := []*onet.Roster{roster, onet.NewRoster(roster.List[:4])}
+	params := protocol.DefaultParams()
+	params.ShutdownTree = true
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	var sigs []protocol.BlsSignature
+	for _, ro := range rosters {
+		buf, err := service.SignatureRequest(&SignatureRequest{Roster: ro, Message: msg, Params: params})
+		require.NoError(t, err)
+		sigs = append(sigs, buf.(*SignatureResponse).Signature)
+	}
+	require.NotEqual(t, sigs[0], sigs[1])
+
+	other := hosts[1].Service(ServiceName).(*Service)
+	_, err := other.RecoveredSignature(&RecoveredSignatureRequest{Hash: h.Sum(nil)})
+	require.Error(t, err)
+
+	for i, ro := range rosters {
+		var buf network.Message
+		for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+			buf, err = other.RecoveredSignature(&RecoveredSignatureRequest{Hash: h.Sum(nil), RosterID: ro.ID[:]})
+			if err == nil {
+				break
+			}
+		}
+		require.NoError(t, err)
+
+		// the signature is the one of the roster, whose mask it refers to
+		sig := buf.(*SignatureResponse).Signature
+		require.Equal(t, sigs[i], sig)
+		require.NoError(t, sig.VerifyAggregate(testSuite, msg, ro.ServicePublics(ServiceName)))
+	}
+}
+
+func TestService_AsyncSignature(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+
+	_, err := service.SignatureStatus(&SignatureStatusRequest{RequestID: []byte("unknown")})
+	require.Error(t, err)
+
+	msg := []byte("hello async")
+	buf, err := service.SubmitSignature(&SubmitSignatureRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.NoError(t, err)
+	submitted := buf.(*SubmitSignatureResponse)
+	require.True(t, submitted.Node.Equal(hosts[0].ServerIdentity))
+
+	var status *SignatureStatusResponse
+	for i := 0; i < 50; i++ {
+		buf, err = service.SignatureStatus(&SignatureStatusRequest{RequestID: submitted.RequestID})
+		require.NoError(t, err)
+		status = buf.(*SignatureStatusResponse)
+		if status.Done {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.True(t, status.Done)
+	require.Empty(t, status.Error)
+	require.True(t, status.Signers >= protocol.DefaultThreshold(len(roster.List)))
+	require.True(t, status.Elapsed > 0)
+
+	buf, err = service.FetchSignature(&FetchSignatureRequest{RequestID: submitted.RequestID})
+	require.NoError(t, err)
+	res := buf.(*SignatureResponse)
+	require.NoError(t, res.Signature.VerifyAggregate(testSuite, msg, roster.ServicePublics(ServiceName)))
+
+	// completed requests are dropped after the retention period
+	service.Retention = 0
+	_, err = service.FetchSignature(&FetchSignatureRequest{RequestID: submitted.RequestID})
+	require.Error(t, err)
+}
+
+func TestService_SignatureStream(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	msg := []byte("hello stream")
+	updates, stop, err := service.SignatureStream(&SignatureStreamRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.NoError(t, err)
+	defer close(stop)
+
+	publics := roster.ServicePublics(ServiceName)
+	signers := 0
+	for update := range updates {
+		require.True(t, update.Signers > signers || update.Final)
+		signers = update.Signers
+		policy := sign.NewThresholdPolicy(update.Signers)
+		require.NoError(t, update.Signature.VerifyAggregateWithPolicy(testSuite, msg, publics, policy))
+		if update.Final {
+			require.NoError(t, update.Signature.VerifyAggregate(testSuite, msg, publics))
+			return
+		}
+	}
+	require.Fail(t, "no final update")
+}
+
+func TestService_LookupSignature(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	msg := []byte("hello store")
+	h := testSuite.Hash()
+	h.Write(msg)
+	hash := h.Sum(nil)
+
+	_, err := hosts[1].Service(ServiceName).(*Service).LookupSignature(&LookupSignatureRequest{Hash: hash})
+	require.Error(t, err)
+
+	_, err = hosts[0].Service(ServiceName).(*Service).SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.NoError(t, err)
+
+	// the root stores it right away, the other nodes once they got the
+	// shutdown
+	for _, host := range hosts {
+		var buf network.Message
+		for i := 0; i < 50; i++ {
+			buf, err = host.Service(ServiceName).(*Service).LookupSignature(&LookupSignatureRequest{
+				Hash:     hash,
+				RosterID: roster.ID[:],
+			})
+			if err == nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		require.NoError(t, err)
+		recs := buf.(*LookupSignatureResponse).Records
+		require.Equal(t, 1, len(recs))
+		require.Equal(t, StrategyGossip, recs[0].Strategy)
+		require.NoError(t, recs[0].Signature.VerifyAggregate(testSuite, msg, roster.ServicePublics(ServiceName)))
+	}
+
+	buf, err := hosts[0].Service(ServiceName).(*Service).LookupSignature(&LookupSignatureRequest{Hash: hash})
+	require.NoError(t, err)
+	require.NotEmpty(t, buf.(*LookupSignatureResponse).Records[0].Mask)
+}
+
+func TestService_SignatureRequestDedup(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	service.CacheTTL = time.Minute
+	msg := []byte("hello twice")
+
+	n := 4
+	sigs := make(chan protocol.BlsSignature, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			buf, err := service.SignatureRequest(&SignatureRequest{
+				Roster:  roster,
+				Message: msg,
+			})
+			if err != nil {
+				sigs <- nil
+				return
+			}
+			sigs <- buf.(*SignatureResponse).Signature
+		}()
+	}
+
+	first := <-sigs
+	require.NotNil(t, first)
+	for i := 1; i < n; i++ {
+		require.Equal(t, first, <-sigs)
+	}
+	require.Equal(t, 0, len(service.dedup.running))
+	require.Equal(t, 1, len(service.dedup.cache))
+
+	// answered by the cache
+	buf, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+	})
+	require.NoError(t, err)
+	require.Equal(t, first, buf.(*SignatureResponse).Signature)
+}
+
+func TestService_SignatureRequestQueue(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	service.MaxRounds = 1
+	service.MaxQueue = 1
+
+	// hold the only round so that the next requests have to wait
+	_, err := service.sched.acquire(0, service.MaxRounds, service.MaxQueue)
+	require.NoError(t, err)
+
+	resChan := make(chan *SignatureResponse, 1)
+	go func() {
+		buf, err := service.SignatureRequest(&SignatureRequest{
+			Roster:  roster,
+			Message: []byte("queued"),
+		})
+		if err != nil {
+			resChan <- nil
+			return
+		}
+		resChan <- buf.(*SignatureResponse)
+	}()
+
+	// wait for the request to be queued
+	for {
+		service.sched.Lock()
+		n := len(service.sched.queue)
+		service.sched.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the queue is full
+	_, err = service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: []byte("rejected"),
+	})
+	require.Error(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	service.sched.release()
+	res := <-resChan
+	require.NotNil(t, res)
+	require.True(t, res.QueueTime >= 100*time.Millisecond)
+
+	publics := roster.ServicePublics(ServiceName)
+	require.NoError(t, res.Signature.VerifyAggregate(testSuite, []byte("queued"), publics))
+}
+
+func TestService_MaxJoined(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, _, _ := local.GenTree(2, false)
+	defer local.CloseAll()
+
+	service := hosts[1].Service(ServiceName).(*Service)
+	service.MaxJoined = 1
+
+	require.NoError(t, service.sched.join(service.MaxJoined))
+	require.Error(t, service.sched.join(service.MaxJoined))
+	service.sched.leave()
+	require.NoError(t, service.sched.join(service.MaxJoined))
+}
+
+func TestService_CancelSignature(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	service.Threshold = len(roster.List)
+
+	// slow gossip so that the round is still running when cancelled
+	params := protocol.DefaultParams()
+	params.GossipTick = time.Second
+	params.RumorPeers = 1
+	buf, err := service.SubmitSignature(&SubmitSignatureRequest{
+		Roster:  roster,
+		Message: []byte("cancelled"),
+		Params:  params,
+	})
+	require.NoError(t, err)
+	id := buf.(*SubmitSignatureResponse).RequestID
+
+	_, err = service.CancelSignature(&CancelSignatureRequest{RequestID: id})
+	require.NoError(t, err)
+
+	var status *SignatureStatusResponse
+	for i := 0; i < 50; i++ {
+		buf, err = service.SignatureStatus(&SignatureStatusRequest{RequestID: id})
+		require.NoError(t, err)
+		status = buf.(*SignatureStatusResponse)
+		if status.Done {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.True(t, status.Done)
+	require.True(t, status.Cancelled)
+
+	_, err = service.FetchSignature(&FetchSignatureRequest{RequestID: id})
+	require.Equal(t, ErrCancelled, err)
+
+	_, err = service.CancelSignature(&CancelSignatureRequest{RequestID: id})
+	require.Error(t, err)
+}
+
+func TestService_SpoofedAbort(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	msg := []byte("not aborted")
+	service := hosts[0].Service(ServiceName).(*Service)
+	service.Threshold = len(hosts)
+	p, err := service.newSigning(roster, msg, protocol.Parameters{})
+	require.NoError(t, err)
+
+	// the forged aborts reach the nodes before the announcement
+	for _, child := range p.Children() {
+		require.NoError(t, p.SendTo(child, &protocol.Abort{RootSig: []byte("forged")}))
+	}
+	require.NoError(t, p.Start())
+
+	sig := <-p.FinalSignature
+	require.NotNil(t, sig)
+	require.False(t, p.Aborted())
+	publics := roster.ServicePublics(ServiceName)
+	require.NoError(t, sig.VerifyAggregateWithPolicy(testSuite, msg, publics, cosi.NewThresholdPolicy(len(hosts))))
+}
+
+func TestService_Traffic(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	p, err := service.startSigning(roster, []byte("counted"), protocol.Parameters{})
+	require.NoError(t, err)
+	require.NotNil(t, <-p.FinalSignature)
+
+	sent := p.Traffic().Sent()
+	require.True(t, sent["rumor"].Messages > 0)
+	require.True(t, sent["rumor"].Bytes > sent["rumor"].Messages)
+	require.True(t, p.Traffic().Received()["rumor"].Messages > 0)
+}
+
+func TestService_ShutdownTree(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(16, false)
+	defer local.CloseAll()
+
+	msg := []byte("hello shutdown tree")
+	h := testSuite.Hash()
+	h.Write(msg)
+	hash := h.Sum(nil)
+
+	// no random peers, the tree alone must reach every node
+	params := protocol.DefaultParams()
+	params.ShutdownTree = true
+	params.ShutdownPeers = 0
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	service.Threshold = len(hosts)
+	p, err := service.startSigning(roster, msg, params)
+	require.NoError(t, err)
+	require.NotNil(t, <-p.FinalSignature)
+
+	// the nodes keep the signature as soon as they got the shutdown, the
+	// delays are checked by the protocol tests
+	for i, host := range hosts[1:] {
+		var recs []SignatureRecord
+		for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+			buf, err := host.Service(ServiceName).(*Service).LookupSignature(&LookupSignatureRequest{
+				Hash:     hash,
+				RosterID: roster.ID[:],
+			})
+			if err == nil {
+				recs = buf.(*LookupSignatureResponse).Records
+				break
+			}
+		}
+		require.Equal(t, 1, len(recs), "node %d didn't shut down", i+1)
+	}
+}
+
+func TestService_SignatureRequestWeighted(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	msg := []byte("hello weights")
+	service := hosts[0].Service(ServiceName).(*Service)
+	publics := roster.ServicePublics(ServiceName)
+
+	// a weight is needed for every node
+	params := protocol.DefaultParams()
+	params.Weights = []int{1, 1}
+	params.WeightThreshold = 2
+	_, err := service.SignatureRequest(&SignatureRequest{Roster: roster, Message: msg, Params: params})
+	require.Error(t, err)
+
+	// the first node weighs as much as all the others together
+	params.Weights = []int{4, 1, 1, 1, 1}
+	params.WeightThreshold = 5
+	buf, err := service.SignatureRequest(&SignatureRequest{Roster: roster, Message: msg, Params: params})
+	require.NoError(t, err)
+	sig := buf.(*SignatureResponse).Signature
+
+	policy := protocol.NewWeightedPolicy(params.Weights, params.WeightThreshold)
+	require.NoError(t, sig.VerifyAggregateWithPolicy(testSuite, msg, publics, policy))
+	mask, err := sig.GetMask(testSuite, publics)
+	require.NoError(t, err)
+	require.True(t, policy.Weight(mask.Mask()) >= params.WeightThreshold)
+	require.Error(t, sig.VerifyAggregateWithPolicy(testSuite, msg, publics, protocol.NewWeightedPolicy(params.Weights, 9)))
+}
+
+func TestService_SignatureRequestPolicy(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(6, false)
+	defer local.CloseAll()
+
+	msg := []byte("hello policy")
+	service := hosts[0].Service(ServiceName).(*Service)
+	publics := roster.ServicePublics(ServiceName)
+
+	// a member outside of the roster is rejected
+	params := protocol.DefaultParams()
+	params.Policy = &protocol.Policy{Required: []int{6}}
+	_, err := service.SignatureRequest(&SignatureRequest{Roster: roster, Message: msg, Params: params})
+	require.Error(t, err)
+
+	// 2 of 3 organisations, each with a majority of its nodes, and node 5
+	params.Policy = &protocol.Policy{
+		Required: []int{5},
+		Groups: []protocol.PolicyGroup{
+			{Name: "a", Members: []int{0, 1}},
+			{Name: "b", Members: []int{2, 3}},
+			{Name: "c", Members: []int{4, 5}},
+		},
+		GroupQuorum: 2,
+	}
+	buf, err := service.SignatureRequest(&SignatureRequest{Roster: roster, Message: msg, Params: params})
+	require.NoError(t, err)
+	sig := buf.(*SignatureResponse).Signature
+	require.NoError(t, sig.VerifyAggregateWithPolicy(testSuite, msg, publics, params.Policy))
+
+	mask, err := sig.GetMask(testSuite, publics)
+	require.NoError(t, err)
+	require.True(t, params.Policy.Fulfilled(mask.Mask()))
+	require.False(t, params.Policy.Fulfilled([]byte{0x0f}))
+	require.True(t, params.Policy.Fulfilled([]byte{0x33}))
+}
@@ -0,0 +1,149 @@
+package blscosi_bundle
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle/protocol"
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/onet/v4/network"
+	"go.dedis.ch/protobuf"
+	"go.etcd.io/bbolt"
+)
+
+// signaturesBucket is the name of the bucket of the issued signatures.
+var signaturesBucket = []byte("signatures")
+
+// Strategies recorded along with the signatures
+const (
+	StrategyGossip     = "gossip"
+	StrategyLeaderless = "leaderless"
+	StrategyBatch      = "batch"
+	StrategyThreshold  = "threshold"
+	StrategySession    = "session"
+)
+
+// SignatureRecord is a signature kept by a node. Started and Finished are
+// Unix times in nanoseconds. Root and Proof are only set for the signatures
+// of a batch, and Mask is empty for threshold signatures.
+type SignatureRecord struct {
+	Hash      []byte
+	RosterID  []byte
+	Signature protocol.BlsSignature
+	Mask      []byte
+	Strategy  string
+	Started   int64
+	Finished  int64
+	Root      []byte
+	Proof     []MerkleStep
+}
+
+// LookupSignatureRequest asks a node for the signatures it keeps for the hash
+// of a message. If RosterID is set, only the signatures of that roster are
+// returned.
+type LookupSignatureRequest struct {
+	Hash     []byte
+	RosterID []byte
+}
+
+// LookupSignatureResponse contains the signatures kept for the hash.
+type LookupSignatureResponse struct {
+	Records []SignatureRecord
+}
+
+// signatureStore persists the signatures in the database of the node. The
+// key is the hash of the message followed by the ID of the roster.
+type signatureStore struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+func newSignatureStore(db *bbolt.DB, bucket []byte) *signatureStore {
+	return &signatureStore{db: db, bucket: bucket}
+}
+
+// put stores a record, replacing the previous one of the same hash and
+// roster.
+func (st *signatureStore) put(rec *SignatureRecord) error {
+	buf, err := protobuf.Encode(rec)
+	if err != nil {
+		return err
+	}
+	key := append(append([]byte{}, rec.Hash...), rec.RosterID...)
+	return st.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(st.bucket).Put(key, buf)
+	})
+}
+
+// lookup returns the records of the hash, restricted to the roster if
+// rosterID is not empty.
+func (st *signatureStore) lookup(hash, rosterID []byte) ([]SignatureRecord, error) {
+	var recs []SignatureRecord
+	prefix := append(append([]byte{}, hash...), rosterID...)
+	err := st.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(st.bucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var rec SignatureRecord
+			if err := protobuf.Decode(v, &rec); err != nil {
+				return err
+			}
+			// the hash is a prefix of the key, make sure it's all of it
+			if bytes.Equal(rec.Hash, hash) {
+				recs = append(recs, rec)
+			}
+		}
+		return nil
+	})
+	return recs, err
+}
+
+// newRecord creates the record of a signature issued for the roster.
+func newRecord(hash []byte, roster *onet.Roster, sig protocol.BlsSignature,
+	strategy string, started time.Time) *SignatureRecord {
+	rec := &SignatureRecord{
+		Hash:      hash,
+		RosterID:  roster.ID[:],
+		Signature: sig,
+		Strategy:  strategy,
+		Started:   started.UnixNano(),
+		Finished:  time.Now().UnixNano(),
+	}
+	if strategy == StrategyThreshold {
+		return rec
+	}
+	if mask, err := sig.GetMask(suite, roster.ServicePublics(ServiceName)); err == nil {
+		rec.Mask = mask.Mask()
+	}
+	return rec
+}
+
+// gossipStrategy returns the strategy of the gossip protocol run with the
+// parameters.
+func gossipStrategy(params protocol.Parameters) string {
+	if params.Leaderless {
+		return StrategyLeaderless
+	}
+	return StrategyGossip
+}
+
+// storeSignature keeps the record of a signature, failures are only logged
+// as the signature has been issued anyway.
+func (s *Service) storeSignature(rec *SignatureRecord) {
+	if err := s.signatures.put(rec); err != nil {
+		log.Error("Couldn't store the signature:", err)
+	}
+}
+
+// LookupSignature returns the signatures this node keeps for a hash.
+func (s *Service) LookupSignature(req *LookupSignatureRequest) (network.Message, error) {
+	recs, err := s.signatures.lookup(req.Hash, req.RosterID)
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, errors.New("no signature for this hash")
+	}
+	return &LookupSignatureResponse{Records: recs}, nil
+}
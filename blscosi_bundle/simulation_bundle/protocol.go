@@ -49,7 +49,10 @@ type SimulationProtocol struct {
 	GossipTick    float64
 	RumorPeers    int
 	ShutdownPeers int
+	Adaptive      int
+	MaxRumorPeers int
 	TreeMode      int
+	ShutdownTree  int
 }
 
 // NewSimulationProtocol is used internally to register the simulation (see the init()
@@ -98,7 +101,8 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 			}
 
 			switch msg.(type) {
-			case *protocol.Rumor, *protocol.Shutdown:
+			case *protocol.Rumor, *protocol.Shutdown, *protocol.CompactRumor, *protocol.CompactShutdown,
+				*protocol.MessageRequest, *protocol.MessageReply:
 				sleepSecs := rand.Float64()*(s.MaxDelay-s.MinDelay) + s.MinDelay
 				sleepNsecs := sleepSecs * float64(time.Second/time.Nanosecond)
 				log.Lvlf3("Delaying message by %.3f for simulation on %v", sleepSecs, config.Server.ServerIdentity)
@@ -128,7 +132,8 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 				}
 
 				switch msg.(type) {
-				case *protocol.Rumor, *protocol.Shutdown:
+				case *protocol.Rumor, *protocol.Shutdown, *protocol.CompactRumor, *protocol.CompactShutdown,
+					*protocol.MessageRequest, *protocol.MessageReply:
 					log.Lvl2("Ignoring blscosi message for simulation on ", config.Server.ServerIdentity)
 				default:
 					config.Overlay.Process(e)
@@ -139,6 +144,9 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 		}
 	}
 
+	// count the messages of every round per type
+	protocol.RecordTraffic = true
+
 	log.Lvl3("Initializing node-index", index)
 	return s.SimulationBFTree.Node(config)
 }
@@ -161,7 +169,10 @@ func (s *SimulationProtocol) Run(config *onet.SimulationConfig) error {
 			GossipTick:    time.Duration(s.GossipTick * float64(time.Second/time.Nanosecond)),
 			RumorPeers:    s.RumorPeers,
 			ShutdownPeers: s.ShutdownPeers,
+			Adaptive:      s.Adaptive != 0,
+			MaxRumorPeers: s.MaxRumorPeers,
 			TreeMode:      s.TreeMode != 0,
+			ShutdownTree:  s.ShutdownTree != 0,
 		}
 
 		client := blscosi.NewClient()
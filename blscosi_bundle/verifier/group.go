@@ -0,0 +1,64 @@
+package verifier
+
+import (
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign"
+)
+
+// Server is a member of a group
+type Server struct {
+	Address     string
+	Description string
+	// Public is the key of the server for the signing service
+	Public kyber.Point
+	// Weight is the weight of the server, which is 1 if the group has no
+	// weights
+	Weight int
+}
+
+// Group is a group definition, which the grouptoml package reads from the
+// TOML files of the conodes
+type Group struct {
+	Servers []*Server
+	// Policy is the compound policy of the group, if it has one
+	Policy *Policy
+	// Weighted is true if the servers have weights, whose threshold is
+	// WeightThreshold
+	Weighted        bool
+	WeightThreshold int
+}
+
+// Publics returns the public keys of the servers, in order
+func (g *Group) Publics() []kyber.Point {
+	publics := make([]kyber.Point, len(g.Servers))
+	for i, srv := range g.Servers {
+		publics[i] = srv.Public
+	}
+	return publics
+}
+
+// Weights returns the weights of the servers, in order, or nil if the group
+// has no weights
+func (g *Group) Weights() []int {
+	if !g.Weighted {
+		return nil
+	}
+	weights := make([]int, len(g.Servers))
+	for i, srv := range g.Servers {
+		weights[i] = srv.Weight
+	}
+	return weights
+}
+
+// SignPolicy returns the policy of the signatures of the group: its compound
+// policy if it has one, the weighted one if its servers have weights, and
+// the default threshold otherwise.
+func (g *Group) SignPolicy() sign.Policy {
+	if g.Policy != nil {
+		return g.Policy
+	}
+	if g.Weighted {
+		return NewWeightedPolicy(g.Weights(), g.WeightThreshold)
+	}
+	return sign.NewThresholdPolicy(DefaultThreshold(len(g.Servers)))
+}
@@ -0,0 +1,88 @@
+// Package grouptoml reads the group definitions of the conodes for the
+// verifier, which doesn't depend on a TOML parser.
+package grouptoml
+
+import (
+	"io"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dedis/student_19_elias/blscosi_bundle/verifier"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/util/encoding"
+)
+
+// ServiceName is the name of the collective signing service in the group
+// definitions, under which the servers give the public key they sign with
+const ServiceName = "bundleCoSiService"
+
+// groupToml is a group definition as it is written in a TOML file
+type groupToml struct {
+	Servers []struct {
+		Address     string
+		Description string
+		Public      string
+		Services    map[string]struct {
+			Public string
+			Suite  string
+		}
+		Weight int
+	}
+	Policy          *verifier.Policy
+	WeightThreshold int
+}
+
+// Read reads a group definition. The public key of a server is the one it
+// has for the service, or its own key if it has none.
+func Read(suite pairing.Suite, r io.Reader, service string) (*verifier.Group, error) {
+	var gt groupToml
+	if _, err := toml.DecodeReader(r, &gt); err != nil {
+		return nil, err
+	}
+
+	g := &verifier.Group{Policy: gt.Policy, WeightThreshold: gt.WeightThreshold}
+	weights := make([]int, len(gt.Servers))
+	for i, st := range gt.Servers {
+		pubHex := st.Public
+		if srv, ok := st.Services[service]; ok {
+			pubHex = srv.Public
+		}
+		pub, err := encoding.StringHexToPoint(suite.G2(), pubHex)
+		if err != nil {
+			return nil, err
+		}
+
+		weights[i] = st.Weight
+		if st.Weight == 0 {
+			weights[i] = 1
+		} else {
+			g.Weighted = true
+		}
+		g.Servers = append(g.Servers, &verifier.Server{
+			Address:     st.Address,
+			Description: st.Description,
+			Public:      pub,
+			Weight:      weights[i],
+		})
+	}
+	if g.Weighted && g.WeightThreshold <= 0 {
+		g.WeightThreshold = verifier.DefaultWeightThreshold(weights)
+	}
+
+	if g.Policy != nil {
+		if err := g.Policy.Validate(len(g.Servers)); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// ReadFile reads the group definition of a file, see Read
+func ReadFile(suite pairing.Suite, fileName, service string) (*verifier.Group, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(suite, f, service)
+}
@@ -0,0 +1,61 @@
+package grouptoml
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+var testSuite = pairing.NewSuiteBn256()
+
+// testGroup returns the TOML definition of a group of n servers, the first
+// of which weighs 3, with their keys for the service
+func testGroup(t *testing.T, n int) (string, []kyber.Point) {
+	var b strings.Builder
+	publics := make([]kyber.Point, n)
+	for i := 0; i < n; i++ {
+		_, pub := bdn.NewKeyPair(testSuite, random.New())
+		publics[i] = pub
+
+		pubHex, err := encoding.PointToStringHex(testSuite, pub)
+		require.NoError(t, err)
+		weight := 1
+		if i == 0 {
+			weight = 3
+		}
+		fmt.Fprintf(&b, "[[servers]]\n  Address = \"tls://127.0.0.1:%d\"\n  Description = \"node %d\"\n"+
+			"  Public = \"00\"\n  Weight = %d\n  [servers.Services.%s]\n    Public = \"%s\"\n",
+			7000+2*i, i, weight, ServiceName, pubHex)
+	}
+	return b.String(), publics
+}
+
+func TestRead(t *testing.T) {
+	groupToml, publics := testGroup(t, 5)
+
+	g, err := Read(testSuite, strings.NewReader(groupToml), ServiceName)
+	require.NoError(t, err)
+	require.Len(t, g.Servers, 5)
+	require.Equal(t, "node 2", g.Servers[2].Description)
+	require.Equal(t, "tls://127.0.0.1:7004", g.Servers[2].Address)
+	for i, pub := range g.Publics() {
+		require.True(t, pub.Equal(publics[i]))
+	}
+	require.Equal(t, []int{3, 1, 1, 1, 1}, g.Weights())
+	require.Equal(t, 5, g.WeightThreshold)
+
+	// the servers have no key of their own for another service
+	_, err = Read(testSuite, strings.NewReader(groupToml), "anotherService")
+	require.Error(t, err)
+
+	// a policy without clause is rejected
+	_, err = Read(testSuite, strings.NewReader(groupToml+"[Policy]\n  Threshold = 0\n"), ServiceName)
+	require.Error(t, err)
+}
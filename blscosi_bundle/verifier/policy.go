@@ -0,0 +1,191 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+
+	"go.dedis.ch/kyber/v3/sign"
+)
+
+// Policy is a compound policy, fulfilled when all of its clauses are. A
+// clause left empty always holds. The nodes are given by their index in the
+// roster.
+type Policy struct {
+	// Threshold is the minimal number of signers
+	Threshold int
+	// Required are the nodes that must sign
+	Required []int
+	// Weights and WeightThreshold are a weighted clause, see WeightedPolicy
+	Weights         []int
+	WeightThreshold int
+	// Groups are groups of nodes, such as organisations, and GroupQuorum the
+	// number of them that must reach their own quorum. Zero means all of
+	// them.
+	Groups      []PolicyGroup
+	GroupQuorum int
+}
+
+// PolicyGroup is a group of nodes of a compound policy. It reaches its quorum
+// when Quorum of its members sign, or a majority of them if Quorum is zero.
+type PolicyGroup struct {
+	Name    string
+	Members []int
+	Quorum  int
+}
+
+// Validate checks that the policy applies to a roster of n nodes and that it
+// has at least one clause.
+func (pol *Policy) Validate(n int) error {
+	if pol.Threshold <= 0 && len(pol.Required) == 0 && pol.WeightThreshold <= 0 && len(pol.Groups) == 0 {
+		return errors.New("the policy has no clause")
+	}
+	if pol.Threshold > n {
+		return fmt.Errorf("threshold (%d) bigger than number of nodes (%d)", pol.Threshold, n)
+	}
+	for _, idx := range pol.Required {
+		if idx < 0 || idx >= n {
+			return fmt.Errorf("required node %d not in the roster", idx)
+		}
+	}
+	if pol.WeightThreshold > 0 && len(pol.Weights) != n {
+		return fmt.Errorf("%d weights for %d nodes", len(pol.Weights), n)
+	}
+	total := 0
+	for i, w := range pol.Weights {
+		if w < 0 {
+			return fmt.Errorf("negative weight for node %d", i)
+		}
+		total += w
+	}
+	if pol.WeightThreshold > total {
+		return fmt.Errorf("weight threshold (%d) bigger than the total weight (%d)", pol.WeightThreshold, total)
+	}
+	if pol.GroupQuorum > len(pol.Groups) {
+		return fmt.Errorf("group quorum (%d) bigger than number of groups (%d)", pol.GroupQuorum, len(pol.Groups))
+	}
+	for _, g := range pol.Groups {
+		if g.Quorum > len(g.Members) {
+			return fmt.Errorf("quorum of group %s bigger than its number of members", g.Name)
+		}
+		for _, idx := range g.Members {
+			if idx < 0 || idx >= n {
+				return fmt.Errorf("member %d of group %s not in the roster", idx, g.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Fulfilled returns true if the participants of the raw mask fulfill all the
+// clauses of the policy.
+func (pol *Policy) Fulfilled(mask []byte) bool {
+	if pol.Threshold > 0 && countSigners(mask, nil) < pol.Threshold {
+		return false
+	}
+	for _, idx := range pol.Required {
+		if !hasSigned(mask, idx) {
+			return false
+		}
+	}
+	if pol.WeightThreshold > 0 && NewWeightedPolicy(pol.Weights, pol.WeightThreshold).Weight(mask) < pol.WeightThreshold {
+		return false
+	}
+
+	reached := 0
+	for _, g := range pol.Groups {
+		quorum := g.Quorum
+		if quorum <= 0 {
+			quorum = len(g.Members)/2 + 1
+		}
+		if countSigners(mask, g.Members) >= quorum {
+			reached++
+		}
+	}
+	groupQuorum := pol.GroupQuorum
+	if groupQuorum <= 0 {
+		groupQuorum = len(pol.Groups)
+	}
+	return reached >= groupQuorum
+}
+
+// Check implements sign.Policy.
+func (pol *Policy) Check(m *sign.Mask) bool {
+	return pol.Fulfilled(m.Mask())
+}
+
+// WeightedPolicy is fulfilled when the summed weight of the signers reaches
+// the threshold. The weights are in the order of the public keys of the mask.
+type WeightedPolicy struct {
+	weights   []int
+	threshold int
+}
+
+// NewWeightedPolicy returns the policy that needs signers weighing at least
+// threshold.
+func NewWeightedPolicy(weights []int, threshold int) *WeightedPolicy {
+	return &WeightedPolicy{weights, threshold}
+}
+
+// Weight returns the summed weight of the participants of the raw mask.
+func (wp *WeightedPolicy) Weight(mask []byte) int {
+	weight := 0
+	for i, w := range wp.weights {
+		if hasSigned(mask, i) {
+			weight += w
+		}
+	}
+	return weight
+}
+
+// Threshold returns the weight that the signers must reach.
+func (wp *WeightedPolicy) Threshold() int {
+	return wp.threshold
+}
+
+// Check implements sign.Policy.
+func (wp *WeightedPolicy) Check(m *sign.Mask) bool {
+	return wp.Weight(m.Mask()) >= wp.threshold
+}
+
+// DefaultThreshold computes the minimal threshold authorized using
+// the formula 3f+1
+func DefaultThreshold(n int) int {
+	f := (n - 1) / 3
+	return n - f
+}
+
+// DefaultWeightThreshold computes the minimal weight threshold authorized
+// using the formula 3f+1 on the total weight
+func DefaultWeightThreshold(weights []int) int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	f := (total - 1) / 3
+	return total - f
+}
+
+// hasSigned returns true if the node at idx participates in the raw mask.
+func hasSigned(mask []byte, idx int) bool {
+	return idx>>3 < len(mask) && mask[idx>>3]&(1<<uint(idx&7)) != 0
+}
+
+// countSigners returns the number of participants of the raw mask among the
+// members, or among all the nodes if members is nil.
+func countSigners(mask []byte, members []int) int {
+	count := 0
+	if members == nil {
+		for i := 0; i < len(mask)*8; i++ {
+			if hasSigned(mask, i) {
+				count++
+			}
+		}
+		return count
+	}
+	for _, idx := range members {
+		if hasSigned(mask, idx) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,116 @@
+// Package verifier verifies collective signatures without the networking
+// library of the conodes: it only needs kyber, the public keys of the
+// signers, or a group definition, and the signature. Besides kyber, it only
+// imports the container package, which depends on kyber alone. It is meant
+// to be embedded in light clients and in other services, the grouptoml
+// package reads the group definitions of TOML files.
+package verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle/container"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign"
+)
+
+// Signers is the set of nodes that produced a verified signature
+type Signers struct {
+	// Indices are the indices of the signers in the roster
+	Indices []int
+	// Publics are the public keys of the signers
+	Publics []kyber.Point
+	// Mask is the participation mask, in the order of the roster
+	Mask []byte
+}
+
+// Parse decodes a signature, which is either the binary encoding of a
+// container, its JSON form, or a legacy signature.
+func Parse(suite pairing.Suite, sig []byte) (*container.Container, error) {
+	// a raw signature can start like a JSON object too
+	if len(sig) > 0 && sig[0] == '{' {
+		c := &container.Container{}
+		if err := json.Unmarshal(sig, c); err == nil {
+			return c, nil
+		}
+	}
+	return container.Parse(suite, sig)
+}
+
+// Verify checks the signature of msg by the nodes of the public keys and
+// returns its signers. The signers must fulfill policy, or the default
+// threshold if it is nil, and the policy of the signature if it gives one. A
+// threshold signature is verified with the single public key of the group.
+func Verify(suite pairing.Suite, publics []kyber.Point, msg, sig []byte, policy sign.Policy) (*Signers, error) {
+	c, err := Parse(suite, sig)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyContainer(suite, publics, msg, c, policy)
+}
+
+// VerifyContainer is Verify with a parsed signature.
+func VerifyContainer(suite pairing.Suite, publics []kyber.Point, msg []byte, c *container.Container,
+	policy sign.Policy) (*Signers, error) {
+	if policy == nil && c.Scheme != container.SchemeThreshold {
+		policy = sign.NewThresholdPolicy(DefaultThreshold(len(publics)))
+	}
+	// the policy of the container isn't signed, it can only add to ours
+	extra, err := ContainerPolicy(c, len(publics))
+	if err != nil {
+		return nil, err
+	}
+
+	mask, err := c.Verify(suite, msg, publics, policy)
+	if err != nil {
+		return nil, err
+	}
+	if extra != nil && !extra.Check(mask) {
+		return nil, errors.New("the policy of the signature is not fulfilled")
+	}
+
+	signers := &Signers{Mask: mask.Mask()}
+	for i, pub := range publics {
+		if hasSigned(signers.Mask, i) {
+			signers.Indices = append(signers.Indices, i)
+			signers.Publics = append(signers.Publics, pub)
+		}
+	}
+	return signers, nil
+}
+
+// VerifyGroup checks the signature of msg by the servers of the group and
+// returns its signers. The signers must fulfill the policy of the group, and
+// the policy of the signature if it gives one.
+func VerifyGroup(suite pairing.Suite, g *Group, msg, sig []byte) (*Signers, error) {
+	c, err := Parse(suite, sig)
+	if err != nil {
+		return nil, err
+	}
+	if c.Scheme == container.SchemeThreshold {
+		return nil, errors.New("a threshold signature is verified with the public key of the group")
+	}
+
+	return VerifyContainer(suite, g.Publics(), msg, c, g.SignPolicy())
+}
+
+// ContainerPolicy returns the policy given by the container for n nodes, or
+// nil if it gives none or for a threshold signature. Anyone can change the
+// policy of a container, so it only applies on top of the policy of the
+// verifier.
+func ContainerPolicy(c *container.Container, n int) (*Policy, error) {
+	if c.Scheme == container.SchemeThreshold || len(c.Policy) == 0 {
+		return nil, nil
+	}
+	pol := &Policy{}
+	if err := json.Unmarshal(c.Policy, pol); err != nil {
+		return nil, fmt.Errorf("couldn't decode policy: %s", err)
+	}
+	if err := pol.Validate(n); err != nil {
+		return nil, err
+	}
+	return pol, nil
+}
@@ -0,0 +1,143 @@
+package verifier
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dedis/student_19_elias/blscosi_bundle/container"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/sign"
+	"go.dedis.ch/kyber/v3/sign/bdn"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+var testSuite = pairing.NewSuiteBn256()
+
+// testGroup returns a group of n servers, the first of which weighs 3, with
+// the signatures of msg by each of them
+func testGroup(t *testing.T, n int, msg []byte) (*Group, [][]byte) {
+	g := &Group{Weighted: true}
+	sigs := make([][]byte, n)
+	weights := make([]int, n)
+	for i := 0; i < n; i++ {
+		sk, pub := bdn.NewKeyPair(testSuite, random.New())
+		sig, err := bdn.Sign(testSuite, sk, msg)
+		require.NoError(t, err)
+		sigs[i] = sig
+
+		weights[i] = 1
+		if i == 0 {
+			weights[i] = 3
+		}
+		g.Servers = append(g.Servers, &Server{
+			Address:     fmt.Sprintf("tls://127.0.0.1:%d", 7000+2*i),
+			Description: fmt.Sprintf("node %d", i),
+			Public:      pub,
+			Weight:      weights[i],
+		})
+	}
+	g.WeightThreshold = DefaultWeightThreshold(weights)
+	return g, sigs
+}
+
+// aggregate returns the legacy signature of the given signers
+func aggregate(t *testing.T, publics []kyber.Point, sigs [][]byte, signers ...int) []byte {
+	mask, err := sign.NewMask(testSuite, publics, nil)
+	require.NoError(t, err)
+	var parts [][]byte
+	for _, i := range signers {
+		require.NoError(t, mask.SetBit(i, true))
+		parts = append(parts, sigs[i])
+	}
+	agg, err := bdn.AggregateSignatures(testSuite, parts, mask)
+	require.NoError(t, err)
+	raw, err := agg.MarshalBinary()
+	require.NoError(t, err)
+	return append(raw, mask.Mask()...)
+}
+
+func TestVerifyGroup(t *testing.T) {
+	msg := []byte("hello verifier")
+	g, sigs := testGroup(t, 5, msg)
+	require.Equal(t, []int{3, 1, 1, 1, 1}, g.Weights())
+	require.Equal(t, 5, g.WeightThreshold)
+	publics := g.Publics()
+
+	// the first node weighs as much as three others
+	sig := aggregate(t, publics, sigs, 0, 3, 4)
+	signers, err := VerifyGroup(testSuite, g, msg, sig)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 3, 4}, signers.Indices)
+	require.Equal(t, publics[3], signers.Publics[1])
+
+	// but not enough for the default threshold of the keys alone
+	_, err = Verify(testSuite, publics, msg, sig, nil)
+	require.Error(t, err)
+	_, err = VerifyGroup(testSuite, g, []byte("another message"), sig)
+	require.Error(t, err)
+
+	// the policy of a container applies on top of the one of the group
+	c, err := container.FromLegacy(testSuite, sig)
+	require.NoError(t, err)
+	c.Policy = []byte(`{"Required":[1]}`)
+	_, err = VerifyGroup(testSuite, g, msg, c.Encode())
+	require.Error(t, err)
+}
+
+func TestVerifyGroup_ContainerPolicy(t *testing.T) {
+	msg := []byte("hello verifier")
+	g, sigs := testGroup(t, 5, msg)
+	publics := g.Publics()
+
+	// a container can't weaken the policy of the group, nor the default
+	// threshold
+	c, err := container.FromLegacy(testSuite, aggregate(t, publics, sigs, 1, 2))
+	require.NoError(t, err)
+	c.Policy = []byte(`{"Threshold":1}`)
+	js, err := c.MarshalJSON()
+	require.NoError(t, err)
+	_, err = VerifyGroup(testSuite, g, msg, js)
+	require.Error(t, err)
+	_, err = Verify(testSuite, publics, msg, c.Encode(), nil)
+	require.Error(t, err)
+
+	// but the signers still fulfill it on its own
+	signers, err := Verify(testSuite, publics, msg, c.Encode(), sign.NewThresholdPolicy(2))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, signers.Indices)
+}
+
+func TestPolicyValidate(t *testing.T) {
+	require.NoError(t, (&Policy{Threshold: 2, Required: []int{0}}).Validate(3))
+	require.NoError(t, (&Policy{Weights: []int{3, 1, 1}, WeightThreshold: 4}).Validate(3))
+
+	// a policy without clause would accept any signature
+	require.Error(t, (&Policy{}).Validate(3))
+	require.Error(t, (&Policy{Weights: []int{3, 1, 1}}).Validate(3))
+	require.Error(t, (&Policy{Weights: []int{3, -1, 1}, WeightThreshold: 2}).Validate(3))
+	require.Error(t, (&Policy{Weights: []int{3, 1, 1}, WeightThreshold: 6}).Validate(3))
+	require.Error(t, (&Policy{Threshold: 4}).Validate(3))
+}
+
+func TestParse(t *testing.T) {
+	// a raw signature can start with the same byte as a JSON object
+	raw := make([]byte, testSuite.G1().PointLen()+1)
+	raw[0] = '{'
+	raw[len(raw)-1] = 0x1f
+	c, err := Parse(testSuite, raw)
+	require.NoError(t, err)
+	require.Equal(t, container.SchemeBDN, c.Scheme)
+	require.Equal(t, raw[:len(raw)-1], c.Signature)
+	require.Equal(t, []byte{0x1f}, c.Mask)
+
+	js, err := c.MarshalJSON()
+	require.NoError(t, err)
+	c2, err := Parse(testSuite, js)
+	require.NoError(t, err)
+	require.Equal(t, c.Encode(), c2.Encode())
+
+	_, err = Parse(testSuite, []byte("{}"))
+	require.Error(t, err)
+}
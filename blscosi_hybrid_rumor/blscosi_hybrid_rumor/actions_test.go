@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -10,6 +13,7 @@ import (
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/onet/v4"
 	"go.dedis.ch/onet/v4/app"
+	"go.dedis.ch/onet/v4/network"
 )
 
 var testSuite = pairing.NewSuiteBn256()
@@ -85,3 +89,47 @@ func TestMain_Sign(t *testing.T) {
 	err = cliApp.Run([]string{"", "verify", "-g", publicToml, "-s", signatureFile, signatureFile})
 	require.Error(t, err)
 }
+
+// TestMain_Inspect checks if the CLI command inspect explains a signature
+func TestMain_Inspect(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	os.Chdir(tmp)
+
+	publicToml := path.Join(tmp, "public.toml")
+	signatureFile := path.Join(tmp, "sig.json")
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(5, true)
+	group := &app.Group{Roster: roster, Description: map[*network.ServerIdentity]string{}}
+	for i, si := range roster.List {
+		group.Description[si] = fmt.Sprintf("node %d", i)
+	}
+	require.NoError(t, group.Save(testSuite, publicToml))
+
+	cliApp := createApp()
+	err := cliApp.Run([]string{"", "sign", "-g", publicToml, "-o", signatureFile, publicToml})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	cliApp.Writer = &out
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-s", signatureFile, "--json", publicToml})
+	require.NoError(t, err)
+	report := &inspectReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), report))
+	require.True(t, *report.FileMatches)
+	require.True(t, *report.Valid)
+	require.Equal(t, 4, report.Threshold)
+	require.True(t, len(report.Signers) >= report.Threshold)
+	require.Equal(t, 5, len(report.Signers)+len(report.Missing))
+	require.Equal(t, fmt.Sprintf("node %d", report.Signers[0].Index), report.Signers[0].Description)
+
+	// another file
+	out.Reset()
+	err = cliApp.Run([]string{"", "inspect", "-g", publicToml, "-s", signatureFile, signatureFile})
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "hash matches: false")
+	require.Contains(t, out.String(), "of 5, threshold 4")
+}
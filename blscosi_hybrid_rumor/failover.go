@@ -0,0 +1,224 @@
+package blscosi_hybrid_rumor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/onet/v4/network"
+)
+
+// defaultAttemptTimeout is the time given to an entry node to answer a ping
+// before the client tries the next one.
+const defaultAttemptTimeout = 5 * time.Second
+
+// defaultRequestTimeout is the time given to an entry node to answer a
+// request when the context has no deadline. It leaves the node the time of a
+// whole round.
+const defaultRequestTimeout = 2 * protocolTimeout
+
+// EntryStrategy defines the order in which the client tries the members of
+// the roster as entry node.
+type EntryStrategy int
+
+const (
+	// EntryFirst tries the nodes in the order of the roster.
+	EntryFirst EntryStrategy = iota
+	// EntryRandom tries the nodes in a random order.
+	EntryRandom
+	// EntryLatency tries the nodes with the lowest measured latency first.
+	EntryLatency
+)
+
+// ParseEntryStrategy returns the strategy with the given name, which is one of
+// first, random or latency.
+func ParseEntryStrategy(name string) (EntryStrategy, error) {
+	switch name {
+	case "first":
+		return EntryFirst, nil
+	case "random":
+		return EntryRandom, nil
+	case "latency":
+		return EntryLatency, nil
+	}
+	return EntryFirst, fmt.Errorf("unknown entry strategy %q", name)
+}
+
+// NodeError is the reason why a request failed on an entry node.
+type NodeError struct {
+	Node *network.ServerIdentity
+	Err  error
+}
+
+// FailoverError is returned when no entry node could answer a request. It
+// lists the nodes that have been tried, in order.
+type FailoverError struct {
+	Tried []NodeError
+}
+
+func (e *FailoverError) Error() string {
+	reasons := make([]string, len(e.Tried))
+	for i, ne := range e.Tried {
+		reasons[i] = fmt.Sprintf("%v: %v", ne.Node.Address, ne.Err)
+	}
+	return fmt.Sprintf("request failed on %d node(s): %s", len(e.Tried), strings.Join(reasons, "; "))
+}
+
+// sendFunc sends a request to a single entry node and returns its reply.
+type sendFunc func(dst *network.ServerIdentity) (interface{}, error)
+
+// failover sends the request to the first member of the roster, in the order
+// of the strategy of the client, that answers a ping within the attempt
+// timeout. The nodes that can't be reached are skipped, and so are the nodes
+// that don't reply to the request in time, see requestTimeout. An error
+// replied by a node is final: signing rounds and the DKG setup aren't
+// idempotent, so they aren't run again on another node.
+func (c *Client) failover(ctx context.Context, r *onet.Roster, send sendFunc) (interface{}, error) {
+	if r == nil || len(r.List) == 0 {
+		return nil, errors.New("Got an empty roster-list")
+	}
+
+	nodes, err := c.entryNodes(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	failure := &FailoverError{}
+	for i, dst := range nodes {
+		if _, err := c.attempt(ctx, c.AttemptTimeout, dst, c.ping); err != nil {
+			log.Lvl2("Skipping unreachable", dst, ":", err)
+			failure.Tried = append(failure.Tried, NodeError{dst, err})
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		log.Lvl4("Sending request to", dst)
+		reply, err := c.attempt(ctx, requestTimeout(ctx, i == len(nodes)-1), dst, send)
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			log.Lvl2("Skipping", dst, "that didn't reply in time")
+			failure.Tried = append(failure.Tried, NodeError{dst, err})
+			continue
+		}
+		if err != nil {
+			failure.Tried = append(failure.Tried, NodeError{dst, err})
+			return nil, failure
+		}
+		return reply, nil
+	}
+	return nil, failure
+}
+
+// requestTimeout returns the time given to an entry node to reply to the
+// request. It is half of the time left before the deadline of the context,
+// so that the next nodes can be tried as well, and only the context limits
+// the last node.
+func requestTimeout(ctx context.Context, last bool) time.Duration {
+	if last {
+		return 0
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultRequestTimeout
+	}
+	if left := time.Until(deadline) / 2; left > 0 {
+		return left
+	}
+	// the context is done anyway
+	return 0
+}
+
+// attempt sends the request to a single node and gives up when the context is
+// done or, if timeout isn't zero, when the node takes longer to reply.
+func (c *Client) attempt(ctx context.Context, timeout time.Duration, dst *network.ServerIdentity,
+	send sendFunc) (interface{}, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	// buffered so that an abandoned attempt doesn't leak
+	resChan := make(chan result, 1)
+	go func() {
+		reply, err := send(dst)
+		resChan <- result{reply, err}
+	}()
+
+	select {
+	case res := <-resChan:
+		return res.reply, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ping checks that the node is reachable
+func (c *Client) ping(dst *network.ServerIdentity) (interface{}, error) {
+	reply := &PingResponse{}
+	return reply, c.SendProtobuf(dst, &PingRequest{}, reply)
+}
+
+// entryNodes returns the members of the roster in the order they should be
+// tried.
+func (c *Client) entryNodes(ctx context.Context, r *onet.Roster) ([]*network.ServerIdentity, error) {
+	nodes := make([]*network.ServerIdentity, len(r.List))
+	copy(nodes, r.List)
+
+	switch c.Strategy {
+	case EntryFirst:
+	case EntryRandom:
+		rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+	case EntryLatency:
+		lats := c.MeasureLatencies(ctx, r)
+		sort.SliceStable(nodes, func(i, j int) bool {
+			li, oki := lats[nodes[i].ID]
+			lj, okj := lats[nodes[j].ID]
+			if oki != okj {
+				// unreachable nodes are tried last
+				return oki
+			}
+			return li < lj
+		})
+	default:
+		return nil, fmt.Errorf("unknown entry strategy %d", c.Strategy)
+	}
+	return nodes, nil
+}
+
+// MeasureLatencies pings the members of the roster in parallel and returns
+// the round-trip time of the ones that replied before the context is done.
+func (c *Client) MeasureLatencies(ctx context.Context, r *onet.Roster) map[network.ServerIdentityID]time.Duration {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	lats := make(map[network.ServerIdentityID]time.Duration)
+	for _, si := range r.List {
+		wg.Add(1)
+		go func(si *network.ServerIdentity) {
+			defer wg.Done()
+			start := time.Now()
+			_, err := c.attempt(ctx, c.AttemptTimeout, si, c.ping)
+			if err != nil {
+				log.Lvl3("Couldn't ping", si, ":", err)
+				return
+			}
+			lock.Lock()
+			lats[si.ID] = time.Since(start)
+			lock.Unlock()
+		}(si)
+	}
+	wg.Wait()
+	return lats
+}
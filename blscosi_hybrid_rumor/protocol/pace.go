@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"time"
+)
+
+// gossipPace is the tick and the fanout of a node. They are fixed unless the
+// parameters are adaptive, in which case they follow the progress of the
+// round, see update.
+type gossipPace struct {
+	params Parameters
+	// maxPeers is the number of other nodes in the roster
+	maxPeers int
+	tick     time.Duration
+	peers    int
+	signers  int
+}
+
+func newGossipPace(params Parameters, nodes int) *gossipPace {
+	g := &gossipPace{
+		params:   params,
+		maxPeers: nodes - 1,
+		tick:     params.GossipTick,
+		peers:    params.RumorPeers,
+	}
+	if g.peers > g.maxPeers {
+		g.peers = g.maxPeers
+	}
+	return g
+}
+
+// update is called at every tick with the number of signers known by the
+// node. In adaptive mode, the tick gets shorter and the fanout larger while
+// the rumors bring new signers, and they back off once they don't. It returns
+// true if the tick changed.
+func (g *gossipPace) update(signers int) bool {
+	if !g.params.Adaptive {
+		return false
+	}
+	minTick, maxTick, maxPeers := g.params.adaptiveBounds()
+	if maxPeers > g.maxPeers {
+		maxPeers = g.maxPeers
+	}
+
+	tick := g.tick
+	if signers > g.signers {
+		tick /= 2
+		g.peers++
+	} else {
+		tick *= 2
+		g.peers--
+	}
+	g.signers = signers
+
+	if tick < minTick {
+		tick = minTick
+	}
+	if tick > maxTick {
+		tick = maxTick
+	}
+	// the fanout doesn't go below RumorPeers, nor above the other nodes
+	if g.peers < g.params.RumorPeers {
+		g.peers = g.params.RumorPeers
+	}
+	if g.peers > maxPeers {
+		g.peers = maxPeers
+	}
+
+	changed := tick != g.tick
+	g.tick = tick
+	return changed
+}
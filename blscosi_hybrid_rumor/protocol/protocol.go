@@ -124,7 +124,8 @@ func (p *BlsCosi) Dispatch() error {
 			return errors.New("timeout, did you forget to call Start?")
 		}
 
-		ticker := time.NewTicker(p.Params.GossipTick)
+		pace := newGossipPace(p.Params, len(p.TreeNodeInstance.List()))
+		ticker := time.NewTicker(pace.tick)
 		receivedSignatures := make(map[network.ServerIdentityID][]byte)
 		pendingRoster := onet.Roster{}
 		pendingRoster.List = make([]*network.ServerIdentity, 0)
@@ -182,11 +183,20 @@ func (p *BlsCosi) Dispatch() error {
 					}
 					done = true
 				} else {
-					rumorId, err = p.GetOverlay().SendHybridRumor(pendingRoster, 3, p.Msg, p.Params.GossipTick, rumorId)
+					// the overlay uses a fanout of 3 unless it is adaptive
+					fanout := 3
+					if p.Params.Adaptive {
+						fanout = pace.peers
+					}
+					rumorId, err = p.GetOverlay().SendHybridRumor(pendingRoster, fanout, p.Msg, pace.tick, rumorId)
 					if err != nil {
 						log.Lvl2("Failed to SendRumor on tick")
 						return err
 					}
+					if pace.update(len(receivedSignatures)) {
+						ticker.Stop()
+						ticker = time.NewTicker(pace.tick)
+					}
 				}
 			case <-protocolTimeout:
 				log.Lvl5("Timed out of protocol")
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/onet/v4/network"
+	"go.dedis.ch/onet/v4/simul/monitor"
+)
+
+// RecordTraffic makes Record send the traffic to the simulation monitor. It
+// is meant to be set by simulations.
+var RecordTraffic = false
+
+// TrafficCount is the number of messages of a type and the bytes onet
+// received for them.
+type TrafficCount struct {
+	Messages int
+	Bytes    int
+}
+
+// Traffic counts the messages received by a server, per message type. The
+// hybrid rumors are exchanged by the overlay of the onet fork and not by the
+// protocol instances, so they are counted where the server processes them,
+// in the receiving direction only.
+type Traffic struct {
+	sync.Mutex
+	rx map[string]TrafficCount
+}
+
+// NewTraffic returns empty counts.
+func NewTraffic() *Traffic {
+	return &Traffic{rx: make(map[string]TrafficCount)}
+}
+
+// Received returns the messages received so far, per message type.
+func (t *Traffic) Received() map[string]TrafficCount {
+	t.Lock()
+	defer t.Unlock()
+	res := make(map[string]TrafficCount, len(t.rx))
+	for k, v := range t.rx {
+		res[k] = v
+	}
+	return res
+}
+
+// CountEnvelope adds a message received by the server, with the bytes onet
+// read for it.
+func (t *Traffic) CountEnvelope(e *network.Envelope) {
+	name := messageName(e.Msg)
+	t.Lock()
+	c := t.rx[name]
+	c.Messages++
+	c.Bytes += int(e.Size)
+	t.rx[name] = c
+	t.Unlock()
+}
+
+// Record sends the counts to the simulation monitor as the measures
+// bandwidth_<type>_rx and bandwidth_<type>_msg_rx, as the protocol instances
+// of the other variants do at the end of a round, and starts counting anew.
+func (t *Traffic) Record() {
+	if RecordTraffic {
+		for name, c := range t.Received() {
+			monitor.RecordSingleMeasure("bandwidth_"+name+"_rx", float64(c.Bytes))
+			monitor.RecordSingleMeasure("bandwidth_"+name+"_msg_rx", float64(c.Messages))
+		}
+	}
+	t.Lock()
+	t.rx = make(map[string]TrafficCount)
+	t.Unlock()
+}
+
+// messageName returns the name of the type of the message in lower case,
+// e.g. rumor for a *Rumor.
+func messageName(msg network.Message) string {
+	ty := reflect.TypeOf(msg)
+	if ty.Kind() == reflect.Ptr {
+		ty = ty.Elem()
+	}
+	return strings.ToLower(ty.Name())
+}
@@ -28,6 +28,8 @@ func init() {
 	ServiceID, _ = onet.RegisterNewServiceWithSuite(ServiceName, suite, newCoSiService)
 	network.RegisterMessage(&SignatureRequest{})
 	network.RegisterMessage(&SignatureResponse{})
+	network.RegisterMessage(&PingRequest{})
+	network.RegisterMessage(&PingResponse{})
 }
 
 // Service is the service that handles collective signing operations
@@ -51,16 +53,18 @@ type SignatureResponse struct {
 	Signature protocol.BlsSignature
 }
 
+// PingRequest is used by clients to measure the latency of a node.
+type PingRequest struct{}
+
+// PingResponse is the reply to a PingRequest.
+type PingResponse struct{}
+
 // SignatureRequest treats external request to this service.
 func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, error) {
 	// generate the tree
-	rooted := req.Roster.NewRosterWithRoot(s.ServerIdentity())
-	if rooted == nil {
-		return nil, errors.New("we're not in the roster")
-	}
-	tree := rooted.GenerateStar()
-	if tree == nil {
-		return nil, errors.New("failed to generate tree")
+	tree, err := s.starTree(req.Roster)
+	if err != nil {
+		return nil, err
 	}
 
 	// configure the BlsCosi protocol
@@ -71,10 +75,7 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 	p := pi.(*protocol.BlsCosi)
 	p.Timeout = s.Timeout
 	p.Msg = req.Message
-	p.Params = req.Params
-	if p.Params == (protocol.Parameters{}) {
-		p.Params = protocol.DefaultParams()
-	}
+	p.Params = req.Params.WithDefaults()
 
 	// Threshold before the subtrees so that we can optimize situation
 	// like a threshold of one
@@ -98,6 +99,25 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 	return &SignatureResponse{h.Sum(nil), sig}, nil
 }
 
+// starTree generates a star tree with this node as the root. The tree keeps
+// the roster in the order given by the client, so that the masks refer to
+// that order whichever node coordinates the protocol.
+func (s *Service) starTree(roster *onet.Roster) (*onet.Tree, error) {
+	if i, _ := roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, errors.New("we're not in the roster")
+	}
+	tree := roster.GenerateNaryTreeWithRoot(len(roster.List)-1, s.ServerIdentity())
+	if tree == nil {
+		return nil, errors.New("failed to generate tree")
+	}
+	return tree, nil
+}
+
+// Ping replies right away, so that clients can check that the node is up.
+func (s *Service) Ping(req *PingRequest) (network.Message, error) {
+	return &PingResponse{}, nil
+}
+
 // NewProtocol is called on all nodes of a Tree (except the root, since it is
 // the one starting the protocol) so it's the Service that will be called to
 // generate the PI on all others node.
@@ -116,8 +136,8 @@ func newCoSiService(c *onet.Context) (onet.Service, error) {
 		Timeout:          protocolTimeout,
 	}
 
-	if err := s.RegisterHandler(s.SignatureRequest); err != nil {
-		log.Error("couldn't register message:", err)
+	if err := s.RegisterHandlers(s.SignatureRequest, s.Ping); err != nil {
+		log.Error("couldn't register messages:", err)
 		return nil, err
 	}
 
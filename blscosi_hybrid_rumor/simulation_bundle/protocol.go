@@ -50,6 +50,8 @@ type SimulationProtocol struct {
 	GossipTick    float64
 	RumorPeers    int
 	ShutdownPeers int
+	Adaptive      int
+	MaxRumorPeers int
 	TreeMode      int
 }
 
@@ -96,9 +98,28 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 		log.Fatal("Didn't find this node in roster")
 	}
 	leaves := config.Tree.Root.Children
+
+	// count the hybrid rumors received by this node, the counts of a round
+	// are recorded once the node has been idle for half the pause between
+	// two rounds
+	protocol.RecordTraffic = true
+	traffic := protocol.NewTraffic()
+	idle := time.AfterFunc(roundSleep/2, traffic.Record)
+	idle.Stop()
+	count := func(e *network.Envelope) {
+		traffic.CountEnvelope(e)
+		idle.Reset(roundSleep / 2)
+	}
+	config.Server.RegisterProcessorFunc(onet.HybridRumorMsgID, func(e *network.Envelope) error {
+		count(e)
+		config.Overlay.Process(e)
+		return nil
+	})
+
 	if s.MaxDelay > 0 {
 		// delay messages
 		config.Server.RegisterProcessorFunc(onet.HybridRumorMsgID, func(e *network.Envelope) error {
+			count(e)
 			sleepSecs := rand.Float64()*(s.MaxDelay-s.MinDelay) + s.MinDelay
 			sleepNsecs := sleepSecs * float64(time.Second/time.Nanosecond)
 			log.Lvlf3("Delaying message by %.3f for simulation on %v", sleepSecs, config.Server.ServerIdentity)
@@ -120,6 +141,7 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 		if n.ServerIdentity.ID.Equal(config.Server.ServerIdentity.ID) {
 			// This will override the delay ProcessorFunc, which is fine.
 			config.Server.RegisterProcessorFunc(onet.HybridRumorMsgID, func(e *network.Envelope) error {
+				count(e)
 				return nil
 			})
 			break // this node has been found
@@ -148,6 +170,8 @@ func (s *SimulationProtocol) Run(config *onet.SimulationConfig) error {
 			GossipTick:    time.Duration(s.GossipTick * float64(time.Second/time.Nanosecond)),
 			RumorPeers:    s.RumorPeers,
 			ShutdownPeers: s.ShutdownPeers,
+			Adaptive:      s.Adaptive != 0,
+			MaxRumorPeers: s.MaxRumorPeers,
 			TreeMode:      s.TreeMode != 0,
 		}
 
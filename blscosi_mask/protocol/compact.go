@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"bytes"
+
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/protobuf"
+)
+
+// setDigests computes the hashes of the message and the parameters of this
+// round, which identify it in the compact rumors.
+func (p *BlsCosiMask) setDigests() error {
+	h := p.suite.Hash()
+	h.Write(p.Msg)
+	p.hash = h.Sum(nil)
+
+	buf, err := protobuf.Encode(&p.Params)
+	if err != nil {
+		return err
+	}
+	h = p.suite.Hash()
+	h.Write(buf)
+	p.paramsDigest = h.Sum(nil)
+	return nil
+}
+
+// matches returns true if the hashes are the ones of this round.
+func (p *BlsCosiMask) matches(hash, paramsDigest []byte) bool {
+	return p.hash != nil && bytes.Equal(hash, p.hash) &&
+		bytes.Equal(paramsDigest, p.paramsDigest)
+}
+
+// hasMessage records that the peer has the message of the round, so that it
+// gets compact rumors from now on.
+func (p *BlsCosiMask) hasMessage(tn *onet.TreeNode) {
+	p.known[tn.RosterIndex] = true
+}
+
+// rumorFor returns the rumor to send to the target, which is compact if the
+// target already has the message.
+func (p *BlsCosiMask) rumorFor(target *onet.TreeNode, rumor *Rumor) interface{} {
+	if p.known[target.RosterIndex] {
+		return &CompactRumor{p.hash, p.paramsDigest, rumor.Responses, rumor.BitMap}
+	}
+	return rumor
+}
+
+// expandRumor returns the full rumor of a compact one, which must match this
+// round.
+func (p *BlsCosiMask) expandRumor(msg CompactRumorMessage) RumorMessage {
+	return RumorMessage{msg.TreeNode, Rumor{p.Params, msg.Responses, msg.BitMap, p.Msg}}
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"go.dedis.ch/onet/v4"
+	"go.dedis.ch/onet/v4/log"
+)
+
+// shutdownChildren returns the roster indices of the children of the node at
+// index in the binomial tree rooted at origin over n nodes. With the indices
+// relative to origin, the node r forwards to r + 2^k for every 2^k > r, so
+// that every node is reached in at most log2(n) hops.
+func shutdownChildren(origin, index, n int) []int {
+	rel := (index - origin + n) % n
+	step := 1
+	for step <= rel {
+		step <<= 1
+	}
+	var children []int
+	for ; rel+step < n; step <<= 1 {
+		children = append(children, (origin+rel+step)%n)
+	}
+	return children
+}
+
+// sendShutdownTree sends the shutdown to the children of the node at index in
+// the tree rooted at the signer of the shutdown. A child that can't be
+// reached is skipped and its own children get the shutdown instead. The nodes
+// the tree misses anyway get it from the random peers of sendShutdowns, or in
+// answer to their rumors.
+func (p *BlsCosiMask) sendShutdownTree(shutdown Shutdown, index int) {
+	for _, child := range shutdownChildren(int(shutdown.Signer), index, len(p.Publics())) {
+		target := p.nodeAt(child)
+		if target == nil {
+			continue
+		}
+		err := p.sendTo(target, &shutdown)
+		if err != nil {
+			log.Lvl2("Couldn't send the shutdown to", child, "taking over its children:", err)
+			p.sendShutdownTree(shutdown, child)
+		}
+	}
+}
+
+// nodeAt returns the node of the tree with the given roster index.
+func (p *BlsCosiMask) nodeAt(index int) *onet.TreeNode {
+	for _, tn := range p.List() {
+		if tn.RosterIndex == index {
+			return tn
+		}
+	}
+	return nil
+}
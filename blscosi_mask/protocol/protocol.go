@@ -49,10 +49,31 @@ type BlsCosiMask struct {
 	suite          *pairing.SuiteBn256
 	Params         Parameters // mainly for simulations
 
+	// traffic counts the messages of this instance, see Traffic
+	traffic *Traffic
+	// pace is the current tick and fanout of the gossip
+	pace *gossipPace
+	// hash and paramsDigest identify the round in the compact rumors
+	hash         []byte
+	paramsDigest []byte
+	// known are the roster indexes of the peers that have the message
+	known map[int]bool
+
+	// elections is the term of the current leader, the root's being zero,
+	// and takeover the proof of its election. silentTicks is the number of
+	// ticks since we heard from the leader and votes the votes known for the
+	// next term.
+	elections   int
+	takeover    *Takeover
+	silentTicks int
+	votes       map[uint32][]byte
+
 	// internodes channels
 	RumorsChan           chan RumorMessage
+	CompactRumorsChan    chan CompactRumorMessage
 	SignatureRequestChan chan SignatureRequestMessage
 	ShutdownChan         chan ShutdownMessage
+	TakeoverChan         chan TakeoverMessage
 }
 
 // NewDefaultProtocol is the default protocol function used for registration
@@ -85,11 +106,13 @@ func NewBlsCosiMask(n *onet.TreeNodeInstance, vf VerificationFn, suite *pairing.
 		Timeout:          defaultTimeout,
 		Threshold:        DefaultThreshold(nNodes),
 		startChan:        make(chan bool, 1),
+		traffic:          newTraffic(),
+		known:            make(map[int]bool),
 		verificationFn:   vf,
 		suite:            suite,
 	}
 
-	err := c.RegisterChannels(&c.RumorsChan, &c.SignatureRequestChan, &c.ShutdownChan)
+	err := c.RegisterChannels(&c.RumorsChan, &c.CompactRumorsChan, &c.SignatureRequestChan, &c.ShutdownChan, &c.TakeoverChan)
 	if err != nil {
 		return nil, errors.New("couldn't register channels: " + err.Error())
 	}
@@ -120,9 +143,25 @@ func (p *BlsCosiMask) Start() error {
 	return nil
 }
 
+// Traffic returns the counts of the messages exchanged by this instance. It
+// can be read once the round is over.
+func (p *BlsCosiMask) Traffic() *Traffic {
+	return p.traffic
+}
+
+// sendTo sends the message to a single peer and counts it.
+func (p *BlsCosiMask) sendTo(target *onet.TreeNode, msg interface{}) error {
+	err := p.SendTo(target, msg)
+	if err == nil {
+		p.traffic.countSent(msg)
+	}
+	return err
+}
+
 // Dispatch is the main method of the protocol for all nodes.
 func (p *BlsCosiMask) Dispatch() error {
 	defer p.Done()
+	defer p.traffic.record()
 
 	protocolTimeout := time.After(shutdownAfter)
 
@@ -151,12 +190,15 @@ func (p *BlsCosiMask) Dispatch() error {
 	} else {
 		select {
 		case rumorMsg := <-p.RumorsChan:
+			p.traffic.countReceived(&rumorMsg.Rumor)
+			p.hasMessage(rumorMsg.TreeNode)
 			rumor = &rumorMsg
 			p.Params = rumor.Params
 			// Copy bytes due to the way protobuf allows the bytes to be
 			// shared with the underlying buffer
 			p.Msg = rumor.Msg[:]
 		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
 			p.Params = shutdownMsg.Params
 			p.Msg = shutdownMsg.Msg[:]
 			log.Lvl5("Received shutdown")
@@ -181,6 +223,9 @@ func (p *BlsCosiMask) Dispatch() error {
 	if err != nil {
 		return err
 	}
+	if err = p.setDigests(); err != nil {
+		return err
+	}
 
 	if rumor != nil {
 		shutdown, err = handleRumor(responses, rumor, p)
@@ -189,20 +234,38 @@ func (p *BlsCosiMask) Dispatch() error {
 		}
 	}
 
-	ticker := time.NewTicker(p.Params.GossipTick)
+	p.pace = newGossipPace(p.Params, len(p.Publics()))
+	ticker := time.NewTicker(p.pace.tick)
 	for !shutdown {
 		select {
 		case rumor := <-p.RumorsChan:
+			p.traffic.countReceived(&rumor.Rumor)
+			p.hasMessage(rumor.TreeNode)
+			shutdown, err = handleRumor(responses, &rumor, p)
+			if err != nil {
+				return err
+			}
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.hasMessage(compact.TreeNode)
+			if !p.matches(compact.Hash, compact.ParamsDigest) {
+				log.Lvl1("Got a compact rumor for another message")
+				continue
+			}
+			rumor := p.expandRumor(compact)
 			shutdown, err = handleRumor(responses, &rumor, p)
 			if err != nil {
 				return err
 			}
 		case signatureRequest := <-p.SignatureRequestChan:
+			p.traffic.countReceived(&signatureRequest.SignatureRequest)
+			p.hasMessage(signatureRequest.TreeNode)
 			shutdown, err = handleSignatureRequest(responses, &signatureRequest, p)
 			if err != nil {
 				return err
 			}
 		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
 			log.Lvl5("Received shutdown")
 			if err := p.verifyShutdown(shutdownMsg); err == nil {
 				shutdownStruct = shutdownMsg.Shutdown
@@ -212,9 +275,19 @@ func (p *BlsCosiMask) Dispatch() error {
 				log.Lvl3("Length was:", len(shutdownMsg.FinalCoSignature))
 				// Don't take any action
 			}
+		case takeover := <-p.TakeoverChan:
+			p.traffic.countReceived(&takeover.Takeover)
+			p.handleTakeover(takeover)
+			shutdown = p.canFinalise() && p.isEnough(*responses)
 		case <-ticker.C:
 			log.Lvl5("Outgoing rumor")
 			p.sendRumors(*responses, ownId)
+			p.tickLeader()
+			shutdown = p.canFinalise() && p.isEnough(*responses)
+			if p.pace.update(len(responses.bitMap)) {
+				ticker.Stop()
+				ticker = time.NewTicker(p.pace.tick)
+			}
 		case <-protocolTimeout:
 			shutdown = true
 			done = true
@@ -223,31 +296,19 @@ func (p *BlsCosiMask) Dispatch() error {
 	log.Lvl5("Done with gossiping")
 	ticker.Stop()
 
-	if p.IsRoot() {
+	// A successor of the root, or any node of a leaderless round, only
+	// finishes the round with enough signatures, the root always does.
+	successor := !p.IsRoot() && p.canFinalise() && p.isEnough(*responses)
+	if shutdownStruct.FinalCoSignature == nil && (p.IsRoot() || successor) {
 		log.Lvl3(p.ServerIdentity().Address, "collected all signature responses")
 
-		log.Lvlf3("%v is aggregating signatures", p.ServerIdentity())
-		// generate root signature
-		signaturePoint, finalMask, err := responses.Aggregate(p.suite, p.Publics())
-		if err != nil {
-			return err
-		}
-
-		signature, err := signaturePoint.MarshalBinary()
-		if err != nil {
-			return err
-		}
-
-		finalSig := append(signature, finalMask.Mask()...)
-		log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), signature, finalMask.Mask())
-		p.FinalSignature <- finalSig
-
-		// Sign shutdown message
-		rootSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
+		shutdownStruct, err = p.finalise(*responses)
 		if err != nil {
 			return err
 		}
-		shutdownStruct = Shutdown{p.Params, finalSig, rootSig, p.Msg}
+	}
+	if shutdownStruct.FinalCoSignature != nil {
+		p.FinalSignature <- shutdownStruct.FinalCoSignature
 	}
 
 	p.sendShutdowns(shutdownStruct)
@@ -258,10 +319,18 @@ func (p *BlsCosiMask) Dispatch() error {
 	for !done {
 		select {
 		case rumor := <-p.RumorsChan:
+			p.traffic.countReceived(&rumor.Rumor)
 			sender := rumor.TreeNode
 			log.Lvl5("Responding to rumor with shutdown", sender.Equal(p.TreeNode()))
 			p.sendShutdown(sender, shutdownStruct)
-		case <-p.ShutdownChan:
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.sendShutdown(compact.TreeNode, shutdownStruct)
+		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
+			// ignore
+		case takeover := <-p.TakeoverChan:
+			p.traffic.countReceived(&takeover.Takeover)
 			// ignore
 		case <-protocolTimeout:
 			done = true
@@ -272,13 +341,44 @@ func (p *BlsCosiMask) Dispatch() error {
 	return nil
 }
 
+// finalise aggregates the responses into the final signature and signs it,
+// which gives the shutdown message of the round.
+func (p *BlsCosiMask) finalise(responses RumorResponses) (Shutdown, error) {
+	log.Lvlf3("%v is aggregating signatures", p.ServerIdentity())
+	signaturePoint, finalMask, err := responses.Aggregate(p.suite, p.Publics())
+	if err != nil {
+		return Shutdown{}, err
+	}
+
+	signature, err := signaturePoint.MarshalBinary()
+	if err != nil {
+		return Shutdown{}, err
+	}
+
+	finalSig := append(signature, finalMask.Mask()...)
+	log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), signature, finalMask.Mask())
+
+	// Sign shutdown message
+	signerSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
+	if err != nil {
+		return Shutdown{}, err
+	}
+	// the root that has been replaced signs for its own term
+	var takeover *Takeover
+	if p.isLeader() {
+		takeover = p.takeover
+	}
+	return Shutdown{p.Params, finalSig, signerSig, p.Msg, uint32(p.TreeNode().RosterIndex), takeover}, nil
+}
+
 func handleRumor(responses *RumorResponses, rumor *RumorMessage, p *BlsCosiMask) (bool, error) {
+	p.heardFrom(rumor.TreeNode)
 	diffBitMap, err := responses.Update(rumor.Rumor.Responses, rumor.Rumor.BitMap)
 	if err != nil {
 		return false, err
 	}
-	log.Lvlf5("Incoming rumor, %d known, %d needed, is-root %v", len(responses.bitMap), p.Threshold, p.IsRoot())
-	if p.IsRoot() && p.isEnough(*responses) {
+	log.Lvlf5("Incoming rumor, %d known, %d needed, can-finalise %v", len(responses.bitMap), p.Threshold, p.canFinalise())
+	if p.canFinalise() && p.isEnough(*responses) {
 		// We've got enough signatures.
 		return true, nil
 	}
@@ -290,15 +390,16 @@ func handleRumor(responses *RumorResponses, rumor *RumorMessage, p *BlsCosiMask)
 }
 
 func handleSignatureRequest(responses *RumorResponses, signatureReq *SignatureRequestMessage, p *BlsCosiMask) (bool, error) {
+	p.heardFrom(signatureReq.TreeNode)
 	if len(signatureReq.SignatureRequest.Responses) > 0 {
 		diffBitMap, err :=
 			responses.Update(signatureReq.SignatureRequest.Responses, signatureReq.SignatureRequest.BitMap)
 		if err != nil {
 			return false, err
 		}
-		log.Lvlf5("Incoming response to signature request, %d known, %d needed, is-root %v",
-			len(responses.bitMap), p.Threshold, p.IsRoot())
-		if p.IsRoot() && p.isEnough(*responses) {
+		log.Lvlf5("Incoming response to signature request, %d known, %d needed, can-finalise %v",
+			len(responses.bitMap), p.Threshold, p.canFinalise())
+		if p.canFinalise() && p.isEnough(*responses) {
 			// We've got enough signatures.
 			return true, nil
 		}
@@ -330,9 +431,10 @@ func (p *BlsCosiMask) trySign(responses *RumorResponses) (uint32, error) {
 	return uint32(idx), nil
 }
 
-// sendRumors sends a rumor message to some random peers.
+// sendRumors sends a rumor message to some random peers, as many as the
+// current fanout.
 func (p *BlsCosiMask) sendRumors(responses RumorResponses, ownId uint32) {
-	targets, err := p.getRandomPeers(p.Params.RumorPeers)
+	targets, err := p.getRandomPeers(p.pace.peers)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers:", err)
 		return
@@ -344,18 +446,26 @@ func (p *BlsCosiMask) sendRumors(responses RumorResponses, ownId uint32) {
 	}
 }
 
-// sendRumor sends the given signatures to a peer.
+// sendRumor sends the given signatures to a peer. A leader that can't be
+// reached gets a vote for its replacement.
 func (p *BlsCosiMask) sendRumor(target *onet.TreeNode, responses RumorResponses) {
-	p.SendTo(target, &Rumor{p.Params, responses.responsesMap, responses.bitMap, p.Msg})
+	err := p.sendTo(target, p.rumorFor(target, &Rumor{p.Params, responses.responsesMap, responses.bitMap, p.Msg}))
+	if err != nil && !p.isLeader() && target.RosterIndex == p.leaderIndex() {
+		p.leaderGone()
+	}
 }
 
 // sendSignatureRequest sends a signature request message to a peer.
 func (p *BlsCosiMask) sendSignatureRequest(target *onet.TreeNode, responsesMap ResponsesMap, bitMap BitMap) {
-	p.SendTo(target, &SignatureRequest{responsesMap, bitMap})
+	p.sendTo(target, &SignatureRequest{responsesMap, bitMap})
 }
 
-// sendShutdowns sends a shutdown message to some random peers.
+// sendShutdowns sends a shutdown message to some random peers, and to the
+// children of the node in the dissemination tree if there is one.
 func (p *BlsCosiMask) sendShutdowns(shutdown Shutdown) {
+	if p.Params.ShutdownTree && shutdown.FinalCoSignature != nil {
+		p.sendShutdownTree(shutdown, p.TreeNode().RosterIndex)
+	}
 	targets, err := p.getRandomPeers(p.Params.ShutdownPeers)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers for shutdown:", err)
@@ -369,7 +479,7 @@ func (p *BlsCosiMask) sendShutdowns(shutdown Shutdown) {
 
 // sendShutdown sends a shutdown message to a single peer.
 func (p *BlsCosiMask) sendShutdown(target *onet.TreeNode, shutdown Shutdown) {
-	p.SendTo(target, &shutdown)
+	p.sendTo(target, &shutdown)
 }
 
 // verifyShutdown verifies the legitimacy of a shutdown message.
@@ -377,17 +487,37 @@ func (p *BlsCosiMask) verifyShutdown(msg ShutdownMessage) error {
 	if len(p.Publics()) == 0 {
 		return errors.New("Roster is empty")
 	}
-	rootPublic := p.Publics()[0]
+	signer := int(msg.Signer)
+	if signer >= len(p.Publics()) {
+		return errors.New("unknown signer of the shutdown")
+	}
+	term := 0
+	if msg.Takeover != nil {
+		if err := p.verifyTakeover(msg.Takeover); err != nil {
+			return err
+		}
+		term = int(msg.Takeover.Term)
+	}
+	if !p.Params.Leaderless && signer != p.leaderOf(term) {
+		return errors.New("shutdown not signed by the leader of its term")
+	}
+	// the roster is in the order of the client, the root isn't always first
+	signerPublic := p.Publics()[signer]
 	finalSig := msg.FinalCoSignature
 
-	// verify final signature
-	err := msg.FinalCoSignature.VerifyAggregate(p.suite, p.Msg, p.Publics())
+	// verify final signature, which must prove the threshold when any node
+	// can create it
+	policy := sign.NewThresholdPolicy(DefaultThreshold(len(p.Publics())))
+	if p.Params.Leaderless {
+		policy = sign.NewThresholdPolicy(p.Threshold)
+	}
+	err := msg.FinalCoSignature.VerifyAggregateWithPolicy(p.suite, p.Msg, p.Publics(), policy)
 	if err != nil {
 		return err
 	}
 
-	// verify root signature of final signature
-	return verify(p.suite, msg.RootSig, finalSig, rootPublic)
+	// verify signature of the leader over the final signature
+	return verify(p.suite, msg.RootSig, finalSig, signerPublic)
 }
 
 // verify checks the signature over the message with a single key
@@ -1,37 +1,65 @@
 package blscosi_maskaggr
 
 import (
-	"errors"
+	"context"
+	"time"
 
 	"go.dedis.ch/onet/v4"
-	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/onet/v4/network"
 )
 
 // Client is a structure to communicate with the CoSi
 // service
 type Client struct {
 	*onet.Client
+	// Strategy selects the order in which the members of the roster are
+	// tried as entry node
+	Strategy EntryStrategy
+	// AttemptTimeout is the time given to an entry node to answer a ping
+	// before the next one is tried, zero means that only the context limits
+	// it. The time given to the request is derived from the context, see
+	// requestTimeout.
+	AttemptTimeout time.Duration
 }
 
 // NewClient instantiates a new blscosi_maskaggr.Client
 func NewClient() *Client {
-	return &Client{Client: onet.NewClient(suite, ServiceName)}
+	return &Client{
+		Client:         onet.NewClient(suite, ServiceName),
+		Strategy:       EntryFirst,
+		AttemptTimeout: defaultAttemptTimeout,
+	}
 }
 
 // SignatureRequest sends a CoSi sign request to the Cothority defined by the given
-// Roster
-func (c *Client) SignatureRequest(r *onet.Roster, msg []byte) (*SignatureResponse, error) {
+// Roster. The members are tried as entry node until one of them replies.
+func (c *Client) SignatureRequest(ctx context.Context, r *onet.Roster, msg []byte) (*SignatureResponse, error) {
 	serviceReq := &SignatureRequest{
 		Roster:  r,
 		Message: msg,
 	}
-	if len(r.List) == 0 {
-		return nil, errors.New("Got an empty roster-list")
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &SignatureResponse{}
+		return reply, c.SendProtobuf(dst, serviceReq, reply)
+	})
+	if err != nil {
+		return nil, err
 	}
-	dst := r.List[0]
-	log.Lvl4("Sending message to", dst)
-	reply := &SignatureResponse{}
-	err := c.SendProtobuf(dst, serviceReq, reply)
+	return reply.(*SignatureResponse), nil
+}
 
-	return reply, err
+// RecoveredSignature asks the members of r for the final signature of a round
+// whose root was gone, given the hash of the message and the ID of the roster
+// of the round
+func (c *Client) RecoveredSignature(ctx context.Context, r *onet.Roster, rosterID onet.RosterID,
+	hash []byte) (*SignatureResponse, error) {
+	req := &RecoveredSignatureRequest{Hash: hash, RosterID: rosterID[:]}
+	reply, err := c.failover(ctx, r, func(dst *network.ServerIdentity) (interface{}, error) {
+		reply := &SignatureResponse{}
+		return reply, c.SendProtobuf(dst, req, reply)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*SignatureResponse), nil
 }
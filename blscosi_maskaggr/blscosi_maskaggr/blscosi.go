@@ -90,6 +90,23 @@ func createApp() *cli.App {
 				},
 			}...),
 		},
+		{
+			Name:      "inspect",
+			Aliases:   []string{"i"},
+			Usage:     "Show which servers of the group produced a collective signature, and check it against 'file' if it is given; signature is read from STDIN by default",
+			ArgsUsage: "[file]",
+			Action:    inspectFile,
+			Flags: append(clientFlags, []cli.Flag{
+				cli.StringFlag{
+					Name:  "signature, s",
+					Usage: "Read signature from 'file.sig' instead of STDIN",
+				},
+				cli.BoolFlag{
+					Name:  "json, j",
+					Usage: "Write the report as JSON",
+				},
+			}...),
+		},
 		{
 			Name:    "check",
 			Aliases: []string{"c"},
@@ -216,3 +216,17 @@ func findIndexResponse(bitMaps []BitMap, bitMap BitMap) int {
 func isMaskEqual(mask1 BitMap, mask2 BitMap) bool {
 	return reflect.DeepEqual(mask1, mask2)
 }
+
+// signers returns the number of distinct signers in the responses.
+func (allResponses *AllResponses) signers() int {
+	signers := make(BitMap)
+	for idx := range allResponses.BuiltMap {
+		signers[idx] = true
+	}
+	for _, aggMap := range allResponses.AggregatedMaps {
+		for idx := range aggMap {
+			signers[idx] = true
+		}
+	}
+	return len(signers)
+}
@@ -4,6 +4,7 @@ package blscosi_maskaggr
 
 import (
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/dedis/student_19_elias/blscosi_maskaggr/protocol"
@@ -16,6 +17,10 @@ import (
 
 const protocolTimeout = 20 * time.Second
 
+// recoveredTTL is how long a node keeps the final signature of a round it
+// took part in, so that clients can fetch it when the root was gone.
+const recoveredTTL = 5 * time.Minute
+
 var suite = suites.MustFind("bn256.adapter").(*pairing.SuiteBn256)
 
 // ServiceID is the key to get the service later
@@ -28,6 +33,9 @@ func init() {
 	ServiceID, _ = onet.RegisterNewServiceWithSuite(ServiceName, suite, newCoSiService)
 	network.RegisterMessage(&SignatureRequest{})
 	network.RegisterMessage(&SignatureResponse{})
+	network.RegisterMessage(&RecoveredSignatureRequest{})
+	network.RegisterMessage(&PingRequest{})
+	network.RegisterMessage(&PingResponse{})
 }
 
 // Service is the service that handles collective signing operations
@@ -36,6 +44,12 @@ type Service struct {
 	suite     pairing.Suite
 	Threshold int
 	Timeout   time.Duration
+
+	// recovered holds the final signatures of the rounds this node took part
+	// in, indexed by the hash of the message and the ID of the roster, see
+	// recoveredKey
+	recovered     map[string]protocol.BlsSignature
+	recoveredLock sync.Mutex
 }
 
 // SignatureRequest is what the Cosi service is expected to receive from clients.
@@ -51,16 +65,27 @@ type SignatureResponse struct {
 	Signature protocol.BlsSignature
 }
 
+// RecoveredSignatureRequest asks a node for the final signature of a message
+// that it knows from a round, in particular when the root of the round was
+// gone. RosterID is the ID of the roster of the round, which the mask of the
+// signature refers to.
+type RecoveredSignatureRequest struct {
+	Hash     []byte
+	RosterID []byte
+}
+
+// PingRequest is used by clients to measure the latency of a node.
+type PingRequest struct{}
+
+// PingResponse is the reply to a PingRequest.
+type PingResponse struct{}
+
 // SignatureRequest treats external request to this service.
 func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, error) {
 	// generate the tree
-	rooted := req.Roster.NewRosterWithRoot(s.ServerIdentity())
-	if rooted == nil {
-		return nil, errors.New("we're not in the roster")
-	}
-	tree := rooted.GenerateStar()
-	if tree == nil {
-		return nil, errors.New("failed to generate tree")
+	tree, err := s.starTree(req.Roster)
+	if err != nil {
+		return nil, err
 	}
 
 	// configure the BlsCosiMaskAggr protocol
@@ -71,10 +96,7 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 	p := pi.(*protocol.BlsCosiMaskAggr)
 	p.Timeout = s.Timeout
 	p.Msg = req.Message
-	p.Params = req.Params
-	if p.Params == (protocol.Parameters{}) {
-		p.Params = protocol.DefaultParams()
-	}
+	p.Params = req.Params.WithDefaults()
 
 	// Threshold before the subtrees so that we can optimize situation
 	// like a threshold of one
@@ -98,6 +120,68 @@ func (s *Service) SignatureRequest(req *SignatureRequest) (network.Message, erro
 	return &SignatureResponse{h.Sum(nil), sig}, nil
 }
 
+// starTree generates a star tree with this node as the root. The tree keeps
+// the roster in the order given by the client, so that the masks refer to
+// that order whichever node coordinates the protocol.
+func (s *Service) starTree(roster *onet.Roster) (*onet.Tree, error) {
+	if i, _ := roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, errors.New("we're not in the roster")
+	}
+	tree := roster.GenerateNaryTreeWithRoot(len(roster.List)-1, s.ServerIdentity())
+	if tree == nil {
+		return nil, errors.New("failed to generate tree")
+	}
+	return tree, nil
+}
+
+// RecoveredSignature returns the final signature of a message that this node
+// knows, in particular when it finished the round in place of the root.
+func (s *Service) RecoveredSignature(req *RecoveredSignatureRequest) (network.Message, error) {
+	if len(req.RosterID) == 0 {
+		return nil, errors.New("missing roster ID")
+	}
+	s.recoveredLock.Lock()
+	sig, ok := s.recovered[recoveredKey(req.Hash, req.RosterID)]
+	s.recoveredLock.Unlock()
+	if !ok {
+		return nil, errors.New("no recovered signature for this hash")
+	}
+	return &SignatureResponse{Hash: req.Hash, Signature: sig}, nil
+}
+
+// waitFinal keeps the final signature of a non-root protocol instance for a
+// while, which it gets from the shutdown of the round or by creating it in
+// place of the root.
+func (s *Service) waitFinal(p *protocol.BlsCosiMaskAggr) {
+	sig, ok := <-p.FinalSignature
+	if !ok || sig == nil {
+		return
+	}
+	h := s.suite.Hash()
+	h.Write(p.Msg)
+	key := recoveredKey(h.Sum(nil), p.Roster().ID[:])
+
+	s.recoveredLock.Lock()
+	s.recovered[key] = sig
+	s.recoveredLock.Unlock()
+	time.AfterFunc(recoveredTTL, func() {
+		s.recoveredLock.Lock()
+		delete(s.recovered, key)
+		s.recoveredLock.Unlock()
+	})
+}
+
+// recoveredKey returns the key of a recovered signature, as the same message
+// can be signed by different rosters.
+func recoveredKey(hash, rosterID []byte) string {
+	return string(hash) + string(rosterID)
+}
+
+// Ping replies right away, so that clients can check that the node is up.
+func (s *Service) Ping(req *PingRequest) (network.Message, error) {
+	return &PingResponse{}, nil
+}
+
 // NewProtocol is called on all nodes of a Tree (except the root, since it is
 // the one starting the protocol) so it's the Service that will be called to
 // generate the PI on all others node.
@@ -106,7 +190,12 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 	if tn.ProtocolName() != protocol.DefaultProtocolName {
 		return nil, errors.New("no such protocol " + tn.ProtocolName())
 	}
-	return protocol.NewDefaultProtocol(tn)
+	pi, err := protocol.NewDefaultProtocol(tn)
+	if err != nil {
+		return nil, err
+	}
+	go s.waitFinal(pi.(*protocol.BlsCosiMaskAggr))
+	return pi, nil
 }
 
 func newCoSiService(c *onet.Context) (onet.Service, error) {
@@ -114,10 +203,11 @@ func newCoSiService(c *onet.Context) (onet.Service, error) {
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		suite:            suite,
 		Timeout:          protocolTimeout,
+		recovered:        make(map[string]protocol.BlsSignature),
 	}
 
-	if err := s.RegisterHandler(s.SignatureRequest); err != nil {
-		log.Error("couldn't register message:", err)
+	if err := s.RegisterHandlers(s.SignatureRequest, s.RecoveredSignature, s.Ping); err != nil {
+		log.Error("couldn't register messages:", err)
 		return nil, err
 	}
 
@@ -1,6 +1,7 @@
 package blscosi_naive
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -17,13 +18,13 @@ func TestClient_SignatureRequest(t *testing.T) {
 	client := NewClient()
 	msg := []byte("hello blscosi_naive service")
 
-	_, err := client.SignatureRequest(&onet.Roster{}, msg)
+	_, err := client.SignatureRequest(context.Background(), &onet.Roster{}, msg)
 	require.Error(t, err)
 
 	for _, dst := range roster.List {
 		newRoster := roster.NewRosterWithRoot(dst)
 		log.Lvlf1("Sending request to service... %v", dst)
-		reply, err := client.SignatureRequest(newRoster, msg)
+		reply, err := client.SignatureRequest(context.Background(), newRoster, msg)
 		require.Nil(t, err, "Couldn't send")
 
 		publics := newRoster.ServicePublics(ServiceName)
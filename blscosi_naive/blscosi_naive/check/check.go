@@ -2,6 +2,7 @@ package check
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -140,32 +141,20 @@ func SignStatement(msg []byte, ro *onet.Roster) (*blscosi_naive.SignatureRespons
 
 	log.Lvlf4("Signing message %x", msg)
 
-	pchan := make(chan *blscosi_naive.SignatureResponse, 1)
-	echan := make(chan error, 1)
-	go func() {
-		log.Lvl3("Waiting for the response on SignRequest")
-		response, err := client.SignatureRequest(ro, msg[:])
-		if err != nil {
-			echan <- err
-			return
-		}
-		pchan <- response
-	}()
-
-	select {
-	case err := <-echan:
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeOut)
+	defer cancel()
+	log.Lvl3("Waiting for the response on SignRequest")
+	response, err := client.SignatureRequest(ctx, ro, msg[:])
+	if err != nil {
 		return nil, err
-	case response := <-pchan:
-		log.Lvlf5("Response: %x", response.Signature)
+	}
+	log.Lvlf5("Response: %x", response.Signature)
 
-		err := response.Signature.Verify(client.Suite().(*pairing.SuiteBn256), msg[:], publics)
-		if err != nil {
-			return nil, err
-		}
-		return response, nil
-	case <-time.After(RequestTimeOut):
-		return nil, errors.New("timeout on signing request")
+	err = response.Signature.Verify(client.Suite().(*pairing.SuiteBn256), msg[:], publics)
+	if err != nil {
+		return nil, err
 	}
+	return response, nil
 }
 
 // VerifySignatureHash checks that the signature is correct
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"time"
+)
+
+// Parameters holds a set of parameters, mainly for simulation purposes
+type Parameters struct {
+	GossipTick    time.Duration // periodic interval
+	RumorPeers    int           // number of peers that a rumor message is sent to
+	ShutdownPeers int           // number of peers that the shutdown message is sent to
+	Adaptive      bool          // adapt the tick and the fanout to the progress
+	MinGossipTick time.Duration // lower bound of the adaptive tick
+	MaxGossipTick time.Duration // upper bound of the adaptive tick
+	MaxRumorPeers int           // upper bound of the adaptive fanout
+}
+
+// DefaultParams returns a set of default parameters
+func DefaultParams() Parameters {
+	return Parameters{
+		GossipTick:    100 * time.Millisecond,
+		RumorPeers:    1,
+		ShutdownPeers: 2,
+	}
+}
+
+// WithDefaults returns the default parameters if none is set, and otherwise
+// fills the unset tick and fanouts with the default ones.
+func (params Parameters) WithDefaults() Parameters {
+	def := DefaultParams()
+	if params == (Parameters{}) {
+		return def
+	}
+	if params.GossipTick <= 0 {
+		params.GossipTick = def.GossipTick
+	}
+	if params.RumorPeers <= 0 {
+		params.RumorPeers = def.RumorPeers
+	}
+	if params.ShutdownPeers <= 0 {
+		params.ShutdownPeers = def.ShutdownPeers
+	}
+	return params
+}
+
+// adaptiveBounds returns the bounds of the tick and the upper bound of the
+// fanout in adaptive mode. The unset bounds are derived from GossipTick and
+// RumorPeers, which is also the lower bound of the fanout.
+func (params Parameters) adaptiveBounds() (time.Duration, time.Duration, int) {
+	minTick, maxTick, maxPeers := params.MinGossipTick, params.MaxGossipTick, params.MaxRumorPeers
+	if minTick <= 0 {
+		minTick = params.GossipTick / 4
+	}
+	if maxTick <= 0 {
+		maxTick = params.GossipTick * 4
+	}
+	if maxPeers <= 0 {
+		maxPeers = params.RumorPeers * 2
+	}
+	return minTick, maxTick, maxPeers
+}
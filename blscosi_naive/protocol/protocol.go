@@ -18,9 +18,6 @@ import (
 )
 
 const defaultTimeout = 10 * time.Second
-const gossipTick = 100 * time.Millisecond
-
-const shutdownPeers = 2
 
 // VerificationFn is called on every node. Where msg is the message that is
 // co-signed and the data is additional data for verification.
@@ -49,10 +46,24 @@ type BlsCosi struct {
 	startChan      chan bool
 	verificationFn VerificationFn
 	suite          *pairing.SuiteBn256
+	Params         Parameters // mainly for simulations
+
+	// traffic counts the messages of this instance, see Traffic
+	traffic *Traffic
+	// pace is the current tick and fanout of the gossip
+	pace *gossipPace
+	// exchanged tracks the responses each peer already has from us
+	exchanged exchanged
+	// hash and paramsDigest identify the round in the compact rumors
+	hash         []byte
+	paramsDigest []byte
+	// known are the roster indexes of the peers that have the message
+	known map[int]bool
 
 	// internodes channels
-	RumorsChan   chan RumorMessage
-	ShutdownChan chan ShutdownMessage
+	RumorsChan        chan RumorMessage
+	CompactRumorsChan chan CompactRumorMessage
+	ShutdownChan      chan ShutdownMessage
 }
 
 // NewDefaultProtocol is the default protocol function used for registration
@@ -85,11 +96,15 @@ func NewBlsCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite *pairing.Suit
 		Timeout:          defaultTimeout,
 		Threshold:        DefaultThreshold(nNodes),
 		startChan:        make(chan bool, 1),
+		Params:           DefaultParams(),
+		traffic:          newTraffic(),
+		exchanged:        make(exchanged),
+		known:            make(map[int]bool),
 		verificationFn:   vf,
 		suite:            suite,
 	}
 
-	err := c.RegisterChannels(&c.RumorsChan, &c.ShutdownChan)
+	err := c.RegisterChannels(&c.RumorsChan, &c.CompactRumorsChan, &c.ShutdownChan)
 	if err != nil {
 		return nil, errors.New("couldn't register channels: " + err.Error())
 	}
@@ -106,9 +121,25 @@ func (p *BlsCosi) Shutdown() error {
 	return nil
 }
 
+// Traffic returns the counts of the messages exchanged by this instance. It
+// can be read once the round is over.
+func (p *BlsCosi) Traffic() *Traffic {
+	return p.traffic
+}
+
+// sendTo sends the message to a single peer and counts it.
+func (p *BlsCosi) sendTo(target *onet.TreeNode, msg interface{}) error {
+	err := p.SendTo(target, msg)
+	if err == nil {
+		p.traffic.countSent(msg)
+	}
+	return err
+}
+
 // Dispatch is the main method of the protocol for all nodes.
 func (p *BlsCosi) Dispatch() error {
 	defer p.Done()
+	defer p.traffic.record()
 
 	protocolTimeout := time.After(9000 * time.Millisecond)
 
@@ -132,39 +163,53 @@ func (p *BlsCosi) Dispatch() error {
 		if err != nil {
 			return err
 		}
+		if err := p.setDigests(); err != nil {
+			return err
+		}
 	}
 
 	log.Lvlf3("Gossip protocol started at node %v", p.ServerIdentity())
 
-	ticker := time.NewTicker(gossipTick)
+	p.pace = newGossipPace(p.Params, len(p.Publics()))
+	ticker := time.NewTicker(p.pace.tick)
 	done := false
 	for !done {
 		select {
 		case rumor := <-p.RumorsChan:
-			updateResponses(responses, rumor.ResponseMap)
-			log.Lvlf5("Incoming rumor, %d known, %d needed, root %v", len(responses), len(p.Roster().List), p.IsRoot())
-			if p.IsRoot() && len(responses) == len(p.Roster().List) {
-				// We've got all the signatures.
-				targets, err := p.getRandomPeers(shutdownPeers)
-				if err != nil {
-					log.Lvl1("couldn't get random peers:", err)
-				} else {
-					log.Lvl5("Sending shutdown")
-					p.sendShutdown(targets)
-				}
-				done = true
+			p.traffic.countReceived(&rumor.Rumor)
+			if len(rumor.Msg) > 0 {
+				p.hasMessage(rumor.TreeNode)
 			}
-			if len(p.Msg) == 0 && len(rumor.Msg) > 0 {
+			adopt := len(p.Msg) == 0 && len(rumor.Msg) > 0
+			done = p.handleRumor(responses, rumor)
+			if adopt {
 				p.Msg = rumor.Msg[:]
+				// the gossip goes on with the parameters of the root
+				p.Params = rumor.Params
+				p.pace = newGossipPace(p.Params, len(p.Publics()))
+				ticker.Stop()
+				ticker = time.NewTicker(p.pace.tick)
 				// Add own signature.
 				err := p.trySign(responses)
 				if err != nil {
 					return err
 				}
+				if err := p.setDigests(); err != nil {
+					return err
+				}
+			}
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.hasMessage(compact.TreeNode)
+			if !p.matches(compact.Hash, compact.ParamsDigest) {
+				log.Lvl1("Got a compact rumor for another message")
+				continue
 			}
-		case <-p.ShutdownChan:
+			done = p.handleRumor(responses, p.expandRumor(compact))
+		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
 			log.Lvl5("Received shutdown")
-			targets, err := p.getRandomPeers(shutdownPeers)
+			targets, err := p.getRandomPeers(p.Params.ShutdownPeers)
 			if err != nil {
 				log.Lvl1("couldn't get random peers:", err)
 			} else {
@@ -173,12 +218,17 @@ func (p *BlsCosi) Dispatch() error {
 			done = true
 		case <-ticker.C:
 			log.Lvl5("Outgoing rumor")
-			p.sendRumor(responses)
+			p.sendRumors(responses)
+			if p.pace.update(len(responses)) {
+				ticker.Stop()
+				ticker = time.NewTicker(p.pace.tick)
+			}
 		case <-protocolTimeout:
 			done = true
 		}
 	}
 	log.Lvl5("Done with gossiping")
+	ticker.Stop()
 
 	if !p.IsRoot() {
 		return nil
@@ -202,13 +252,33 @@ func (p *BlsCosi) Dispatch() error {
 	return nil
 }
 
+// handleRumor merges the signatures of a rumor and returns true if the root
+// got them all, after sending the shutdown.
+func (p *BlsCosi) handleRumor(responses ResponseMap, rumor RumorMessage) bool {
+	p.exchanged.mark(rumor.RosterIndex, rumor.ResponseMap)
+	updateResponses(responses, rumor.ResponseMap)
+	log.Lvlf5("Incoming rumor, %d known, %d needed, root %v", len(responses), len(p.Roster().List), p.IsRoot())
+	if !p.IsRoot() || len(responses) < len(p.Roster().List) {
+		return false
+	}
+	// We've got all the signatures.
+	targets, err := p.getRandomPeers(p.Params.ShutdownPeers)
+	if err != nil {
+		log.Lvl1("couldn't get random peers:", err)
+	} else {
+		log.Lvl5("Sending shutdown")
+		p.sendShutdown(targets)
+	}
+	return true
+}
+
 func (p *BlsCosi) trySign(responses ResponseMap) error {
 	if p.verificationFn(p.Msg, p.Data) {
 		own, err := p.makeResponse()
 		if err != nil {
 			return err
 		}
-		responses[p.Public().String()] = own
+		responses[uint32(p.TreeNode().RosterIndex)] = own
 		log.Lvlf4("Node %v signed", p.ServerIdentity())
 	} else {
 		log.Lvlf4("Node %v refused to sign", p.ServerIdentity())
@@ -216,20 +286,36 @@ func (p *BlsCosi) trySign(responses ResponseMap) error {
 	return nil
 }
 
-// sendRumor sends the given signatures to a random peer.
-func (p *BlsCosi) sendRumor(responses ResponseMap) {
-	// Get a random node except self.
-	target, err := p.getRandomPeer()
+// sendRumors sends a rumor message to some random peers, as many as the
+// current fanout, which is a single one by default.
+func (p *BlsCosi) sendRumors(responses ResponseMap) {
+	targets, err := p.getRandomPeers(p.pace.peers)
 	if err != nil {
-		log.Lvl1("couldn't get a random peer:", err)
+		log.Lvl1("couldn't get random peers:", err)
+		return
+	}
+	for _, target := range targets {
+		p.sendRumor(target, responses)
+	}
+}
+
+// sendRumor sends to a peer the signatures it doesn't have from us yet. Once
+// we know the message, the rumor goes out even without new signatures, as a
+// heartbeat that carries the message and shows that we are alive.
+func (p *BlsCosi) sendRumor(target *onet.TreeNode, responses ResponseMap) {
+	delta := p.exchanged.delta(target.RosterIndex, responses)
+	if len(delta) == 0 && len(p.Msg) == 0 {
+		return
+	}
+	if err := p.sendTo(target, p.rumorFor(target, delta)); err == nil {
+		p.exchanged.mark(target.RosterIndex, delta)
 	}
-	p.SendTo(target, &Rumor{responses, p.Msg})
 }
 
 // sendShutdown sends a shutdown message to some random peers.
 func (p *BlsCosi) sendShutdown(targets []*onet.TreeNode) {
 	for _, target := range targets {
-		p.SendTo(target, &Shutdown{})
+		p.sendTo(target, &Shutdown{})
 	}
 }
 
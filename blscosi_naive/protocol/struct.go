@@ -20,10 +20,12 @@ const DefaultProtocolName = "naiveCoSiDefault"
 
 func init() {
 	network.RegisterMessages(&Rumor{}, &Response{}, &Stop{})
+	network.RegisterMessages(&CompactRumor{})
 }
 
-// ResponseMap is the container used to store responses coming from the children
-type ResponseMap map[string]*Response
+// ResponseMap is the container used to store responses coming from the children,
+// indexed by the roster index of the signer
+type ResponseMap map[uint32]*Response
 
 // BlsSignature contains the message and its aggregated signature
 type BlsSignature []byte
@@ -111,6 +113,7 @@ func (sig BlsSignature) VerifyWithPolicy(ps pairing.Suite, msg []byte, publics [
 
 // Response is a struct that can be sent in the gossip protocol
 type Rumor struct {
+	Params      Parameters
 	ResponseMap ResponseMap
 	Msg         []byte
 }
@@ -122,6 +125,21 @@ type RumorMessage struct {
 	Rumor
 }
 
+// CompactRumor is the Rumor sent to a peer known to have the message of the
+// round: the message and the parameters are replaced by their hashes.
+type CompactRumor struct {
+	Hash         []byte
+	ParamsDigest []byte
+	ResponseMap  ResponseMap
+}
+
+// CompactRumorMessage is a wrapper around CompactRumor for it to work with
+// onet
+type CompactRumorMessage struct {
+	*onet.TreeNode
+	CompactRumor
+}
+
 // Shutdown is a struct that can be sent in the gossip protocol
 type Shutdown struct {
 }
@@ -0,0 +1,111 @@
+package protocol
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/onet/v4/log"
+	"go.dedis.ch/onet/v4/network"
+	"go.dedis.ch/onet/v4/simul/monitor"
+)
+
+// RecordTraffic makes every protocol instance send its traffic to the
+// simulation monitor when it finishes. It is meant to be set by simulations.
+var RecordTraffic = false
+
+// TrafficCount is the number of messages of a type and the size of their
+// encoding.
+type TrafficCount struct {
+	Messages int
+	Bytes    int
+}
+
+// Traffic counts the messages exchanged by a protocol instance, in both
+// directions, per message type.
+type Traffic struct {
+	sync.Mutex
+	tx map[string]TrafficCount
+	rx map[string]TrafficCount
+}
+
+func newTraffic() *Traffic {
+	return &Traffic{
+		tx: make(map[string]TrafficCount),
+		rx: make(map[string]TrafficCount),
+	}
+}
+
+// Sent returns the messages sent so far, per message type.
+func (t *Traffic) Sent() map[string]TrafficCount {
+	return t.copy(t.tx)
+}
+
+// Received returns the messages received so far, per message type.
+func (t *Traffic) Received() map[string]TrafficCount {
+	return t.copy(t.rx)
+}
+
+func (t *Traffic) copy(counts map[string]TrafficCount) map[string]TrafficCount {
+	t.Lock()
+	defer t.Unlock()
+	res := make(map[string]TrafficCount, len(counts))
+	for k, v := range counts {
+		res[k] = v
+	}
+	return res
+}
+
+// countSent adds a message that has been sent.
+func (t *Traffic) countSent(msg network.Message) {
+	t.count(t.tx, msg)
+}
+
+// countReceived adds a message that has been received.
+func (t *Traffic) countReceived(msg network.Message) {
+	t.count(t.rx, msg)
+}
+
+// count adds the message to the counts of its type with the size of its own
+// encoding, so that it doesn't depend on the other messages exchanged by the
+// instance at the same time.
+func (t *Traffic) count(counts map[string]TrafficCount, msg network.Message) {
+	buf, err := network.Marshal(msg)
+	if err != nil {
+		log.Error("Couldn't encode the message to count it:", err)
+	}
+
+	name := messageName(msg)
+	t.Lock()
+	c := counts[name]
+	c.Messages++
+	c.Bytes += len(buf)
+	counts[name] = c
+	t.Unlock()
+}
+
+// record sends the counts to the simulation monitor as the measures
+// bandwidth_<type>_tx, bandwidth_<type>_msg_tx and their _rx counterparts.
+func (t *Traffic) record() {
+	if !RecordTraffic {
+		return
+	}
+	for name, c := range t.Sent() {
+		monitor.RecordSingleMeasure("bandwidth_"+name+"_tx", float64(c.Bytes))
+		monitor.RecordSingleMeasure("bandwidth_"+name+"_msg_tx", float64(c.Messages))
+	}
+	for name, c := range t.Received() {
+		monitor.RecordSingleMeasure("bandwidth_"+name+"_rx", float64(c.Bytes))
+		monitor.RecordSingleMeasure("bandwidth_"+name+"_msg_rx", float64(c.Messages))
+	}
+}
+
+// messageName returns the name of the type of the message in lower case,
+// e.g. rumor for a *Rumor.
+func messageName(msg network.Message) string {
+	ty := reflect.TypeOf(msg)
+	if ty.Kind() == reflect.Ptr {
+		ty = ty.Elem()
+	}
+	return strings.ToLower(ty.Name())
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dedis/student_19_elias/blscosi_simple"
+	"github.com/dedis/student_19_elias/blscosi_simple/blscosi_simple/check"
+	"github.com/dedis/student_19_elias/blscosi_simple/protocol"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/onet/v4/app"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// inspectServer is a server of the group in the report of inspect
+type inspectServer struct {
+	Index       int
+	Address     string
+	Description string `json:",omitempty"`
+}
+
+// inspectReport explains a signature against a group definition
+type inspectReport struct {
+	Hash string
+	// FileMatches and Valid are only given when the file of the signature is
+	// given
+	FileMatches *bool  `json:",omitempty"`
+	Valid       *bool  `json:",omitempty"`
+	Error       string `json:",omitempty"`
+	Servers     int
+	Signers     []inspectServer
+	Missing     []inspectServer
+	// Threshold is the one verify applies, the default threshold
+	Threshold int
+}
+
+// inspectFile explains which servers of the group produced a signature, and
+// whether the signature is the one of the file if it is given
+func inspectFile(c *cli.Context) error {
+	var sigBytes []byte
+	var err error
+	if sigFileName := c.String("signature"); sigFileName != "" {
+		sigBytes, err = ioutil.ReadFile(sigFileName)
+	} else {
+		sigBytes, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+	var msg []byte
+	if fileName := c.Args().First(); fileName != "" {
+		if msg, err = ioutil.ReadFile(fileName); err != nil {
+			return errors.New("Couldn't read file:" + err.Error())
+		}
+	}
+
+	report, err := inspect(msg, sigBytes, c.String(optionGroup))
+	if err != nil {
+		return fmt.Errorf("Couldn't inspect signature: %s", err.Error())
+	}
+	if c.Bool("json") {
+		b, err := json.MarshalIndent(report, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(c.App.Writer, string(b))
+		return err
+	}
+	return report.write(c.App.Writer)
+}
+
+// inspect decodes the signature file sigBytes against the group definition.
+// If msg is not nil, the signature is also verified over it.
+func inspect(msg, sigBytes []byte, groupToml string) (*inspectReport, error) {
+	f, err := os.Open(groupToml)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g, err := app.ReadGroupDescToml(f)
+	if err != nil {
+		return nil, err
+	}
+
+	sigStr := &sigHex{}
+	if err = json.Unmarshal(sigBytes, sigStr); err != nil {
+		return nil, err
+	}
+	sig := &blscosi_simple.SignatureResponse{}
+	if sig.Hash, err = hex.DecodeString(sigStr.Hash); err != nil {
+		return nil, err
+	}
+	if sig.Signature, err = hex.DecodeString(sigStr.Signature); err != nil {
+		return nil, err
+	}
+	suite := blscosi_simple.NewClient().Suite().(*pairing.SuiteBn256)
+	if len(sig.Signature) < suite.G1().PointLen() {
+		return nil, errors.New("signature too short")
+	}
+	m, err := sig.Signature.GetMask(suite, g.Roster.ServicePublics(blscosi_simple.ServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("the mask doesn't match the group: %s", err.Error())
+	}
+	mask := m.Mask()
+
+	n := len(g.Roster.List)
+	report := &inspectReport{Hash: sigStr.Hash, Servers: n, Threshold: protocol.DefaultThreshold(n)}
+	if msg != nil {
+		h := suite.Hash()
+		h.Write(msg)
+		matches := bytes.Equal(h.Sum(nil), sig.Hash)
+		report.FileMatches = &matches
+		valid := true
+		if err := check.VerifySignatureHash(msg, sig, g.Roster); err != nil {
+			valid = false
+			report.Error = err.Error()
+		}
+		report.Valid = &valid
+	}
+
+	for i, si := range g.Roster.List {
+		s := inspectServer{Index: i, Address: si.Address.String(), Description: g.Description[si]}
+		if i>>3 < len(mask) && mask[i>>3]&(1<<uint(i&7)) != 0 {
+			report.Signers = append(report.Signers, s)
+		} else {
+			report.Missing = append(report.Missing, s)
+		}
+	}
+	return report, nil
+}
+
+// write prints the report in a human-readable form
+func (r *inspectReport) write(w io.Writer) error {
+	fmt.Fprintf(w, "Hash:      %s\n", r.Hash)
+	if r.FileMatches != nil {
+		fmt.Fprintf(w, "File:      hash matches: %v, valid: %v\n", *r.FileMatches, *r.Valid)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(w, "Error:     %s\n", r.Error)
+	}
+	fmt.Fprintf(w, "Signers:   %d of %d, threshold %d\n", len(r.Signers), r.Servers, r.Threshold)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nINDEX\tSTATUS\tADDRESS\tDESCRIPTION")
+	signers, missing := r.Signers, r.Missing
+	for len(signers) > 0 || len(missing) > 0 {
+		status, s := "signed", inspectServer{}
+		if len(missing) == 0 || (len(signers) > 0 && signers[0].Index < missing[0].Index) {
+			s, signers = signers[0], signers[1:]
+		} else {
+			status, s, missing = "missing", missing[0], missing[1:]
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Index, status, s.Address, s.Description)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,37 @@
+package protocol
+
+// FullRumors makes the nodes send all the responses they know in every
+// rumor instead of the ones that are new to the peer. It is meant to compare
+// both in simulations.
+var FullRumors = false
+
+// exchanged holds, per peer roster index, the signers whose response has
+// already been sent to or received from that peer.
+type exchanged map[int]map[uint32]bool
+
+// delta returns the responses that haven't been exchanged with the peer yet.
+func (ex exchanged) delta(peer int, responses ResponseMap) ResponseMap {
+	if FullRumors {
+		return responses
+	}
+	known := ex[peer]
+	delta := make(ResponseMap)
+	for idx, r := range responses {
+		if !known[idx] {
+			delta[idx] = r
+		}
+	}
+	return delta
+}
+
+// mark records that the responses have been exchanged with the peer.
+func (ex exchanged) mark(peer int, responses ResponseMap) {
+	known, ok := ex[peer]
+	if !ok {
+		known = make(map[uint32]bool)
+		ex[peer] = known
+	}
+	for idx := range responses {
+		known[idx] = true
+	}
+}
@@ -19,10 +19,6 @@ import (
 
 const defaultTimeout = 10 * time.Second
 const shutdownAfter = 11 * time.Second // finally truly shutdown the protocol
-const gossipTick = 100 * time.Millisecond
-
-const rumorPeers = 2    // number of peers that a rumor message is sent to
-const shutdownPeers = 2 // number of peers that the shutdown message is sent to
 
 // VerificationFn is called on every node. Where msg is the message that is
 // co-signed and the data is additional data for verification.
@@ -51,10 +47,34 @@ type BlsCosi struct {
 	startChan      chan bool
 	verificationFn VerificationFn
 	suite          *pairing.SuiteBn256
+	Params         Parameters // mainly for simulations
+
+	// traffic counts the messages of this instance, see Traffic
+	traffic *Traffic
+	// pace is the current tick and fanout of the gossip
+	pace *gossipPace
+	// exchanged tracks the responses each peer already has from us
+	exchanged exchanged
+	// hash and paramsDigest identify the round in the compact rumors
+	hash         []byte
+	paramsDigest []byte
+	// known are the roster indexes of the peers that have the message
+	known map[int]bool
+
+	// elections is the term of the current leader, the root's being zero,
+	// and takeover the proof of its election. silentTicks is the number of
+	// ticks since we heard from the leader and votes the votes known for the
+	// next term.
+	elections   int
+	takeover    *Takeover
+	silentTicks int
+	votes       map[uint32][]byte
 
 	// internodes channels
-	RumorsChan   chan RumorMessage
-	ShutdownChan chan ShutdownMessage
+	RumorsChan        chan RumorMessage
+	CompactRumorsChan chan CompactRumorMessage
+	ShutdownChan      chan ShutdownMessage
+	TakeoverChan      chan TakeoverMessage
 }
 
 // NewDefaultProtocol is the default protocol function used for registration
@@ -87,11 +107,15 @@ func NewBlsCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite *pairing.Suit
 		Timeout:          defaultTimeout,
 		Threshold:        DefaultThreshold(nNodes),
 		startChan:        make(chan bool, 1),
+		Params:           DefaultParams(),
+		traffic:          newTraffic(),
+		exchanged:        make(exchanged),
+		known:            make(map[int]bool),
 		verificationFn:   vf,
 		suite:            suite,
 	}
 
-	err := c.RegisterChannels(&c.RumorsChan, &c.ShutdownChan)
+	err := c.RegisterChannels(&c.RumorsChan, &c.CompactRumorsChan, &c.ShutdownChan, &c.TakeoverChan)
 	if err != nil {
 		return nil, errors.New("couldn't register channels: " + err.Error())
 	}
@@ -108,9 +132,25 @@ func (p *BlsCosi) Shutdown() error {
 	return nil
 }
 
+// Traffic returns the counts of the messages exchanged by this instance. It
+// can be read once the round is over.
+func (p *BlsCosi) Traffic() *Traffic {
+	return p.traffic
+}
+
+// sendTo sends the message to a single peer and counts it.
+func (p *BlsCosi) sendTo(target *onet.TreeNode, msg interface{}) error {
+	err := p.SendTo(target, msg)
+	if err == nil {
+		p.traffic.countSent(msg)
+	}
+	return err
+}
+
 // Dispatch is the main method of the protocol for all nodes.
 func (p *BlsCosi) Dispatch() error {
 	defer p.Done()
+	defer p.traffic.record()
 
 	protocolTimeout := time.After(shutdownAfter)
 
@@ -134,11 +174,15 @@ func (p *BlsCosi) Dispatch() error {
 		if err != nil {
 			return err
 		}
+		if err := p.setDigests(); err != nil {
+			return err
+		}
 	}
 
 	log.Lvlf3("Gossip protocol started at node %v", p.ServerIdentity())
 
-	ticker := time.NewTicker(gossipTick)
+	p.pace = newGossipPace(p.Params, len(p.Publics()))
+	ticker := time.NewTicker(p.pace.tick)
 
 	var shutdownStruct Shutdown
 
@@ -149,23 +193,38 @@ func (p *BlsCosi) Dispatch() error {
 	for !shutdown {
 		select {
 		case rumor := <-p.RumorsChan:
-			updateResponses(responses, rumor.ResponseMap)
-			log.Lvlf5("Incoming rumor, %d known, %d needed, is-root %v",
-				len(responses), p.Threshold, p.IsRoot())
-			if p.IsRoot() && len(responses) >= p.Threshold {
-				// We've got all the signatures.
-				shutdown = true
+			p.traffic.countReceived(&rumor.Rumor)
+			if len(rumor.Msg) > 0 {
+				p.hasMessage(rumor.TreeNode)
 			}
-
-			if len(p.Msg) == 0 && len(rumor.Msg) > 0 {
+			adopt := len(p.Msg) == 0 && len(rumor.Msg) > 0
+			shutdown = p.handleRumor(responses, rumor)
+			if adopt {
 				p.Msg = rumor.Msg[:]
+				// the gossip goes on with the parameters of the root
+				p.Params = rumor.Params
+				p.pace = newGossipPace(p.Params, len(p.Publics()))
+				ticker.Stop()
+				ticker = time.NewTicker(p.pace.tick)
 				// Add own signature.
 				err := p.trySign(responses)
 				if err != nil {
 					return err
 				}
+				if err := p.setDigests(); err != nil {
+					return err
+				}
+			}
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.hasMessage(compact.TreeNode)
+			if !p.matches(compact.Hash, compact.ParamsDigest) {
+				log.Lvl1("Got a compact rumor for another message")
+				continue
 			}
+			shutdown = p.handleRumor(responses, p.expandRumor(compact))
 		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
 			log.Lvl5("Received shutdown")
 			if err := p.verifyShutdown(shutdownMsg); err == nil {
 				shutdownStruct = shutdownMsg.Shutdown
@@ -174,9 +233,26 @@ func (p *BlsCosi) Dispatch() error {
 				log.Lvl1("Got spoofed shutdown:", err)
 				// Don't take any action
 			}
+		case takeover := <-p.TakeoverChan:
+			p.traffic.countReceived(&takeover.Takeover)
+			p.handleTakeover(takeover)
+			if p.canFinalise() && len(responses) >= p.Threshold {
+				shutdown = true
+			}
 		case <-ticker.C:
 			log.Lvl5("Outgoing rumor")
 			p.sendRumors(responses)
+			// only the nodes that know the message can finish the round
+			if len(p.Msg) > 0 {
+				p.tickLeader()
+				if p.canFinalise() && len(responses) >= p.Threshold {
+					shutdown = true
+				}
+			}
+			if p.pace.update(len(responses)) {
+				ticker.Stop()
+				ticker = time.NewTicker(p.pace.tick)
+			}
 		case <-protocolTimeout:
 			shutdown = true
 			done = true
@@ -185,30 +261,20 @@ func (p *BlsCosi) Dispatch() error {
 	log.Lvl5("Done with gossiping")
 	ticker.Stop()
 
-	if p.IsRoot() {
+	// A successor of the root, or any node of a leaderless round, only
+	// finishes the round with enough signatures, the root always does.
+	successor := !p.IsRoot() && p.canFinalise() && len(responses) >= p.Threshold
+	if shutdownStruct.FinalCoSignature == nil && (p.IsRoot() || successor) {
 		log.Lvl3(p.ServerIdentity().Address, "collected all signature responses")
 
-		// generate root signature
-		signaturePoint, finalMask, err := p.generateSignature(responses)
-		if err != nil {
-			return err
-		}
-
-		signature, err := signaturePoint.MarshalBinary()
-		if err != nil {
-			return err
-		}
-
-		finalSig := append(signature, finalMask.Mask()...)
-		p.FinalSignature <- finalSig
-		log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), signature, finalMask.Mask())
-
-		// Sign shutdown message
-		rootSig, err := bls.Sign(p.suite, p.Private(), finalSig)
+		var err error
+		shutdownStruct, err = p.finalise(responses)
 		if err != nil {
 			return err
 		}
-		shutdownStruct = Shutdown{finalSig, rootSig}
+	}
+	if shutdownStruct.FinalCoSignature != nil {
+		p.FinalSignature <- shutdownStruct.FinalCoSignature
 	}
 
 	p.sendShutdowns(shutdownStruct)
@@ -219,10 +285,18 @@ func (p *BlsCosi) Dispatch() error {
 	for !done {
 		select {
 		case rumor := <-p.RumorsChan:
+			p.traffic.countReceived(&rumor.Rumor)
 			sender := rumor.TreeNode
 			log.Lvl5("Responding to rumor with shutdown", sender.Equal(p.TreeNode()))
 			p.sendShutdown(sender, shutdownStruct)
-		case <-p.ShutdownChan:
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.sendShutdown(compact.TreeNode, shutdownStruct)
+		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
+			// ignore
+		case takeover := <-p.TakeoverChan:
+			p.traffic.countReceived(&takeover.Takeover)
 			// ignore
 		case <-protocolTimeout:
 			done = true
@@ -233,13 +307,53 @@ func (p *BlsCosi) Dispatch() error {
 	return nil
 }
 
+// handleRumor merges the signatures of a rumor and returns true if this node
+// can finalise the round and has enough of them.
+func (p *BlsCosi) handleRumor(responses ResponseMap, rumor RumorMessage) bool {
+	p.exchanged.mark(rumor.RosterIndex, rumor.ResponseMap)
+	p.heardFrom(rumor.TreeNode)
+	updateResponses(responses, rumor.ResponseMap)
+	log.Lvlf5("Incoming rumor, %d known, %d needed, can-finalise %v",
+		len(responses), p.Threshold, p.canFinalise())
+	return p.canFinalise() && len(responses) >= p.Threshold
+}
+
+// finalise aggregates the responses into the final signature and signs it,
+// which gives the shutdown message of the round.
+func (p *BlsCosi) finalise(responses ResponseMap) (Shutdown, error) {
+	signaturePoint, finalMask, err := p.generateSignature(responses)
+	if err != nil {
+		return Shutdown{}, err
+	}
+
+	signature, err := signaturePoint.MarshalBinary()
+	if err != nil {
+		return Shutdown{}, err
+	}
+
+	finalSig := append(signature, finalMask.Mask()...)
+	log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), signature, finalMask.Mask())
+
+	// Sign shutdown message
+	signerSig, err := bls.Sign(p.suite, p.Private(), finalSig)
+	if err != nil {
+		return Shutdown{}, err
+	}
+	// the root that has been replaced signs for its own term
+	var takeover *Takeover
+	if p.isLeader() {
+		takeover = p.takeover
+	}
+	return Shutdown{finalSig, signerSig, uint32(p.TreeNode().RosterIndex), takeover}, nil
+}
+
 func (p *BlsCosi) trySign(responses ResponseMap) error {
 	if p.verificationFn(p.Msg, p.Data) {
 		own, err := p.makeResponse()
 		if err != nil {
 			return err
 		}
-		responses[p.Public().String()] = own
+		responses[uint32(p.TreeNode().RosterIndex)] = own
 		log.Lvlf4("Node %v signed", p.ServerIdentity())
 	} else {
 		log.Lvlf4("Node %v refused to sign", p.ServerIdentity())
@@ -247,9 +361,10 @@ func (p *BlsCosi) trySign(responses ResponseMap) error {
 	return nil
 }
 
-// sendRumors sends a rumor message to some peers.
+// sendRumors sends a rumor message to some peers, as many as the current
+// fanout.
 func (p *BlsCosi) sendRumors(responses ResponseMap) {
-	targets, err := p.getRandomPeers(shutdownPeers)
+	targets, err := p.getRandomPeers(p.pace.peers)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers:", err)
 		return
@@ -260,14 +375,30 @@ func (p *BlsCosi) sendRumors(responses ResponseMap) {
 	}
 }
 
-// sendRumor sends the given signatures to a random peer.
+// sendRumor sends to a peer the signatures it doesn't have from us yet. Once
+// we know the message, the rumor goes out even without new signatures, as a
+// heartbeat that carries the message and shows that we are alive. A leader
+// that can't be reached gets a vote for its replacement.
 func (p *BlsCosi) sendRumor(target *onet.TreeNode, responses ResponseMap) {
-	p.SendTo(target, &Rumor{responses, p.Msg})
+	delta := p.exchanged.delta(target.RosterIndex, responses)
+	if len(delta) == 0 && len(p.Msg) == 0 {
+		return
+	}
+	err := p.sendTo(target, p.rumorFor(target, delta))
+	if err == nil {
+		p.exchanged.mark(target.RosterIndex, delta)
+	} else if !p.isLeader() && target.RosterIndex == p.leaderIndex() {
+		p.leaderGone()
+	}
 }
 
-// sendShutdowns sends a shutdown message to some random peers.
+// sendShutdowns sends a shutdown message to some random peers, and to the
+// children of the node in the dissemination tree if there is one.
 func (p *BlsCosi) sendShutdowns(shutdown Shutdown) {
-	targets, err := p.getRandomPeers(shutdownPeers)
+	if p.Params.ShutdownTree && shutdown.FinalCoSignature != nil {
+		p.sendShutdownTree(shutdown, p.TreeNode().RosterIndex)
+	}
+	targets, err := p.getRandomPeers(p.Params.ShutdownPeers)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers:", err)
 		return
@@ -280,22 +411,42 @@ func (p *BlsCosi) sendShutdowns(shutdown Shutdown) {
 
 // sendShutdown sends a shutdown message to a single peer.
 func (p *BlsCosi) sendShutdown(target *onet.TreeNode, shutdown Shutdown) {
-	p.SendTo(target, &shutdown)
+	p.sendTo(target, &shutdown)
 }
 
 // verifyShutdown verifies the legitimacy of a shutdown message.
 func (p *BlsCosi) verifyShutdown(msg ShutdownMessage) error {
-	rootPublic := p.Publics()[:1]
+	signer := int(msg.Signer)
+	if signer >= len(p.Publics()) {
+		return errors.New("unknown signer of the shutdown")
+	}
+	term := 0
+	if msg.Takeover != nil {
+		if err := p.verifyTakeover(msg.Takeover); err != nil {
+			return err
+		}
+		term = int(msg.Takeover.Term)
+	}
+	if !p.Params.Leaderless && signer != p.leaderOf(term) {
+		return errors.New("shutdown not signed by the leader of its term")
+	}
+	// the roster is in the order of the client, the root isn't always first
+	signerPublic := p.Publics()[signer : signer+1]
 	finalSig := msg.FinalCoSignature
 
-	// verify final signature
-	err := msg.FinalCoSignature.Verify(p.suite, p.Msg, p.Publics())
+	// verify final signature, which must prove the threshold when any node
+	// can create it
+	policy := cosi.NewThresholdPolicy(DefaultThreshold(len(p.Publics())))
+	if p.Params.Leaderless {
+		policy = cosi.NewThresholdPolicy(p.Threshold)
+	}
+	err := msg.FinalCoSignature.VerifyWithPolicy(p.suite, p.Msg, p.Publics(), policy)
 	if err != nil {
 		return err
 	}
 
-	// verify root signature of final signature
-	return msg.RootSig.Verify(p.suite, finalSig, rootPublic)
+	// verify signature of the leader over the final signature
+	return msg.RootSig.Verify(p.suite, finalSig, signerPublic)
 }
 
 // getRandomPeers returns a slice of random peers (not including self).
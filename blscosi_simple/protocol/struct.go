@@ -19,11 +19,13 @@ import (
 const DefaultProtocolName = "simpleCoSiDefault"
 
 func init() {
-	network.RegisterMessages(&Rumor{}, &Shutdown{}, &Response{}, &Stop{})
+	network.RegisterMessages(&Rumor{}, &Shutdown{}, &Response{}, &Stop{}, &Takeover{})
+	network.RegisterMessages(&CompactRumor{})
 }
 
-// ResponseMap is the container used to store responses coming from the children
-type ResponseMap map[string]*Response
+// ResponseMap is the container used to store responses coming from the children,
+// indexed by the roster index of the signer
+type ResponseMap map[uint32]*Response
 
 // BlsSignature contains the message and its aggregated signature
 type BlsSignature []byte
@@ -111,6 +113,7 @@ func (sig BlsSignature) VerifyWithPolicy(ps pairing.Suite, msg []byte, publics [
 
 // Rumor is a struct that can be sent in the gossip protocol
 type Rumor struct {
+	Params      Parameters
 	ResponseMap ResponseMap
 	Msg         []byte
 }
@@ -122,14 +125,33 @@ type RumorMessage struct {
 	Rumor
 }
 
+// CompactRumor is the Rumor sent to a peer known to have the message of the
+// round: the message and the parameters are replaced by their hashes.
+type CompactRumor struct {
+	Hash         []byte
+	ParamsDigest []byte
+	ResponseMap  ResponseMap
+}
+
+// CompactRumorMessage is a wrapper around CompactRumor for it to work with
+// onet
+type CompactRumorMessage struct {
+	*onet.TreeNode
+	CompactRumor
+}
+
 // Shutdown is a struct that can be sent in the gossip protocol
 // A valid shutdown message must contain a proof that the root has seen a valid
 // final signature. This is to prevent faked shutdown messages that take down the
 // gossip protocol. Thus the shutdown message contains the final signature,
 // which in turn is signed by root.
+// A successor of the root signs in its place, Signer is then its roster index
+// and Takeover the proof of its election.
 type Shutdown struct {
 	FinalCoSignature BlsSignature
 	RootSig          BlsSignature
+	Signer           uint32
+	Takeover         *Takeover
 }
 
 // ShutdownMessage just contains a Shutdown and the data necessary to identify
@@ -139,6 +161,21 @@ type ShutdownMessage struct {
 	Shutdown
 }
 
+// Takeover elects the leader of a term once the leader of the previous one
+// has been silent. Votes are the signatures of the nodes that voted for it,
+// indexed by roster index, and the takeover is only valid with the votes of a
+// majority of the roster.
+type Takeover struct {
+	Term  uint32
+	Votes map[uint32][]byte
+}
+
+// TakeoverMessage is a wrapper around Takeover for it to work with onet
+type TakeoverMessage struct {
+	*onet.TreeNode
+	Takeover
+}
+
 // Response is the blscosi response message
 type Response struct {
 	Signature BlsSignature
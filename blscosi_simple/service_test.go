@@ -1,8 +1,11 @@
 package blscosi_simple
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/dedis/student_19_elias/blscosi_simple/protocol"
 	"github.com/stretchr/testify/require"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/sign/cosi"
@@ -68,3 +71,101 @@ func TestService_SignatureRequest(t *testing.T) {
 	// verify the response still
 	require.Nil(t, res.Signature.VerifyWithPolicy(testSuite, msg, publics, cosi.NewThresholdPolicy(1)))
 }
+
+func TestService_RootFailover(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(5, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	params := protocol.DefaultParams()
+	// slow ticks so that the root is gone before it collects the responses
+	params.GossipTick = time.Second
+
+	msg := []byte("hello without root")
+	go service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Params:  params,
+	})
+	// the root sends its first rumor after one tick and dies
+	time.Sleep(1500 * time.Millisecond)
+	require.NoError(t, hosts[0].Close())
+
+	h := testSuite.Hash()
+	h.Write(msg)
+	client := NewClient()
+	alive := onet.NewRoster(roster.List[1:])
+	publics := roster.ServicePublics(ServiceName)
+
+	var res *SignatureResponse
+	var err error
+	for i := 0; i < 20 && res == nil; i++ {
+		time.Sleep(500 * time.Millisecond)
+		res, err = client.RecoveredSignature(context.Background(), alive, roster.ID, h.Sum(nil))
+	}
+	require.NoError(t, err)
+	require.NoError(t, res.Signature.Verify(testSuite, msg, publics))
+}
+
+func TestService_SignatureRequestLeaderless(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(7, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	params := protocol.DefaultParams()
+	params.Leaderless = true
+
+	msg := []byte("hello leaderless")
+	buf, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Params:  params,
+	})
+	require.NoError(t, err)
+
+	publics := roster.ServicePublics(ServiceName)
+	res := buf.(*SignatureResponse)
+	require.NoError(t, res.Signature.Verify(testSuite, msg, publics))
+}
+
+func TestService_ShutdownTree(t *testing.T) {
+	local := onet.NewTCPTest(testSuite)
+	hosts, roster, _ := local.GenTree(16, false)
+	defer local.CloseAll()
+
+	service := hosts[0].Service(ServiceName).(*Service)
+	// no random peers, the shutdown goes along the tree
+	params := protocol.DefaultParams()
+	params.ShutdownTree = true
+	params.ShutdownPeers = 0
+
+	msg := []byte("hello shutdown tree")
+	_, err := service.SignatureRequest(&SignatureRequest{
+		Roster:  roster,
+		Message: msg,
+		Params:  params,
+	})
+	require.NoError(t, err)
+
+	// the nodes keep the signature once they got the shutdown
+	h := testSuite.Hash()
+	h.Write(msg)
+	publics := roster.ServicePublics(ServiceName)
+	for i, host := range hosts[1:] {
+		var res *SignatureResponse
+		for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+			buf, err := host.Service(ServiceName).(*Service).RecoveredSignature(&RecoveredSignatureRequest{
+				Hash:     h.Sum(nil),
+				RosterID: roster.ID[:],
+			})
+			if err == nil {
+				res = buf.(*SignatureResponse)
+				break
+			}
+		}
+		require.NotNil(t, res, "node %d didn't shut down", i+1)
+		require.NoError(t, res.Signature.Verify(testSuite, msg, publics))
+	}
+}
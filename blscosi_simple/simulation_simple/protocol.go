@@ -40,6 +40,9 @@ func init() {
 type SimulationProtocol struct {
 	onet.SimulationBFTree
 	FailingLeaves int
+	FullRumors    int
+	Adaptive      int
+	MaxRumorPeers int
 }
 
 // NewSimulationProtocol is used internally to register the simulation (see the init()
@@ -95,7 +98,7 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 				}
 
 				switch msg.(type) {
-				case *protocol.Rumor, *protocol.Shutdown:
+				case *protocol.Rumor, *protocol.CompactRumor, *protocol.Shutdown:
 					log.Lvl1("Ignoring blscosi message for simulation on ", config.Server.ServerIdentity)
 				default:
 					config.Overlay.Process(e)
@@ -105,6 +108,11 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 			break // this node has been found
 		}
 	}
+	// count the messages of every round per type, and send all the
+	// responses in every rumor if asked, to compare with the deltas
+	protocol.RecordTraffic = true
+	protocol.FullRumors = s.FullRumors != 0
+
 	log.Lvl3("Initializing node-index", index)
 	return s.SimulationBFTree.Node(config)
 }
@@ -119,11 +127,16 @@ func (s *SimulationProtocol) Run(config *onet.SimulationConfig) error {
 		blscosiService := config.GetService(blscosi.ServiceName).(*blscosi.Service)
 		blscosiService.Threshold = s.Hosts - s.FailingLeaves
 
+		params := protocol.DefaultParams()
+		params.Adaptive = s.Adaptive != 0
+		params.MaxRumorPeers = s.MaxRumorPeers
+
 		client := blscosi.NewClient()
 		proposal := []byte{0xFF}
 		serviceReq := &blscosi.SignatureRequest{
 			Roster:  config.Roster,
 			Message: proposal,
+			Params:  params,
 		}
 		serviceReply := &blscosi.SignatureResponse{}
 
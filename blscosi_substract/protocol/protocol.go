@@ -49,10 +49,31 @@ type BlsCosiSubstract struct {
 	suite          *pairing.SuiteBn256
 	Params         Parameters // mainly for simulations
 
+	// traffic counts the messages of this instance, see Traffic
+	traffic *Traffic
+	// pace is the current tick and fanout of the gossip
+	pace *gossipPace
+	// hash and paramsDigest identify the round in the compact rumors
+	hash         []byte
+	paramsDigest []byte
+	// known are the roster indexes of the peers that have the message
+	known map[int]bool
+
+	// elections is the term of the current leader, the root's being zero,
+	// and takeover the proof of its election. silentTicks is the number of
+	// ticks since we heard from the leader and votes the votes known for the
+	// next term.
+	elections   int
+	takeover    *Takeover
+	silentTicks int
+	votes       map[uint32][]byte
+
 	// internodes channels
 	RumorsChan           chan RumorMessage
+	CompactRumorsChan    chan CompactRumorMessage
 	SignatureRequestChan chan SignatureRequestMessage
 	ShutdownChan         chan ShutdownMessage
+	TakeoverChan         chan TakeoverMessage
 }
 
 // NewDefaultProtocol is the default protocol function used for registration
@@ -85,11 +106,13 @@ func NewBlsCosiSubstract(n *onet.TreeNodeInstance, vf VerificationFn, suite *pai
 		Timeout:          defaultTimeout,
 		Threshold:        DefaultThreshold(nNodes),
 		startChan:        make(chan bool, 1),
+		traffic:          newTraffic(),
+		known:            make(map[int]bool),
 		verificationFn:   vf,
 		suite:            suite,
 	}
 
-	err := c.RegisterChannels(&c.RumorsChan, &c.SignatureRequestChan, &c.ShutdownChan)
+	err := c.RegisterChannels(&c.RumorsChan, &c.CompactRumorsChan, &c.SignatureRequestChan, &c.ShutdownChan, &c.TakeoverChan)
 	if err != nil {
 		return nil, errors.New("couldn't register channels: " + err.Error())
 	}
@@ -120,6 +143,21 @@ func (p *BlsCosiSubstract) Start() error {
 	return nil
 }
 
+// Traffic returns the counts of the messages exchanged by this instance. It
+// can be read once the round is over.
+func (p *BlsCosiSubstract) Traffic() *Traffic {
+	return p.traffic
+}
+
+// sendTo sends the message to a single peer and counts it.
+func (p *BlsCosiSubstract) sendTo(target *onet.TreeNode, msg interface{}) error {
+	err := p.SendTo(target, msg)
+	if err == nil {
+		p.traffic.countSent(msg)
+	}
+	return err
+}
+
 // Dispatch is the main method of the protocol for all nodes.
 func (p *BlsCosiSubstract) Dispatch() error {
 	//defer func() {
@@ -128,6 +166,7 @@ func (p *BlsCosiSubstract) Dispatch() error {
 	//	}
 	//}()
 	defer p.Done()
+	defer p.traffic.record()
 
 	protocolTimeout := time.After(shutdownAfter)
 
@@ -156,12 +195,15 @@ func (p *BlsCosiSubstract) Dispatch() error {
 	} else {
 		select {
 		case rumorMsg := <-p.RumorsChan:
+			p.traffic.countReceived(&rumorMsg.Rumor)
+			p.hasMessage(rumorMsg.TreeNode)
 			rumor = &rumorMsg
 			p.Params = rumor.Params
 			// Copy bytes due to the way protobuf allows the bytes to be
 			// shared with the underlying buffer
 			p.Msg = rumor.Msg[:]
 		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
 			p.Params = shutdownMsg.Params
 			p.Msg = shutdownMsg.Msg[:]
 			log.Lvl5("%v Received shutdown", ownId)
@@ -186,6 +228,9 @@ func (p *BlsCosiSubstract) Dispatch() error {
 	if err != nil {
 		return err
 	}
+	if err = p.setDigests(); err != nil {
+		return err
+	}
 
 	if rumor != nil {
 		log.Lvlf5("Rumor received by %d, %d known, %d needed, current: %v, arrived: %v", ownId, len(allResponses.finalMap), p.Threshold, allResponses.finalMap, rumor.Rumor.Map)
@@ -195,19 +240,37 @@ func (p *BlsCosiSubstract) Dispatch() error {
 		}
 	}
 
-	ticker := time.NewTicker(p.Params.GossipTick)
+	p.pace = newGossipPace(p.Params, len(p.Publics()))
+	ticker := time.NewTicker(p.pace.tick)
 	for !shutdown {
 		select {
 		case rumor := <-p.RumorsChan:
+			p.traffic.countReceived(&rumor.Rumor)
+			p.hasMessage(rumor.TreeNode)
 			log.Lvlf5("Rumor received by %d, %d known, %d needed, current: %v, arrived: %v", ownId, len(allResponses.finalMap), p.Threshold, allResponses.finalMap, rumor.Rumor.Map)
 			shutdown, err = handleRumor(allResponses, &rumor, p)
 
+			if err != nil {
+				return err
+			}
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.hasMessage(compact.TreeNode)
+			if !p.matches(compact.Hash, compact.ParamsDigest) {
+				log.Lvl1("Got a compact rumor for another message")
+				continue
+			}
+			rumor := p.expandRumor(compact)
+			shutdown, err = handleRumor(allResponses, &rumor, p)
 			if err != nil {
 				return err
 			}
 		case signatureRequest := <-p.SignatureRequestChan:
+			p.traffic.countReceived(&signatureRequest.SignatureRequest)
+			p.hasMessage(signatureRequest.TreeNode)
 			handleSignatureRequest(allResponses, ownId, &signatureRequest, p)
 		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
 			log.Lvlf5("%v Received shutdown from %v", ownId, shutdownMsg.RosterIndex)
 			if err := p.verifyShutdown(shutdownMsg); err == nil {
 				shutdownStruct = shutdownMsg.Shutdown
@@ -217,9 +280,19 @@ func (p *BlsCosiSubstract) Dispatch() error {
 				log.Lvl3("Length was:", len(shutdownMsg.FinalCoSignature))
 				// Don't take any action
 			}
+		case takeover := <-p.TakeoverChan:
+			p.traffic.countReceived(&takeover.Takeover)
+			p.handleTakeover(takeover)
+			shutdown = p.canFinalise() && allResponses.isEnough(p)
 		case <-ticker.C:
 			log.Lvl5("Outgoing rumor")
 			p.sendRumors(*allResponses, ownId)
+			p.tickLeader()
+			shutdown = p.canFinalise() && allResponses.isEnough(p)
+			if p.pace.update(allResponses.signers()) {
+				ticker.Stop()
+				ticker = time.NewTicker(p.pace.tick)
+			}
 		case <-protocolTimeout:
 			shutdown = true
 			done = true
@@ -228,72 +301,19 @@ func (p *BlsCosiSubstract) Dispatch() error {
 	log.Lvlf3("%v Done with gossiping %v found", ownId, allResponses.finalMap)
 	ticker.Stop()
 
-	if p.IsRoot() {
+	// A successor of the root, or any node of a leaderless round, only
+	// finishes the round with enough signatures, the root always does.
+	successor := !p.IsRoot() && p.canFinalise() && allResponses.isEnough(p)
+	if shutdownStruct.FinalCoSignature == nil && (p.IsRoot() || successor) {
 		log.Lvl3(p.ServerIdentity().Address, "collected all signature responses")
 
-		log.Lvlf3("%v is aggregating signatures", p.ServerIdentity())
-		//var sigs [][]byte
-		//sigs = append(sigs, allResponses.finalResponse.Signature)
-		//
-		//// These signatures have already been multiplied with their coefficients
-		//// So we use the plain BLS aggregation rather than BDN
-		//sig, err := bls.AggregateSignatures(p.suite, sigs...)
-		//if err != nil {
-		//	return err
-		//}
-		//
-		//signaturePoint := p.suite.G1().Point()
-		//err = signaturePoint.UnmarshalBinary(sig)
-		//if err != nil {
-		//	return err
-		//}
-		//
-		//signature, err := signaturePoint.MarshalBinary()
-		//if err != nil {
-		//	return err
-		//}
-		//
-		//finalMask, err := sign.NewMask(p.suite, p.Publics(), nil)
-		//if err != nil {
-		//	return err
-		//}
-		//finalMask.Merge(allResponses.finalResponse.Mask)
-
-		// Other attempt
-		//var sigs [][]byte
-		//finalMask, err := sign.NewMask(p.suite, p.Publics(), nil)
-		//
-		//log.Lvlf3("aggregating total of %d signatures", finalMask.CountEnabled())
-		//
-		//sigs = append(sigs, allResponses.finalResponse.Signature)
-		//err = finalMask.Merge(allResponses.finalResponse.Mask)
-		//if err != nil {
-		//	log.Lvlf3("ERROOOOOOOR211: %v", err)
-		//	return err
-		//}
-		//
-		//signaturePoint, err := bdn.AggregateSignatures(p.suite, sigs, finalMask)
-		//if err != nil {
-		//	log.Lvlf3("ERROOOOOOOR222: %v", err)
-		//	return err
-		//}
-		//
-		//signature, err := signaturePoint.MarshalBinary()
-		//if err != nil {
-		//	return err
-		//}
-
-		// Final part
-		finalSig := append(allResponses.finalResponse.Signature, allResponses.finalResponse.Mask...)
-		log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), allResponses.finalResponse.Signature, allResponses.finalResponse.Mask)
-		p.FinalSignature <- finalSig
-
-		// Sign shutdown message
-		rootSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
+		shutdownStruct, err = p.finalise(allResponses)
 		if err != nil {
 			return err
 		}
-		shutdownStruct = Shutdown{p.Params, finalSig, rootSig, p.Msg}
+	}
+	if shutdownStruct.FinalCoSignature != nil {
+		p.FinalSignature <- shutdownStruct.FinalCoSignature
 	}
 
 	p.sendShutdowns(shutdownStruct)
@@ -304,10 +324,18 @@ func (p *BlsCosiSubstract) Dispatch() error {
 	for !done {
 		select {
 		case rumor := <-p.RumorsChan:
+			p.traffic.countReceived(&rumor.Rumor)
 			sender := rumor.TreeNode
 			log.Lvl5("Responding to rumor with shutdown", sender.Equal(p.TreeNode()))
 			p.sendShutdown(sender, shutdownStruct)
-		case <-p.ShutdownChan:
+		case compact := <-p.CompactRumorsChan:
+			p.traffic.countReceived(&compact.CompactRumor)
+			p.sendShutdown(compact.TreeNode, shutdownStruct)
+		case shutdownMsg := <-p.ShutdownChan:
+			p.traffic.countReceived(&shutdownMsg.Shutdown)
+			// ignore
+		case takeover := <-p.TakeoverChan:
+			p.traffic.countReceived(&takeover.Takeover)
 			// ignore
 		case <-protocolTimeout:
 			done = true
@@ -318,11 +346,36 @@ func (p *BlsCosiSubstract) Dispatch() error {
 	return nil
 }
 
+// finalise turns the aggregated responses into the final signature and signs
+// it, which gives the shutdown message of the round.
+func (p *BlsCosiSubstract) finalise(allResponses *AllResponses) (Shutdown, error) {
+	log.Lvlf3("%v is aggregating signatures", p.ServerIdentity())
+	finalSig := append(allResponses.finalResponse.Signature, allResponses.finalResponse.Mask...)
+	log.Lvlf3("%v created final signature %x with mask %b", p.ServerIdentity(), allResponses.finalResponse.Signature, allResponses.finalResponse.Mask)
+
+	// Sign shutdown message
+	signerSig, err := bdn.Sign(p.suite, p.Private(), finalSig)
+	if err != nil {
+		return Shutdown{}, err
+	}
+	// the root that has been replaced signs for its own term
+	var takeover *Takeover
+	if p.isLeader() {
+		takeover = p.takeover
+	}
+	return Shutdown{p.Params, finalSig, signerSig, p.Msg, uint32(p.TreeNode().RosterIndex), takeover}, nil
+}
+
+// handleRumor adds the signatures of the rumor and returns true if the gossip
+// is over, which is when a node that can finalise has enough of them.
 func handleRumor(allResponses *AllResponses, rumor *RumorMessage, p *BlsCosiSubstract) (bool, error) {
-	return allResponses.Add(rumor.Rumor, p)
+	p.heardFrom(rumor.TreeNode)
+	enough, err := allResponses.Add(rumor.Rumor, p)
+	return enough && p.canFinalise(), err
 }
 
 func handleSignatureRequest(allResponses *AllResponses, ownId uint32, signatureReq *SignatureRequestMessage, p *BlsCosiSubstract) {
+	p.heardFrom(signatureReq.TreeNode)
 	bitMapResponse := make(BitMap)
 	log.Lvlf5("Signature Request received by %d, asking for %d", ownId, signatureReq.SignatureRequest.idx)
 
@@ -365,9 +418,10 @@ func (p *BlsCosiSubstract) trySign(allResponses *AllResponses) (*AllResponses, u
 	return allResponses, uint32(idx), nil
 }
 
-// sendRumors sends a rumor message to some random peers.
+// sendRumors sends a rumor message to some random peers, as many as the
+// current fanout.
 func (p *BlsCosiSubstract) sendRumors(allResponses AllResponses, ownId uint32) {
-	targets, err := p.getRandomPeers(p.Params.RumorPeers)
+	targets, err := p.getRandomPeers(p.pace.peers)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers:", err)
 		return
@@ -378,20 +432,28 @@ func (p *BlsCosiSubstract) sendRumors(allResponses AllResponses, ownId uint32) {
 	}
 }
 
-// sendRumor sends the given signatures to a peer.
+// sendRumor sends the given signatures to a peer. A leader that can't be
+// reached gets a vote for its replacement.
 func (p *BlsCosiSubstract) sendRumor(target *onet.TreeNode, response Response, bitMap BitMap) {
-	p.SendTo(target, &Rumor{p.Params, response, bitMap, p.Msg})
+	err := p.sendTo(target, p.rumorFor(target, &Rumor{p.Params, response, bitMap, p.Msg}))
+	if err != nil && !p.isLeader() && target.RosterIndex == p.leaderIndex() {
+		p.leaderGone()
+	}
 }
 
 // sendSignatureRequest sends a signature request message to a peer.
 func (p *BlsCosiSubstract) sendSignatureRequest(target *onet.TreeNode, idx uint32) {
 	test := make([]int, 1)
 	test[0] = 1
-	p.SendTo(target, &SignatureRequest{idx, p.Msg})
+	p.sendTo(target, &SignatureRequest{idx, p.Msg})
 }
 
-// sendShutdowns sends a shutdown message to some random peers.
+// sendShutdowns sends a shutdown message to some random peers, and to the
+// children of the node in the dissemination tree if there is one.
 func (p *BlsCosiSubstract) sendShutdowns(shutdown Shutdown) {
+	if p.Params.ShutdownTree && shutdown.FinalCoSignature != nil {
+		p.sendShutdownTree(shutdown, p.TreeNode().RosterIndex)
+	}
 	targets, err := p.getRandomPeers(p.Params.ShutdownPeers)
 	if err != nil {
 		log.Lvl1("Couldn't get random peers for shutdown:", err)
@@ -405,7 +467,7 @@ func (p *BlsCosiSubstract) sendShutdowns(shutdown Shutdown) {
 
 // sendShutdown sends a shutdown message to a single peer.
 func (p *BlsCosiSubstract) sendShutdown(target *onet.TreeNode, shutdown Shutdown) {
-	p.SendTo(target, &shutdown)
+	p.sendTo(target, &shutdown)
 }
 
 // verifyShutdown verifies the legitimacy of a shutdown message.
@@ -413,17 +475,37 @@ func (p *BlsCosiSubstract) verifyShutdown(msg ShutdownMessage) error {
 	if len(p.Publics()) == 0 {
 		return errors.New("Roster is empty")
 	}
-	rootPublic := p.Publics()[0]
+	signer := int(msg.Signer)
+	if signer >= len(p.Publics()) {
+		return errors.New("unknown signer of the shutdown")
+	}
+	term := 0
+	if msg.Takeover != nil {
+		if err := p.verifyTakeover(msg.Takeover); err != nil {
+			return err
+		}
+		term = int(msg.Takeover.Term)
+	}
+	if !p.Params.Leaderless && signer != p.leaderOf(term) {
+		return errors.New("shutdown not signed by the leader of its term")
+	}
+	// the roster is in the order of the client, the root isn't always first
+	signerPublic := p.Publics()[signer]
 	finalSig := msg.FinalCoSignature
 
-	// verify final signature
-	err := msg.FinalCoSignature.VerifyAggregate(p.suite, p.Msg, p.Publics())
+	// verify final signature, which must prove the threshold when any node
+	// can create it
+	policy := sign.NewThresholdPolicy(DefaultThreshold(len(p.Publics())))
+	if p.Params.Leaderless {
+		policy = sign.NewThresholdPolicy(p.Threshold)
+	}
+	err := msg.FinalCoSignature.VerifyAggregateWithPolicy(p.suite, p.Msg, p.Publics(), policy)
 	if err != nil {
 		return err
 	}
 
-	// verify root signature of final signature
-	return verify(p.suite, msg.RootSig, finalSig, rootPublic)
+	// verify signature of the leader over the final signature
+	return verify(p.suite, msg.RootSig, finalSig, signerPublic)
 }
 
 // verify checks the signature over the message with a single key
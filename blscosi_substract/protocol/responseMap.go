@@ -191,3 +191,15 @@ func containsMap(map1 BitMap, map2 BitMap) bool {
 func isMaskEqual(mask1 BitMap, mask2 BitMap) bool {
 	return reflect.DeepEqual(mask1, mask2)
 }
+
+// signers returns the number of distinct signers in the responses.
+func (allResponses *AllResponses) signers() int {
+	signers := make(BitMap)
+	for idx := range allResponses.collectedMap {
+		signers[idx] = true
+	}
+	for idx := range allResponses.finalMap {
+		signers[idx] = true
+	}
+	return len(signers)
+}
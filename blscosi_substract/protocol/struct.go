@@ -11,7 +11,8 @@ import (
 const DefaultProtocolName = "substractCoSiDefault"
 
 func init() {
-	network.RegisterMessages(&Rumor{}, &SignatureRequest{}, &Shutdown{})
+	network.RegisterMessages(&Rumor{}, &SignatureRequest{}, &Shutdown{}, &Takeover{})
+	network.RegisterMessages(&CompactRumor{})
 }
 
 // Rumor is a struct that can be sent in the gossip protocol
@@ -29,6 +30,22 @@ type RumorMessage struct {
 	Rumor
 }
 
+// CompactRumor is the Rumor sent to a peer known to have the message of the
+// round: the message and the parameters are replaced by their hashes.
+type CompactRumor struct {
+	Hash         []byte
+	ParamsDigest []byte
+	Response     Response
+	Map          BitMap
+}
+
+// CompactRumorMessage is a wrapper around CompactRumor for it to work with
+// onet
+type CompactRumorMessage struct {
+	*onet.TreeNode
+	CompactRumor
+}
+
 // SignatureRequest is a struct that can be sent in the gossip protocol
 type SignatureRequest struct {
 	idx uint32
@@ -47,11 +64,15 @@ type SignatureRequestMessage struct {
 // final signature. This is to prevent faked shutdown messages that take down the
 // gossip protocol. Thus the shutdown message contains the final signature,
 // which in turn is signed by root.
+// A successor of the root signs in its place, Signer is then its roster index
+// and Takeover the proof of its election.
 type Shutdown struct {
 	Params           Parameters
 	FinalCoSignature BlsSignature
 	RootSig          []byte
 	Msg              []byte
+	Signer           uint32
+	Takeover         *Takeover
 }
 
 // ShutdownMessage just contains a Shutdown and the data necessary to identify
@@ -61,6 +82,21 @@ type ShutdownMessage struct {
 	Shutdown
 }
 
+// Takeover elects the leader of a term once the leader of the previous one
+// has been silent. Votes are the signatures of the nodes that voted for it,
+// indexed by roster index, and the takeover is only valid with the votes of a
+// majority of the roster.
+type Takeover struct {
+	Term  uint32
+	Votes map[uint32][]byte
+}
+
+// TakeoverMessage is a wrapper around Takeover for it to work with onet
+type TakeoverMessage struct {
+	*onet.TreeNode
+	Takeover
+}
+
 // Response is the blscosi response message
 type Response struct {
 	Signature []byte
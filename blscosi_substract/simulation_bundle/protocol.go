@@ -49,6 +49,9 @@ type SimulationProtocol struct {
 	GossipTick    float64
 	RumorPeers    int
 	ShutdownPeers int
+	Adaptive      int
+	MaxRumorPeers int
+	ShutdownTree  int
 }
 
 // NewSimulationProtocol is used internally to register the simulation (see the init()
@@ -97,7 +100,7 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 			}
 
 			switch msg.(type) {
-			case *protocol.Rumor, *protocol.Shutdown:
+			case *protocol.Rumor, *protocol.CompactRumor, *protocol.Shutdown:
 				sleepSecs := rand.Float64()*(s.MaxDelay-s.MinDelay) + s.MinDelay
 				sleepNsecs := sleepSecs * float64(time.Second/time.Nanosecond)
 				log.Lvlf3("Delaying message by %.3f for simulation on %v", sleepSecs, config.Server.ServerIdentity)
@@ -127,7 +130,7 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 				}
 
 				switch msg.(type) {
-				case *protocol.Rumor, *protocol.Shutdown:
+				case *protocol.Rumor, *protocol.CompactRumor, *protocol.Shutdown:
 					log.Lvl2("Ignoring blscosi message for simulation on ", config.Server.ServerIdentity)
 				default:
 					config.Overlay.Process(e)
@@ -138,6 +141,9 @@ func (s *SimulationProtocol) Node(config *onet.SimulationConfig) error {
 		}
 	}
 
+	// count the messages of every round per type
+	protocol.RecordTraffic = true
+
 	log.Lvl3("Initializing node-index", index)
 	return s.SimulationBFTree.Node(config)
 }
@@ -160,6 +166,9 @@ func (s *SimulationProtocol) Run(config *onet.SimulationConfig) error {
 			GossipTick:    time.Duration(s.GossipTick * float64(time.Second/time.Nanosecond)),
 			RumorPeers:    s.RumorPeers,
 			ShutdownPeers: s.ShutdownPeers,
+			Adaptive:      s.Adaptive != 0,
+			MaxRumorPeers: s.MaxRumorPeers,
+			ShutdownTree:  s.ShutdownTree != 0,
 		}
 
 		client := blscosi.NewClient()
@@ -16,6 +16,7 @@ require (
 	go.dedis.ch/kyber/v3 v3.0.4
 	go.dedis.ch/onet/v4 v4.0.0-pre1
 	go.dedis.ch/protobuf v1.0.8
+	go.etcd.io/bbolt v1.3.3
 	go.opencensus.io v0.22.0 // indirect
 	golang.org/x/crypto v0.0.0-20190530122614-20be4c3c3ed5 // indirect
 	golang.org/x/exp v0.0.0-20190510132918-efd6b22b2522 // indirect